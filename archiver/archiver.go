@@ -0,0 +1,156 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/storage"
+)
+
+// Formats supported by the archiver
+const (
+	Zip   = "zip"
+	TarGz = "tar.gz"
+)
+
+// ContentType returns the media type of an archive format
+func ContentType(format string) string {
+	if format == TarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// Write streams an archive of the given paths to w, in the requested format.
+// Entries are named relatively to base, symlinks and special files are skipped.
+func Write(w io.Writer, format string, base string, paths []string) error {
+	if format == TarGz {
+		return WriteTarGz(w, base, paths)
+	}
+	return WriteZip(w, base, paths)
+}
+
+// WriteZip streams a zip archive of the given paths to w
+func WriteZip(w io.Writer, base string, paths []string) error {
+	archive := zip.NewWriter(w)
+
+	for _, path := range paths {
+		err := walk(base, path, func(path string, name string, fileInfo os.FileInfo) error {
+			header, err := zip.FileInfoHeader(fileInfo)
+			if err != nil {
+				return err
+			}
+			header.Name = name
+			if fileInfo.IsDir() {
+				header.Name += "/"
+			} else {
+				header.Method = zip.Deflate
+			}
+
+			entry, err := archive.CreateHeader(header)
+			if err != nil || fileInfo.IsDir() {
+				return err
+			}
+			return copyFile(entry, path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// WriteTarGz streams a gzipped tar archive of the given paths to w
+func WriteTarGz(w io.Writer, base string, paths []string) error {
+	compressor := gzip.NewWriter(w)
+	archive := tar.NewWriter(compressor)
+
+	for _, path := range paths {
+		err := walk(base, path, func(path string, name string, fileInfo os.FileInfo) error {
+			header, err := tar.FileInfoHeader(fileInfo, "")
+			if err != nil {
+				return err
+			}
+			header.Name = name
+			if fileInfo.IsDir() {
+				header.Name += "/"
+			}
+			// Owner names are meaningless outside of the server
+			header.Uname = ""
+			header.Gname = ""
+
+			err = archive.WriteHeader(header)
+			if err != nil || fileInfo.IsDir() {
+				return err
+			}
+			return copyFile(archive, path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := archive.Close()
+	if err != nil {
+		return err
+	}
+	return compressor.Close()
+}
+
+// CommonBase returns the deepest directory containing all the given paths, without going above limit.
+// Archive entries are named relatively to it so that the directory layout of the selection is kept.
+func CommonBase(limit string, paths []string) string {
+	if len(paths) == 0 {
+		return limit
+	}
+
+	var base string = filepath.Dir(paths[0])
+	for _, path := range paths[1:] {
+		for !storage.Contains(base, path) {
+			base = filepath.Dir(base)
+		}
+	}
+
+	if !storage.Contains(limit, base) {
+		return limit
+	}
+	return base
+}
+
+// This function walks a path without following symlinks, calling fn with the archive name of every regular file and directory.
+func walk(base string, root string, fn func(path string, name string, fileInfo os.FileInfo) error) error {
+	return filepath.Walk(root, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fileInfo.IsDir() && !fileInfo.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		// The base directory itself has no entry
+		if rel == "." {
+			return nil
+		}
+
+		return fn(path, filepath.ToSlash(rel), fileInfo)
+	})
+}
+
+func copyFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	return err
+}
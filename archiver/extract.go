@@ -0,0 +1,327 @@
+package archiver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"rakoon/rakoon-back/storage"
+	"strings"
+)
+
+// ErrUnsupported is returned when the archive format is not known
+var ErrUnsupported = errors.New("unsupported archive format")
+
+// ErrUnsafeEntry is returned when an entry would be written outside of the target folder (zip slip)
+var ErrUnsafeEntry = errors.New("archive entry escapes the target folder")
+
+// ErrTooLarge is returned when the extracted content exceeds the size limits
+var ErrTooLarge = errors.New("archive content is too large")
+
+// ErrCompressionRatio is returned when the archive expands abnormally, which is the signature of a zip bomb
+var ErrCompressionRatio = errors.New("archive compression ratio is too high")
+
+// ErrTooManyEntries is returned when an archive holds more entries than allowed
+var ErrTooManyEntries = errors.New("archive has too many entries")
+
+// Limits protects the server against zip bombs
+type Limits struct {
+	MaxSize    int64
+	MaxRatio   int64
+	MaxEntries int
+}
+
+// Options of an extraction
+type Options struct {
+	Overwrite bool
+	Limits    Limits
+	// Progress is called with the number of bytes extracted and the expected total
+	Progress func(processed int64, total int64)
+	// Conflict is called with the name of every entry skipped because it already exists
+	Conflict func(name string)
+	// Reserve is called before bytes are written, the extraction stops if it returns an error
+	Reserve func(bytes int64) error
+}
+
+// Extractable checks if a file can be extracted from its name
+func Extractable(name string) bool {
+	return formatOf(name) != ""
+}
+
+// DeclaredSize returns the uncompressed size announced by a zip archive, or -1 if the format does not declare it upfront
+func DeclaredSize(archivePath string) (int64, error) {
+	if formatOf(archivePath) != "zip" {
+		return -1, nil
+	}
+
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return -1, err
+	}
+	defer reader.Close()
+
+	var size int64
+	for _, file := range reader.File {
+		size += int64(file.UncompressedSize64)
+	}
+	return size, nil
+}
+
+// Extract unpacks a zip, tar or tar.gz archive into the target folder.
+// The real amount of bytes written is checked against the limits, the sizes declared in the archive are not trusted.
+func Extract(ctx context.Context, archivePath string, target string, options Options) error {
+	archiveInfo, err := os.Stat(archivePath)
+	if err != nil {
+		return err
+	}
+
+	var extraction = extraction{
+		ctx:        ctx,
+		target:     target,
+		options:    options,
+		compressed: archiveInfo.Size(),
+	}
+
+	switch formatOf(archivePath) {
+	case "zip":
+		return extraction.zip(archivePath)
+	case "tar.gz":
+		return extraction.tar(archivePath, true)
+	case "tar":
+		return extraction.tar(archivePath, false)
+	}
+	return ErrUnsupported
+}
+
+func formatOf(name string) string {
+	var lower string = strings.ToLower(name)
+	if strings.HasSuffix(lower, ".zip") {
+		return "zip"
+	} else if strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") {
+		return "tar.gz"
+	} else if strings.HasSuffix(lower, ".tar") {
+		return "tar"
+	}
+	return ""
+}
+
+type extraction struct {
+	ctx        context.Context
+	target     string
+	options    Options
+	compressed int64
+	written    int64
+	total      int64
+	entries    int
+}
+
+func (e *extraction) zip(archivePath string) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// The declared sizes give an early rejection and the progress total
+	for _, file := range reader.File {
+		e.total += int64(file.UncompressedSize64)
+	}
+	err = e.checkSize(e.total)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range reader.File {
+		var mode os.FileMode = file.Mode()
+		if mode.IsDir() {
+			err = e.dir(file.Name)
+		} else if mode.IsRegular() {
+			err = e.zipFile(file)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *extraction) zipFile(file *zip.File) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return e.file(file.Name, file.Mode(), src)
+}
+
+func (e *extraction) tar(archivePath string, compressed bool) error {
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	var src io.Reader = archive
+	if compressed {
+		decompressor, err := gzip.NewReader(archive)
+		if err != nil {
+			return err
+		}
+		defer decompressor.Close()
+		src = decompressor
+	}
+
+	reader := tar.NewReader(src)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// Symlinks, hard links and devices are never created
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = e.dir(header.Name)
+		case tar.TypeReg, tar.TypeRegA:
+			err = e.file(header.Name, header.FileInfo().Mode(), reader)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (e *extraction) dir(name string) error {
+	dest, err := e.entryPath(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(dest, 0755)
+}
+
+func (e *extraction) file(name string, mode os.FileMode, src io.Reader) error {
+	dest, err := e.entryPath(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Lstat(dest)
+	if err == nil && !e.options.Overwrite {
+		if e.options.Conflict != nil {
+			e.options.Conflict(path.Clean("/" + name))
+		}
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+
+	// One more byte than the limit is read, so that going over it can be detected
+	if limit := e.sizeLimit(); limit > 0 {
+		src = io.LimitReader(src, limit-e.written+1)
+	}
+	_, err = io.Copy(out, &progressReader{reader: src, extraction: e})
+	out.Close()
+	if err == nil {
+		err = e.checkSize(e.written)
+	}
+	if err != nil {
+		os.Remove(dest)
+		return err
+	}
+
+	if e.total < e.written {
+		e.total = e.written
+	}
+	return nil
+}
+
+// This function maps an entry name to its destination, refusing the names that escape the target folder.
+func (e *extraction) entryPath(name string) (string, error) {
+	e.entries++
+	if e.options.Limits.MaxEntries > 0 && e.entries > e.options.Limits.MaxEntries {
+		return "", ErrTooManyEntries
+	}
+	if e.ctx.Err() != nil {
+		return "", e.ctx.Err()
+	}
+
+	var slashed string = strings.Replace(name, "\\", "/", -1)
+	if path.IsAbs(slashed) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", ErrUnsafeEntry
+	}
+	for _, element := range strings.Split(slashed, "/") {
+		if element == ".." {
+			return "", ErrUnsafeEntry
+		}
+	}
+
+	// Symlinks already present in the target folder can not be used to escape it either
+	dest, err := storage.Jail(e.target, slashed)
+	if err == storage.ErrOutsideHome {
+		return "", ErrUnsafeEntry
+	}
+	return dest, err
+}
+
+// This function returns the maximum amount of bytes the archive can expand to, 0 if there is no limit.
+func (e *extraction) sizeLimit() int64 {
+	var limit int64 = e.options.Limits.MaxSize
+	if e.options.Limits.MaxRatio > 0 {
+		var ratioLimit int64 = e.compressed * e.options.Limits.MaxRatio
+		if limit <= 0 || ratioLimit < limit {
+			limit = ratioLimit
+		}
+	}
+	return limit
+}
+
+func (e *extraction) checkSize(size int64) error {
+	if e.options.Limits.MaxSize > 0 && size > e.options.Limits.MaxSize {
+		return ErrTooLarge
+	}
+	if e.options.Limits.MaxRatio > 0 && e.compressed > 0 && size > e.compressed*e.options.Limits.MaxRatio {
+		return ErrCompressionRatio
+	}
+	return nil
+}
+
+// progressReader counts the bytes extracted and reports them
+type progressReader struct {
+	reader     io.Reader
+	extraction *extraction
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	if err := r.extraction.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := r.reader.Read(p)
+	if n > 0 && r.extraction.options.Reserve != nil {
+		reserveErr := r.extraction.options.Reserve(int64(n))
+		if reserveErr != nil {
+			return 0, reserveErr
+		}
+	}
+	r.extraction.written += int64(n)
+	if r.extraction.options.Progress != nil {
+		r.extraction.options.Progress(r.extraction.written, r.extraction.total)
+	}
+	return n, err
+}
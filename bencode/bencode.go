@@ -0,0 +1,250 @@
+package bencode
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// The nesting of lists and dictionaries is limited, to bound the recursion
+const maxDepth = 64
+
+// SyntaxError describes why data is not bencoded, and where
+type SyntaxError struct {
+	Offset  int
+	Message string
+}
+
+func (err *SyntaxError) Error() string {
+	return "bencode: " + err.Message + " at offset " + strconv.Itoa(err.Offset)
+}
+
+// Raw is the encoding of a value, kept to be decoded later or hashed
+type Raw []byte
+
+// Decode parses a single bencoded value. The integers are int64, the strings string,
+// the lists []interface{} and the dictionaries map[string]interface{}.
+func Decode(data []byte) (interface{}, error) {
+	var d *decoder = &decoder{data: data}
+	value, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(data) {
+		return nil, d.fail("trailing data")
+	}
+	return value, nil
+}
+
+// DecodeDict parses a bencoded dictionary, its values are kept encoded
+func DecodeDict(data []byte) (map[string]Raw, error) {
+	var d *decoder = &decoder{data: data}
+	if len(data) <= 0 || data[0] != 'd' {
+		return nil, d.fail("not a dictionary")
+	}
+	d.pos++
+
+	var dict = map[string]Raw{}
+	for {
+		if d.pos >= len(data) {
+			return nil, d.fail("unexpected end of data")
+		} else if data[d.pos] == 'e' {
+			d.pos++
+			break
+		}
+		key, err := d.key(len(dict))
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := dict[key]; ok {
+			return nil, d.fail("duplicate key " + strconv.Quote(key))
+		}
+		var start int = d.pos
+		_, err = d.value(1)
+		if err != nil {
+			return nil, err
+		}
+		dict[key] = Raw(data[start:d.pos])
+	}
+
+	if d.pos != len(data) {
+		return nil, d.fail("trailing data")
+	}
+	return dict, nil
+}
+
+// decoder reads the values of data from pos
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) fail(message string) error {
+	return &SyntaxError{Offset: d.pos, Message: message}
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, d.fail("too deeply nested")
+	}
+	if d.pos >= len(d.data) {
+		return nil, d.fail("unexpected end of data")
+	}
+
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		return d.integer()
+	case c >= '0' && c <= '9':
+		return d.string()
+	case c == 'l':
+		d.pos++
+		var list = []interface{}{}
+		for {
+			if d.pos >= len(d.data) {
+				return nil, d.fail("unexpected end of data")
+			} else if d.data[d.pos] == 'e' {
+				d.pos++
+				return list, nil
+			}
+			item, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+	case c == 'd':
+		d.pos++
+		var dict = map[string]interface{}{}
+		for {
+			if d.pos >= len(d.data) {
+				return nil, d.fail("unexpected end of data")
+			} else if d.data[d.pos] == 'e' {
+				d.pos++
+				return dict, nil
+			}
+			key, err := d.key(len(dict))
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := dict[key]; ok {
+				return nil, d.fail("duplicate key " + strconv.Quote(key))
+			}
+			dict[key], err = d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, d.fail("unexpected character " + strconv.QuoteRune(rune(d.data[d.pos])))
+}
+
+// The integers are written in base ten between i and e, without leading zeros nor negative zero
+func (d *decoder) integer() (int64, error) {
+	var end int = bytes.IndexByte(d.data[d.pos:], 'e')
+	if end < 0 {
+		return 0, d.fail("unterminated integer")
+	}
+
+	var text string = string(d.data[d.pos+1 : d.pos+end])
+	var digits string = text
+	if len(digits) > 0 && digits[0] == '-' {
+		digits = digits[1:]
+	}
+	if len(digits) <= 0 || (digits[0] == '0' && (len(digits) > 1 || len(text) > 1)) {
+		return 0, d.fail("invalid integer")
+	}
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, d.fail("invalid integer")
+	}
+
+	d.pos += end + 1
+	return value, nil
+}
+
+// The strings are prefixed with their length in bytes and a colon
+func (d *decoder) string() (string, error) {
+	var colon int = bytes.IndexByte(d.data[d.pos:], ':')
+	if colon <= 0 {
+		return "", d.fail("invalid string length")
+	}
+
+	var text string = string(d.data[d.pos : d.pos+colon])
+	if text[0] == '0' && len(text) > 1 {
+		return "", d.fail("invalid string length")
+	}
+	length, err := strconv.Atoi(text)
+	if err != nil || length < 0 {
+		return "", d.fail("invalid string length")
+	}
+	var start int = d.pos + colon + 1
+	if length > len(d.data)-start {
+		return "", d.fail("string longer than the data")
+	}
+
+	d.pos = start + length
+	return string(d.data[start:d.pos]), nil
+}
+
+// The keys of a dictionary are strings
+func (d *decoder) key(index int) (string, error) {
+	if c := d.data[d.pos]; c < '0' || c > '9' {
+		return "", d.fail("dictionary key " + strconv.Itoa(index) + " is not a string")
+	}
+	return d.string()
+}
+
+// Encode writes a value in bencode: integers, strings, byte slices and Raw values, lists of values as []interface{},
+// and dictionaries as map[string]interface{}, whose keys are sorted.
+func Encode(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := encode(&buffer, value)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func encode(buffer *bytes.Buffer, value interface{}) error {
+	switch value := value.(type) {
+	case int:
+		buffer.WriteString("i" + strconv.Itoa(value) + "e")
+	case int64:
+		buffer.WriteString("i" + strconv.FormatInt(value, 10) + "e")
+	case string:
+		buffer.WriteString(strconv.Itoa(len(value)) + ":" + value)
+	case []byte:
+		buffer.WriteString(strconv.Itoa(len(value)) + ":")
+		buffer.Write(value)
+	case Raw:
+		buffer.Write(value)
+	case []interface{}:
+		buffer.WriteByte('l')
+		for _, item := range value {
+			err := encode(buffer, item)
+			if err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte('e')
+	case map[string]interface{}:
+		var keys []string
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buffer.WriteByte('d')
+		for _, key := range keys {
+			encode(buffer, key)
+			err := encode(buffer, value[key])
+			if err != nil {
+				return err
+			}
+		}
+		buffer.WriteByte('e')
+	default:
+		return fmt.Errorf("bencode: can not encode %T", value)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Types of event about files
+const (
+	Created  = "created"
+	Modified = "modified"
+	Deleted  = "deleted"
+	Moved    = "moved"
+)
+
+// Types of event about a user rather than their files
+const (
+	UploadFinished = "upload_finished"
+	JobUpdated     = "job"
+	TorrentUpdated = "torrent"
+	LoggedOut      = "logout"
+)
+
+// Sources of event
+const (
+	// SourceAPI events are published by the handlers, after the operations they perform
+	SourceAPI = "api"
+	// SourceWatcher events are changes seen on the disk, made behind the API's back or not yet reported by it
+	SourceWatcher = "watcher"
+)
+
+// The number of events a subscriber can be late of, the next ones are dropped
+const bufferSize = 1024
+
+// Event is a change in a user's space, or about the user. The paths are absolute.
+type Event struct {
+	Type   string
+	Source string
+	// UserID is the owner of the changed files, or the user concerned
+	UserID int
+	Path   string
+	// OldPath is the previous path of a moved item
+	OldPath string
+	// Data is the payload of the events about a user, such as the state of a job
+	Data interface{}
+	Time time.Time
+}
+
+// IsFileEvent checks if an event is about files
+func (event Event) IsFileEvent() bool {
+	return event.Type == Created || event.Type == Modified || event.Type == Deleted || event.Type == Moved
+}
+
+// Subscription receives the events published after it was created
+type Subscription struct {
+	C      <-chan Event
+	events chan Event
+	once   sync.Once
+}
+
+var mutex sync.RWMutex
+var subscriptions = map[*Subscription]bool{}
+
+// Publish sends an event to every subscription, without waiting for them to handle it
+func Publish(event Event) {
+	if event.Source == "" {
+		event.Source = SourceAPI
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	mutex.RLock()
+	defer mutex.RUnlock()
+	for subscription := range subscriptions {
+		select {
+		case subscription.events <- event:
+		default:
+			log.Println("Event subscription is full, dropped " + event.Type + " event of " + event.Path)
+		}
+	}
+}
+
+// Subscribe creates a subscription, it must be closed once it is not read anymore
+func Subscribe() *Subscription {
+	var events = make(chan Event, bufferSize)
+	var subscription = &Subscription{C: events, events: events}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	subscriptions[subscription] = true
+	return subscription
+}
+
+// Listen calls a function with every event published, in order, from a goroutine of its own
+func Listen(handler func(Event)) {
+	var subscription *Subscription = Subscribe()
+	go func() {
+		for event := range subscription.C {
+			handler(event)
+		}
+	}()
+}
+
+// Close stops the subscription and closes its channel
+func (subscription *Subscription) Close() {
+	subscription.once.Do(func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		delete(subscriptions, subscription)
+		close(subscription.events)
+	})
+}
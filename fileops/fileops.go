@@ -0,0 +1,407 @@
+package fileops
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/storage"
+	"strings"
+	"syscall"
+)
+
+// Conflict policies, applied when a destination already exists
+const (
+	Skip      = "skip"
+	Overwrite = "overwrite"
+	Rename    = "rename"
+)
+
+// ErrIntoItself is returned when a directory is copied or moved inside itself
+var ErrIntoItself = errors.New("a directory can not be copied or moved into itself")
+
+// ErrUnknownPolicy is returned for an unknown conflict policy
+var ErrUnknownPolicy = errors.New("conflict policy must be one of skip, overwrite or rename")
+
+// ItemError describes an item an operation failed to process
+type ItemError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// Report sums up an operation. Paths are relative to the root of the operation.
+type Report struct {
+	Target    string      `json:"target,omitempty"`
+	Processed int         `json:"processed"`
+	Skipped   []string    `json:"skipped"`
+	Errors    []ItemError `json:"errors"`
+}
+
+// Failed checks if at least one item could not be processed
+func (report Report) Failed() bool {
+	return len(report.Errors) > 0
+}
+
+// Replacer takes an item out of its path before it is overwritten, to keep its content.
+// Without a replacer, a file replaces another one and anything else is deleted.
+type Replacer func(path string) error
+
+// ValidPolicy checks a conflict policy
+func ValidPolicy(policy string) bool {
+	return policy == Skip || policy == Overwrite || policy == Rename
+}
+
+// Copy recursively copies src to dst, dst being the path of the copy itself.
+// Every file is written to a temporary name then renamed, so a file is never seen half copied. Symlinks are not followed nor copied.
+// The overwritten items are given to replace.
+func Copy(ctx context.Context, src string, dst string, policy string, replace Replacer) (Report, error) {
+	var report Report = newReport()
+	if !ValidPolicy(policy) {
+		return report, ErrUnknownPolicy
+	}
+
+	srcInfo, err := os.Lstat(src)
+	if err != nil {
+		return report, err
+	}
+
+	dst, proceed, err := resolveConflict(dst, policy)
+	if err != nil {
+		return report, err
+	}
+	if !proceed {
+		report.Target = dst
+		report.Skipped = append(report.Skipped, "/"+filepath.Base(src))
+		return report, nil
+	}
+	// The check is done on the final destination, a renamed copy of a directory next to itself is not inside it
+	if srcInfo.IsDir() && storage.Contains(src, dst) {
+		return report, ErrIntoItself
+	}
+	err = displace(dst, srcInfo, replace)
+	if err != nil {
+		return report, err
+	}
+	report.Target = dst
+
+	copyTree(ctx, src, dst, "/"+filepath.Base(src), policy, replace, &report)
+	return report, ctx.Err()
+}
+
+// Move moves src to dst, dst being the new path of the item.
+// A rename is used when possible, the item is copied then deleted when src and dst are on different devices.
+// The overwritten items are given to replace.
+func Move(ctx context.Context, src string, dst string, policy string, replace Replacer) (Report, error) {
+	var report Report = newReport()
+	if !ValidPolicy(policy) {
+		return report, ErrUnknownPolicy
+	}
+
+	srcInfo, err := os.Lstat(src)
+	if err != nil {
+		return report, err
+	}
+	if src == dst {
+		report.Target = dst
+		return report, nil
+	}
+
+	dst, proceed, err := resolveConflict(dst, policy)
+	if err != nil {
+		return report, err
+	}
+	if !proceed {
+		report.Target = dst
+		report.Skipped = append(report.Skipped, "/"+filepath.Base(src))
+		return report, nil
+	}
+	if srcInfo.IsDir() && storage.Contains(src, dst) {
+		return report, ErrIntoItself
+	}
+	err = displace(dst, srcInfo, replace)
+	if err != nil {
+		return report, err
+	}
+	report.Target = dst
+
+	// A directory can not replace an existing one with a rename, they are merged by a copy instead
+	_, err = os.Lstat(dst)
+	var merge bool = err == nil && srcInfo.IsDir()
+	if !merge {
+		err = os.Rename(src, dst)
+		if err == nil {
+			report.Processed++
+			return report, nil
+		}
+		if !isCrossDevice(err) {
+			return report, err
+		}
+	}
+
+	copyTree(ctx, src, dst, "/"+filepath.Base(src), policy, replace, &report)
+	if ctx.Err() != nil || report.Failed() || len(report.Skipped) > 0 {
+		// The source is kept when anything was left behind
+		return report, ctx.Err()
+	}
+
+	var deletion Report = newReport()
+	deleteTree(ctx, src, "/"+filepath.Base(src), &deletion)
+	report.Errors = append(report.Errors, deletion.Errors...)
+	return report, ctx.Err()
+}
+
+// Delete recursively removes a path. Every item that could not be removed is reported.
+func Delete(ctx context.Context, path string) (Report, error) {
+	var report Report = newReport()
+
+	_, err := os.Lstat(path)
+	if err != nil {
+		return report, err
+	}
+
+	deleteTree(ctx, path, "/"+filepath.Base(path), &report)
+	return report, ctx.Err()
+}
+
+// FreeName returns the first path that does not exist among "name", "name (1)", "name (2)"...
+func FreeName(path string) string {
+	var dir string = filepath.Dir(path)
+	var base string = filepath.Base(path)
+	var extension string = filepath.Ext(base)
+	var name string = strings.TrimSuffix(base, extension)
+
+	var candidate string = path
+	for i := 1; ; i++ {
+		_, err := os.Lstat(candidate)
+		if os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", name, i, extension))
+	}
+}
+
+func newReport() Report {
+	return Report{Skipped: []string{}, Errors: []ItemError{}}
+}
+
+// This function applies the conflict policy to a destination, it returns the final destination and whether the operation should go on.
+// Nothing is changed on the disk, an overwritten destination is only displaced once the operation is checked.
+func resolveConflict(dst string, policy string) (string, bool, error) {
+	_, err := os.Lstat(dst)
+	if os.IsNotExist(err) {
+		return dst, true, nil
+	} else if err != nil {
+		return dst, false, err
+	}
+
+	switch policy {
+	case Skip:
+		return dst, false, nil
+	case Rename:
+		return FreeName(dst), true, nil
+	}
+	return dst, true, nil
+}
+
+// This function takes an existing destination out of the way before it is overwritten. Two directories are merged instead.
+func displace(dst string, srcInfo os.FileInfo, replace Replacer) error {
+	dstInfo, err := os.Lstat(dst)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if srcInfo.IsDir() && dstInfo.IsDir() {
+		return nil
+	}
+	if replace != nil {
+		return replace(dst)
+	}
+	// A file is replaced by the rename of its copy
+	if dstInfo.IsDir() != srcInfo.IsDir() {
+		return os.RemoveAll(dst)
+	}
+	return nil
+}
+
+func copyTree(ctx context.Context, src string, dst string, name string, policy string, replace Replacer, report *Report) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	srcInfo, err := os.Lstat(src)
+	if err != nil {
+		report.Errors = append(report.Errors, ItemError{Path: name, Error: err.Error()})
+		return
+	}
+
+	if srcInfo.Mode()&os.ModeSymlink != 0 || (!srcInfo.IsDir() && !srcInfo.Mode().IsRegular()) {
+		report.Skipped = append(report.Skipped, name)
+		return
+	}
+
+	if !srcInfo.IsDir() {
+		err = copyFile(ctx, src, dst, srcInfo)
+		if err != nil {
+			report.Errors = append(report.Errors, ItemError{Path: name, Error: err.Error()})
+			return
+		}
+		report.Processed++
+		return
+	}
+
+	err = os.MkdirAll(dst, srcInfo.Mode().Perm()|0700)
+	if err != nil {
+		report.Errors = append(report.Errors, ItemError{Path: name, Error: err.Error()})
+		return
+	}
+	report.Processed++
+
+	dir, err := os.Open(src)
+	if err != nil {
+		report.Errors = append(report.Errors, ItemError{Path: name, Error: err.Error()})
+		return
+	}
+	children, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		report.Errors = append(report.Errors, ItemError{Path: name, Error: err.Error()})
+		return
+	}
+
+	for _, child := range children {
+		var childSrc string = filepath.Join(src, child)
+		var childName string = name + "/" + child
+		childInfo, err := os.Lstat(childSrc)
+		if err != nil {
+			report.Errors = append(report.Errors, ItemError{Path: childName, Error: err.Error()})
+			continue
+		}
+
+		childDst, proceed, err := resolveConflict(filepath.Join(dst, child), policy)
+		if err == nil && proceed {
+			err = displace(childDst, childInfo, replace)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, ItemError{Path: childName, Error: err.Error()})
+			continue
+		}
+		if !proceed {
+			report.Skipped = append(report.Skipped, childName)
+			continue
+		}
+		copyTree(ctx, childSrc, childDst, childName, policy, replace, report)
+	}
+}
+
+// This function copies a regular file to a temporary file next to its destination, then renames it.
+func copyFile(ctx context.Context, src string, dst string, srcInfo os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	suffix, err := randomSuffix()
+	if err != nil {
+		return err
+	}
+	var tmp string = filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".rakoon-"+suffix)
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, srcInfo.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, &contextReader{ctx: ctx, reader: in})
+	if err == nil {
+		err = out.Sync()
+	}
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, srcInfo.ModTime(), srcInfo.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func deleteTree(ctx context.Context, path string, name string, report *Report) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	fileInfo, err := os.Lstat(path)
+	if err != nil {
+		report.Errors = append(report.Errors, ItemError{Path: name, Error: err.Error()})
+		return
+	}
+
+	if fileInfo.IsDir() {
+		dir, err := os.Open(path)
+		if err != nil {
+			report.Errors = append(report.Errors, ItemError{Path: name, Error: err.Error()})
+			return
+		}
+		children, err := dir.Readdirnames(-1)
+		dir.Close()
+		if err != nil {
+			report.Errors = append(report.Errors, ItemError{Path: name, Error: err.Error()})
+			return
+		}
+		for _, child := range children {
+			deleteTree(ctx, filepath.Join(path, child), name+"/"+child, report)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+
+	// A directory still holding children that failed is already reported through them
+	err = os.Remove(path)
+	if err != nil {
+		if !fileInfo.IsDir() || len(report.Errors) == 0 {
+			report.Errors = append(report.Errors, ItemError{Path: name, Error: err.Error()})
+		}
+		return
+	}
+	report.Processed++
+}
+
+func isCrossDevice(err error) bool {
+	linkErr, ok := err.(*os.LinkError)
+	return ok && linkErr.Err == syscall.EXDEV
+}
+
+func randomSuffix() (string, error) {
+	b := make([]byte, 6)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// contextReader stops a copy as soon as its context is canceled
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
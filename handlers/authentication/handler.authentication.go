@@ -108,17 +108,16 @@ func RefreshToken(c *gin.Context) {
 		return
 	}
 
-	newToken := GenerateToken(payload.ID, payload.IsAdmin)
+	newToken := GenerateToken(payload.ID)
 	c.JSON(200, gin.H{
-		"userId":  payload.ID,
-		"token":   newToken,
-		"isAdmin": payload.IsAdmin,
+		"userId": payload.ID,
+		"token":  newToken,
 	})
 	return
 }
 
 // GenerateToken function
-func GenerateToken(id int, isAdmin bool) string {
+func GenerateToken(id int) string {
 	var header *models.JwtHeader
 	var payload *models.JwtPayload
 	const alg = "HS256"
@@ -143,7 +142,6 @@ func GenerateToken(id int, isAdmin bool) string {
 	// Building and encrypting payload
 	payload = new(models.JwtPayload)
 	payload.ID = id
-	payload.IsAdmin = isAdmin
 	now := nowAsUnixMilli()
 	payload.Iat = now
 	payload.Exp = now + minutesToMilliseconds(validityLimit)
@@ -168,37 +166,37 @@ func GenerateSignature(encHeader string, encPayload string) string {
 }
 
 // VerifyToken controller: This function checks if the user has to reconnect and if the token is valid. It is only used in the middleware
-func VerifyToken(encHeader string, encPayload string, encSignature string) (isValid bool, message string, status int, id int, isAdmin bool) {
+func VerifyToken(encHeader string, encPayload string, encSignature string) (isValid bool, message string, status int, id int) {
 	// Decode payload
 	decPayloadByte, err := base64.RawURLEncoding.DecodeString(encPayload)
 	decPayload := string(decPayloadByte)
 	payload := new(models.JwtPayload)
 	err = json.Unmarshal([]byte(decPayload), payload)
 	if err != nil {
-		return false, "Bad token", 403, -1, false
+		return false, "Bad token", 403, -1
 	}
 
 	// Check if the user has to reconnect
 	var reauth bool
 	reauth, err = GetReauth(payload.ID)
 	if reauth {
-		return false, "Please reconnect", 401, -1, false
+		return false, "Please reconnect", 401, -1
 	} else if err != nil {
-		return false, "User id in token payload does not exist.", 403, -1, false
+		return false, "User id in token payload does not exist.", 403, -1
 	}
 
 	checkSignature := GenerateSignature(encHeader, encPayload)
 	if encSignature != checkSignature {
-		return false, "Bad signature", 403, -1, false
+		return false, "Bad signature", 403, -1
 	}
 
 	// Check token validity date
 	now := nowAsUnixMilli()
 	if now >= payload.Exp {
-		return false, "Token expired.", 401, -1, false
+		return false, "Token expired.", 401, -1
 	}
 
-	return true, "Token valid", 200, payload.ID, payload.IsAdmin
+	return true, "Token valid", 200, payload.ID
 }
 
 // UserNameExists function
@@ -210,14 +208,6 @@ func UserNameExists(name string) bool {
 	return true
 }
 
-func isAdmin(ID int) bool {
-	ret, err := models.IsAdmin(ID)
-	if err != nil {
-		return false
-	}
-	return ret
-}
-
 func UserIDExists(ID int) bool {
 	_, err := models.GetUserByID(ID)
 	if err != nil {
@@ -1,23 +1,33 @@
 package desktop
 
 import (
-	"fmt"
+	"context"
 	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
+	"mime"
+	"mime/multipart"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
+	"rakoon/rakoon-back/archiver"
+	"rakoon/rakoon-back/events"
+	"rakoon/rakoon-back/fileops"
+	"rakoon/rakoon-back/jobs"
 	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/quota"
+	"rakoon/rakoon-back/recyclebin"
+	"rakoon/rakoon-back/storage"
+	"rakoon/rakoon-back/versions"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-// DeletePath deletes at a given path
+// DeletePath moves a path to the trash, or deletes it permanently
 func DeletePath(c *gin.Context) {
-	var rootPath = os.Getenv("ROOT_PATH")
 	var pathDelete models.PathDelete
 
 	err := c.BindJSON(&pathDelete)
@@ -28,23 +38,65 @@ func DeletePath(c *gin.Context) {
 		return
 	}
 
-	var path string = rootPath + pathDelete.Path
+	location, ok := storage.LocateEntryContext(c, pathDelete.Path, true)
+	if !ok {
+		return
+	}
+	var path string = location.Path
 
-	cmd := exec.Command("rm", "-rf", path)
-	_, err = cmd.Output()
+	// The home directory and the shared folders themselves can not be removed
+	if !isNotRoot(c, location) {
+		return
+	}
 
-	if err != nil {
+	// Items are moved to the trash of their owner, unless a permanent deletion is requested
+	if !pathDelete.Permanent {
+		_, err = recyclebin.Trash(c.Request.Context(), location.OwnerID, path)
+		if err == nil {
+			events.Publish(events.Event{Type: events.Deleted, UserID: location.OwnerID, Path: path})
+		}
+		if os.IsNotExist(err) {
+			c.JSON(404, gin.H{
+				"message": "Path not found.",
+			})
+			return
+		} else if err != nil {
+			c.JSON(500, gin.H{"Error during remove": err.Error()})
+			return
+		}
+
+		c.JSON(200, pathDelete.Path)
+		return
+	}
+
+	report, err := fileops.Delete(c.Request.Context(), path)
+	quota.Invalidate(location.OwnerID)
+	if report.Failed() {
+		events.Publish(events.Event{Type: events.Modified, UserID: location.OwnerID, Path: path})
+	} else if err == nil {
+		events.Publish(events.Event{Type: events.Deleted, UserID: location.OwnerID, Path: path})
+	}
+	if os.IsNotExist(err) {
+		c.JSON(404, gin.H{
+			"message": "Path not found.",
+		})
+		return
+	} else if err != nil {
 		c.JSON(400, gin.H{"Error during remove": err.Error()})
 		return
 	}
 
+	if report.Failed() {
+		c.JSON(207, report)
+		return
+	}
+
 	c.JSON(200, pathDelete.Path)
 	return
 }
 
-// RenamePath renames a file or a directory
+// RenamePath renames or moves a file or a directory
 func RenamePath(c *gin.Context) {
-	var rootPath = os.Getenv("ROOT_PATH")
 	var fileRename models.PathRename
 	err := c.BindJSON(&fileRename)
 
@@ -53,24 +105,71 @@ func RenamePath(c *gin.Context) {
 		c.JSON(400, gin.H{"Incorrect input data": err.Error()})
 		return
 	}
+	if !checkPolicy(c, &fileRename.Conflict) {
+		return
+	}
 
 	var name string = fileRename.Name
-	var originalPath string = rootPath + fileRename.OriginalPath
-	var newPath string = rootPath + fileRename.NewPath
+	original, ok := storage.LocateEntryContext(c, fileRename.OriginalPath, true)
+	if !ok {
+		return
+	}
+	destination, ok := storage.LocateEntryContext(c, fileRename.NewPath, true)
+	if !ok {
+		return
+	}
+	if !isNotRoot(c, original) || !isNotRoot(c, destination) {
+		return
+	}
 
-	err = os.Rename(originalPath, newPath)
-	if err != nil {
+	// The data moved to another user's space counts in their quota
+	var size int64
+	if original.OwnerID != destination.OwnerID {
+		size = quota.Size(original.Path)
+		if !quota.ReserveContext(c, destination.OwnerID, size) {
+			return
+		}
+	}
+
+	report, err := fileops.Move(c.Request.Context(), original.Path, destination.Path, fileRename.Conflict,
+		recyclebin.Replacer(c.Request.Context(), destination.OwnerID))
+	// A move between two users' spaces changes both usages
+	if original.OwnerID != destination.OwnerID {
+		quota.Release(destination.OwnerID, size)
+		quota.Invalidate(original.OwnerID)
+		quota.Invalidate(destination.OwnerID)
+	}
+	if err == nil && !report.Failed() && len(report.Skipped) <= 0 && original.OwnerID == destination.OwnerID {
+		events.Publish(events.Event{Type: events.Moved, UserID: original.OwnerID, Path: report.Target, OldPath: original.Path})
+	} else if len(report.Target) > 0 {
+		// Part of the source may have been left behind
+		events.Publish(events.Event{Type: events.Modified, UserID: original.OwnerID, Path: original.Path})
+		events.Publish(events.Event{Type: events.Created, UserID: destination.OwnerID, Path: report.Target})
+	}
+	if os.IsNotExist(err) {
+		c.JSON(404, gin.H{
+			"message": "Path not found.",
+		})
+		return
+	} else if err == fileops.ErrIntoItself {
+		c.JSON(400, gin.H{"Could not rename file": err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(500, gin.H{"Could not rename file": err.Error()})
 		return
 	}
 
+	if report.Failed() {
+		c.JSON(207, reportForClient(c, report))
+		return
+	}
+
 	c.JSON(201, name)
 	return
 }
 
-// CopyPath copies a file or a directory
+// CopyPath copies a file or a directory into a folder
 func CopyPath(c *gin.Context) {
-	var rootPath = os.Getenv("ROOT_PATH")
 	var copyPath models.CopyPath
 	err := c.BindJSON(&copyPath)
 
@@ -79,57 +178,132 @@ func CopyPath(c *gin.Context) {
 		c.JSON(400, gin.H{"Incorrect input data": err.Error()})
 		return
 	}
+	if !checkPolicy(c, &copyPath.Conflict) {
+		return
+	}
 
-	var source string = rootPath + copyPath.SourcePath
-	var target string = rootPath + copyPath.TargetPath
+	sourceLocation, ok := storage.LocateContext(c, copyPath.SourcePath, false)
+	if !ok {
+		return
+	}
+	targetLocation, ok := storage.LocateContext(c, copyPath.TargetPath, true)
+	if !ok {
+		return
+	}
+	// A shared folder can be copied as a whole, but not the home
+	if sourceLocation.Grant == nil && !isNotRoot(c, sourceLocation) {
+		return
+	}
+	var source, target string = sourceLocation.Path, targetLocation.Path
 
-	if source == target+"/"+copyPath.SourceName {
+	// Copying an item onto itself does nothing, unless a renamed duplicate is requested
+	var destination string = filepath.Join(target, filepath.Base(source))
+	if source == destination && copyPath.Conflict != fileops.Rename {
 		c.JSON(201, "Copied")
 		return
 	}
 
-	cmd := exec.Command("cp", "-rf", source, target)
-	_, err = cmd.Output()
+	// Overwritten items make the exact usage unknown, it will be computed again
+	var size int64 = quota.Size(source)
+	_, existErr := os.Lstat(destination)
+	if !quota.ReserveContext(c, targetLocation.OwnerID, size) {
+		return
+	}
 
-	if err != nil {
+	report, err := fileops.Copy(c.Request.Context(), source, destination, copyPath.Conflict,
+		recyclebin.Replacer(c.Request.Context(), targetLocation.OwnerID))
+	if err != nil || report.Failed() || len(report.Skipped) > 0 || existErr == nil {
+		quota.Release(targetLocation.OwnerID, size)
+		quota.Invalidate(targetLocation.OwnerID)
+	} else {
+		quota.Commit(targetLocation.OwnerID, size)
+	}
+	if len(report.Target) > 0 {
+		events.Publish(events.Event{Type: events.Created, UserID: targetLocation.OwnerID, Path: report.Target})
+	}
+	if os.IsNotExist(err) {
+		c.JSON(404, gin.H{
+			"message": "Path not found.",
+		})
+		return
+	} else if err == fileops.ErrIntoItself {
 		c.JSON(400, gin.H{"Error during copy": err.Error()})
 		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"Error during copy": err.Error()})
+		return
 	}
 
-	c.JSON(201, "Copied")
+	if report.Failed() {
+		c.JSON(207, reportForClient(c, report))
+		return
+	}
+
+	c.JSON(201, reportForClient(c, report))
 	return
 }
 
-// UploadFile uploads a file
+// UploadFile uploads a file, the previous content of an overwritten file is kept as a version
 func UploadFile(c *gin.Context) {
-	var rootPath = os.Getenv("ROOT_PATH")
-	var pathParam string = c.PostFormArray("path")[0]
-	var path string = rootPath + pathParam
+	var pathParam string = c.PostForm("path")
 
 	file, err := c.FormFile("file")
-	src, err := file.Open()
 	if err != nil {
-		c.JSON(401, err.Error())
+		c.JSON(400, gin.H{"Incorrect input data": err.Error()})
+		return
+	}
+	target, ok := storage.LocateContext(c, filepath.Join(pathParam, filepath.Base(file.Filename)), true)
+	if !ok {
+		return
+	}
+	if !quota.ReserveContext(c, target.OwnerID, file.Size) {
 		return
 	}
-	defer src.Close()
 
-	target := fmt.Sprintf("%s/%s", path, file.Filename)
-	out, err := os.Create(target)
+	err = SaveFile(target.OwnerID, file, target.Path)
 	if err != nil {
-		c.JSON(402, err.Error())
+		quota.Release(target.OwnerID, file.Size)
+		c.JSON(500, gin.H{"Could not write file": err.Error()})
 		return
 	}
-	defer out.Close()
+	quota.Commit(target.OwnerID, file.Size)
 
-	_, err = io.Copy(out, src)
 	c.JSON(201, gin.H{"file": file.Filename, "path": pathParam})
 	return
 }
 
+// SaveFile writes an uploaded file to its target in a user's space, the previous content of an existing file is kept as a version.
+// The file size must already be reserved in the user's quota.
+func SaveFile(userID int, file *multipart.FileHeader, target string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// The file is written next to its target then renamed, so that it is never seen half written
+	out, err := ioutil.TempFile(filepath.Dir(target), "."+filepath.Base(target)+".rakoon-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	_, err = io.Copy(out, src)
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(out.Name(), 0644)
+	}
+	if err == nil {
+		err = versions.Replace(userID, out.Name(), target)
+	}
+	return err
+}
+
 // CreateFolder returns a directory's content
 func CreateFolder(c *gin.Context) {
-	var rootPath = os.Getenv("ROOT_PATH")
 	var folder models.Folder
 	err := c.BindJSON(&folder)
 
@@ -139,106 +313,388 @@ func CreateFolder(c *gin.Context) {
 		return
 	}
 
-	var path string = rootPath + folder.Path
-	var folderPath string = path[strings.LastIndex(folder.Name, "/")+1:]
+	location, ok := storage.LocateContext(c, folder.Path, true)
+	if !ok {
+		return
+	}
 
-	err = os.Mkdir(folderPath, 0755)
+	err = os.Mkdir(location.Path, 0755)
 	if err != nil {
 		c.JSON(500, gin.H{"Could not create file": err.Error()})
 		return
 	}
+	events.Publish(events.Event{Type: events.Created, UserID: location.OwnerID, Path: location.Path})
 
 	c.JSON(201, folder.Name)
 	return
 }
 
-// ServeFile returns a fil to download
+// ServeFile streams a file to download
 func ServeFile(c *gin.Context) {
-	var rootPath = os.Getenv("ROOT_PATH")
-	var path string = rootPath + c.Query("path")
-	var fileName string = path[strings.LastIndex(path, "/")+1:]
-
-	// fileInfo, err := os.Stat(path)
-	// if err != nil {
-	// 	c.JSON(http.StatusNotFound, gin.H{"error": err})
-	// 	return
-	// }
-	// get the size
-	//size := fileInfo.Size()
-
-	b, err := ioutil.ReadFile(path)
+	path, ok := storage.ResolveContext(c, c.Query("path"))
+	if !ok {
+		return
+	}
+
+	storage.Serve(c, path, filepath.Base(path))
+}
+
+// DownloadArchive streams a zip or tar.gz archive of one or several paths, generated on the fly
+func DownloadArchive(c *gin.Context) {
+	var pathParams []string = c.QueryArray("path")
+	var format string = c.DefaultQuery("format", archiver.Zip)
+	if len(pathParams) <= 0 {
+		c.JSON(400, gin.H{
+			"message": "No path specified.",
+		})
+		return
+	}
+	if format != archiver.Zip && format != archiver.TarGz {
+		c.JSON(400, gin.H{
+			"message": "Unknown archive format.",
+		})
+		return
+	}
+
+	// The entries are named relatively to the home or the shared folder holding all the paths
+	var paths []string
+	var root string
+	for _, pathParam := range pathParams {
+		location, ok := storage.LocateContext(c, pathParam, false)
+		if !ok {
+			return
+		}
+		_, err := os.Stat(location.Path)
+		if err != nil {
+			c.JSON(404, gin.H{
+				"message": "Path not found: " + pathParam,
+			})
+			return
+		}
+		if len(root) > 0 && location.Root != root {
+			c.JSON(400, gin.H{
+				"message": "Paths must belong to the same space.",
+			})
+			return
+		}
+		root = location.Root
+		paths = append(paths, location.Path)
+	}
+
+	var name string = "archive"
+	if len(paths) == 1 && paths[0] != root {
+		name = filepath.Base(paths[0])
+	}
+
+	c.Header("Content-Type", archiver.ContentType(format))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+	c.Status(200)
+
+	// Headers are already sent, an error can only interrupt the stream
+	err := archiver.Write(c.Writer, format, archiver.CommonBase(root, paths), paths)
+	if err != nil {
+		log.Println("Archive download interrupted:", err)
+	}
+}
+
+// ExtractArchive unpacks an archive into a folder, in a background job the client can poll
+func ExtractArchive(c *gin.Context) {
+	var extract models.Extract
+	err := c.BindJSON(&extract)
+
+	// Check formatting
+	if err != nil {
+		c.JSON(400, gin.H{"Incorrect input data": err.Error()})
+		return
+	}
+
+	archivePath, ok := storage.ResolveContext(c, extract.Path)
+	if !ok {
+		return
+	}
+	targetLocation, ok := storage.LocateContext(c, extract.TargetPath, true)
+	if !ok {
+		return
+	}
+	var target string = targetLocation.Path
+
+	archiveInfo, err := os.Stat(archivePath)
+	if err != nil || archiveInfo.IsDir() {
+		c.JSON(404, gin.H{
+			"message": "Archive not found.",
+		})
+		return
+	}
+	if !archiver.Extractable(archivePath) {
+		c.JSON(400, gin.H{
+			"message": "Unsupported archive format.",
+		})
+		return
+	}
+
+	// The zip archives announce their size, they can be refused before the extraction starts
+	declaredSize, err := archiver.DeclaredSize(archivePath)
 	if err != nil {
-		fmt.Println(err)
+		c.JSON(400, gin.H{"Could not read archive": err.Error()})
+		return
+	}
+	if declaredSize > 0 {
+		if !quota.ReserveContext(c, targetLocation.OwnerID, declaredSize) {
+			return
+		}
+		quota.Release(targetLocation.OwnerID, declaredSize)
 	}
-	m := http.DetectContentType(b[:512])
 
+	err = os.MkdirAll(target, 0755)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err})
+		c.JSON(500, gin.H{"Could not create target folder": err.Error()})
 		return
 	}
 
-	// c.Header("Content-Length", strconv.Itoa(int(size)))
-	// 2020/12/08 18:30:56 http: panic serving 127.0.0.1:45860: http: wrote more than the declared Content-Length
-	fmt.Println("m:", m)
-	c.Header("Content-Disposition", "attachment; filename="+fileName)
-	c.Data(http.StatusOK, "application/octet-stream", b)
+	// The extracted content counts in the quota of the target folder's owner
+	var ownerID int = targetLocation.OwnerID
+	job, err := jobs.Start(storage.UserID(c), "extract", func(ctx context.Context, tracker jobs.Tracker) error {
+		var reserved int64
+		err := archiver.Extract(ctx, archivePath, target, archiver.Options{
+			Overwrite: extract.Overwrite,
+			Limits:    extractLimits(),
+			Progress:  tracker.Progress,
+			Conflict:  tracker.Conflict,
+			Reserve: func(bytes int64) error {
+				err := quota.Reserve(ownerID, bytes)
+				if err == nil {
+					reserved += bytes
+				}
+				return err
+			},
+		})
+		if err != nil || extract.Overwrite {
+			quota.Release(ownerID, reserved)
+			quota.Invalidate(ownerID)
+		} else {
+			quota.Commit(ownerID, reserved)
+		}
+		events.Publish(events.Event{Type: events.Modified, UserID: ownerID, Path: target})
+		return err
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"Could not start extraction": err.Error()})
+		return
+	}
+
+	c.JSON(202, job)
+	return
 }
 
-// GetDirectory returns a directory's content
+// GetDirectory returns a directory's content.
+// It can be sorted with the sort (name, size, mtime or type) and order (asc or desc) parameters, and paginated with offset and limit.
+// The total number of entries is sent in the X-Total-Count header. Hidden files are only listed when hidden is true.
 func GetDirectory(c *gin.Context) {
-	var rootPath = os.Getenv("ROOT_PATH")
-	var path string = rootPath + c.Query("path")
-	var fileInfos []os.FileInfo
-	var directory []models.FileDescriptor
-	if len(path) <= 0 {
+	if len(c.Query("path")) <= 0 {
 		c.JSON(401, gin.H{
 			"message": "No path specified.",
 		})
 		return
 	}
-	fileInfos, err := ioutil.ReadDir(path)
-	if err != nil {
-		log.Fatal("Read dir:", err)
+	var sortKey string = c.DefaultQuery("sort", "name")
+	var order string = c.DefaultQuery("order", "asc")
+	var showHidden bool = c.Query("hidden") == "true"
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(400, gin.H{
+			"message": "Offset not valid",
+		})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil || limit < 0 {
+		c.JSON(400, gin.H{
+			"message": "Limit not valid",
+		})
+		return
+	}
+	if sortKey != "name" && sortKey != "size" && sortKey != "mtime" && sortKey != "type" {
+		c.JSON(400, gin.H{
+			"message": "Sort must be one of name, size, mtime or type",
+		})
+		return
+	}
+	if order != "asc" && order != "desc" {
+		c.JSON(400, gin.H{
+			"message": "Order must be asc or desc",
+		})
+		return
 	}
 
-	var fileDescriptor models.FileDescriptor
-	for _, fileInfo := range fileInfos {
-		var name = fileInfo.Name()
+	directory, ok := readDirectory(c, c.Query("path"), showHidden)
+	if !ok {
+		return
+	}
 
-		if name[0] == '.' {
-			continue
-		}
+	sortDirectory(directory, sortKey, order == "desc")
 
-		fileDescriptor.Name = name
-		var trimmedName = trimName(name)
-		fileDescriptor.TrimmedName = trimmedName
-		if fileInfo.IsDir() {
-			fileDescriptor.Type = "directory"
-		} else {
-			var extension = strings.ToLower(filepath.Ext(name))
-			if extension == ".png" || extension == ".jpg" || extension == ".svg" {
-				fileDescriptor.Type = "image"
-			} else if extension == ".mp4" || extension == ".mkv" {
-				fileDescriptor.Type = "video"
-			} else if extension == ".torrent" {
-				fileDescriptor.Type = "torrent"
-			} else if extension == ".pdf" {
-				fileDescriptor.Type = "pdf"
-			} else if extension == ".zip" {
-				fileDescriptor.Type = "archive"
-			} else {
-				fileDescriptor.Type = "file"
-			}
-		}
-		directory = append(directory, fileDescriptor)
+	c.Header("X-Total-Count", strconv.Itoa(len(directory)))
+	if offset > len(directory) {
+		offset = len(directory)
 	}
+	directory = directory[offset:]
+	if limit > 0 && limit < len(directory) {
+		directory = directory[:limit]
+	}
+
 	c.JSON(200, directory)
 	return
 }
 
-func trimName(name string) string {
-	if len(name) > 15 {
-		return name[0:13] + "..."
+// This function describes the content of a directory, the virtual shared folder lists the folders shared with the user.
+func readDirectory(c *gin.Context, clientPath string, showHidden bool) ([]models.FileDescriptor, bool) {
+	var directory = []models.FileDescriptor{}
+	if path.Clean("/"+clientPath) == storage.SharedDir {
+		shared, err := storage.DescribeShared(storage.UserID(c), showHidden)
+		if err != nil {
+			c.JSON(500, gin.H{"Could not list shared folders": err.Error()})
+			return directory, false
+		}
+		return append(directory, shared...), true
+	}
+
+	location, ok := storage.LocateContext(c, clientPath, false)
+	if !ok {
+		return directory, false
+	}
+
+	fileInfos, err := ioutil.ReadDir(location.Path)
+	if os.IsNotExist(err) {
+		c.JSON(404, gin.H{
+			"message": "Directory not found.",
+		})
+		return directory, false
+	} else if os.IsPermission(err) {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: directory can not be read.",
+		})
+		return directory, false
+	} else if err != nil {
+		c.JSON(400, gin.H{"Could not read directory": err.Error()})
+		return directory, false
+	}
+
+	var home bool = location.Grant == nil && location.IsRoot()
+	for _, fileInfo := range fileInfos {
+		if !showHidden && storage.IsHidden(fileInfo.Name()) {
+			continue
+		}
+		// The virtual shared folder hides a real folder of the same name
+		if home && "/"+fileInfo.Name() == storage.SharedDir {
+			continue
+		}
+		directory = append(directory, storage.Describe(location.Path, fileInfo, showHidden))
+	}
+
+	// The shared folder is listed at the root of the home, when something is shared with the user
+	if home {
+		shared, err := storage.Shared(storage.UserID(c))
+		if err != nil {
+			c.JSON(500, gin.H{"Could not list shared folders": err.Error()})
+			return directory, false
+		}
+		if len(shared) > 0 {
+			directory = append(directory, storage.DescribeSharedDir(len(shared)))
+		}
+	}
+	return directory, true
+}
+
+// Directories are always listed first, then the entries are sorted by the requested key, and by name when they are equal.
+func sortDirectory(directory []models.FileDescriptor, sortKey string, descending bool) {
+	sort.SliceStable(directory, func(i, j int) bool {
+		var a, b models.FileDescriptor = directory[i], directory[j]
+		if (a.Type == storage.TypeDirectory) != (b.Type == storage.TypeDirectory) {
+			return a.Type == storage.TypeDirectory
+		}
+
+		var compare int
+		switch sortKey {
+		case "size":
+			compare = compareInt64(a.Size, b.Size)
+		case "mtime":
+			compare = compareInt64(a.ModTime.UnixNano(), b.ModTime.UnixNano())
+		case "type":
+			compare = strings.Compare(a.Type, b.Type)
+		}
+		if compare == 0 {
+			compare = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		}
+
+		if descending {
+			return compare > 0
+		}
+		return compare < 0
+	})
+}
+
+func compareInt64(a int64, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// This function checks the conflict policy of a request, it defaults to rename so that nothing is overwritten unless requested.
+func checkPolicy(c *gin.Context, policy *string) bool {
+	if *policy == "" {
+		*policy = fileops.Rename
+	}
+
+	if !fileops.ValidPolicy(*policy) {
+		c.JSON(400, gin.H{
+			"message": fileops.ErrUnknownPolicy.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// The target of a report is sent as a path of the user's space
+func reportForClient(c *gin.Context, report fileops.Report) fileops.Report {
+	report.Target, _ = storage.ClientPath(storage.UserID(c), report.Target)
+	return report
+}
+
+// The extraction limits can be configured with environment variables, they default to 10GB, a 100x ratio and 100000 entries.
+func extractLimits() archiver.Limits {
+	var limits archiver.Limits = archiver.Limits{
+		MaxSize:    10 << 30,
+		MaxRatio:   100,
+		MaxEntries: 100000,
+	}
+
+	if maxSize, err := strconv.ParseInt(os.Getenv("EXTRACT_MAX_SIZE"), 10, 64); err == nil {
+		limits.MaxSize = maxSize
+	}
+	if maxRatio, err := strconv.ParseInt(os.Getenv("EXTRACT_MAX_RATIO"), 10, 64); err == nil {
+		limits.MaxRatio = maxRatio
+	}
+	if maxEntries, err := strconv.Atoi(os.Getenv("EXTRACT_MAX_ENTRIES")); err == nil {
+		limits.MaxEntries = maxEntries
+	}
+	return limits
+}
+
+// This function checks that a location is strictly inside the user's home or a shared folder, they can not be moved or removed themselves.
+func isNotRoot(c *gin.Context, location storage.Location) bool {
+	if location.IsRoot() && location.Grant != nil {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: a shared folder can only be modified by its owner.",
+		})
+		return false
+	} else if location.IsRoot() {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: the root of your space can not be modified.",
+		})
+		return false
 	}
-	return name
+	return true
 }
@@ -0,0 +1,155 @@
+package grant
+
+import (
+	"os"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/storage"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Create gives another user, or the members of a group, read or write access to a folder of the connected user's space.
+// The folder appears in the grantees' shared folder.
+func Create(c *gin.Context) {
+	var grantCreate models.GrantCreate
+	err := c.BindJSON(&grantCreate)
+
+	// Check formatting
+	if err != nil {
+		c.JSON(400, gin.H{"Incorrect input data": err.Error()})
+		return
+	}
+	if (len(grantCreate.Grantee) > 0) == (len(grantCreate.Group) > 0) {
+		c.JSON(400, gin.H{
+			"message": "Either a grantee or a group must be given",
+		})
+		return
+	}
+	if grantCreate.Permission != models.GrantRead && grantCreate.Permission != models.GrantWrite {
+		c.JSON(400, gin.H{
+			"message": "Permission must be read or write",
+		})
+		return
+	}
+
+	location, ok := storage.LocateContext(c, grantCreate.Path, false)
+	if !ok {
+		return
+	}
+	if location.Grant != nil {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: only the owner of a folder can share it.",
+		})
+		return
+	}
+	fileInfo, err := os.Stat(location.Path)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"message": "Path not found.",
+		})
+		return
+	} else if !fileInfo.IsDir() {
+		c.JSON(400, gin.H{
+			"message": "Only folders can be shared",
+		})
+		return
+	}
+
+	var grant models.Grant = models.Grant{
+		OwnerID:    storage.UserID(c),
+		Permission: grantCreate.Permission,
+	}
+	if len(grantCreate.Grantee) > 0 {
+		grantee, err := models.GetUserByName(grantCreate.Grantee)
+		if err != nil {
+			c.JSON(404, gin.H{
+				"message": "User not found.",
+			})
+			return
+		}
+		if grantee.ID == grant.OwnerID {
+			c.JSON(400, gin.H{
+				"message": "A folder can not be shared with its owner",
+			})
+			return
+		}
+		grant.GranteeID = &grantee.ID
+	} else {
+		group, err := models.GetGroupByName(grantCreate.Group)
+		if err != nil {
+			c.JSON(404, gin.H{
+				"message": "Group not found.",
+			})
+			return
+		}
+		grant.GroupID = &group.ID
+	}
+	grant.Path, err = storage.Relative(grant.OwnerID, location.Path)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not share folder": err.Error()})
+		return
+	}
+
+	ID, err := models.CreateGrant(grant)
+	if err == nil {
+		grant, err = models.GetGrant(ID)
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"Could not share folder": err.Error()})
+		return
+	}
+
+	c.JSON(201, grant)
+	return
+}
+
+// List returns the grants given by the connected user
+func List(c *gin.Context) {
+	grants, err := models.GetGrantsByOwner(storage.UserID(c))
+	if err != nil {
+		c.JSON(500, gin.H{"Could not list grants": err.Error()})
+		return
+	}
+
+	c.JSON(200, grants)
+	return
+}
+
+// Received returns the grants given to the connected user
+func Received(c *gin.Context) {
+	grants, err := models.GetGrantsForUser(storage.UserID(c))
+	if err != nil {
+		c.JSON(500, gin.H{"Could not list grants": err.Error()})
+		return
+	}
+
+	c.JSON(200, grants)
+	return
+}
+
+// Delete revokes a grant. The owner can revoke it, and a grantee can leave the folder shared with them alone.
+func Delete(c *gin.Context) {
+	ID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "ID not valid",
+		})
+		return
+	}
+
+	grant, err := models.GetGrant(ID)
+	var isGrantee bool = grant.GranteeID != nil && *grant.GranteeID == storage.UserID(c)
+	if err != nil || (grant.OwnerID != storage.UserID(c) && !isGrantee) {
+		c.JSON(404, gin.H{
+			"message": "Grant not found.",
+		})
+		return
+	}
+
+	models.DeleteGrant(grant.ID)
+	c.JSON(200, gin.H{
+		"message": "Grant deleted",
+	})
+	return
+}
@@ -0,0 +1,215 @@
+package group
+
+import (
+	"rakoon/rakoon-back/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// List returns every group
+func List(c *gin.Context) {
+	groups, err := models.GetGroupList()
+	if err != nil {
+		c.JSON(500, gin.H{"Could not list groups": err.Error()})
+		return
+	}
+
+	c.JSON(200, groups)
+	return
+}
+
+// Get returns a group with its members and roles
+func Get(c *gin.Context) {
+	group, ok := getGroup(c)
+	if !ok {
+		return
+	}
+
+	members, err := models.GetGroupMembers(group.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not get group": err.Error()})
+		return
+	}
+	roles, err := models.GetGroupRoles(group.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not get group": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"group":   group,
+		"members": members,
+		"roles":   roles,
+	})
+	return
+}
+
+// Create creates a group
+func Create(c *gin.Context) {
+	var groupInput models.GroupInput
+	err := c.BindJSON(&groupInput)
+
+	// Check formatting
+	if err != nil {
+		c.JSON(400, gin.H{"Incorrect input data": err.Error()})
+		return
+	}
+
+	ID, err := models.CreateGroup(models.Group{Name: groupInput.Name})
+	if err != nil {
+		c.JSON(409, gin.H{"Could not create group": err.Error()})
+		return
+	}
+	group, err := models.GetGroup(ID)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not create group": err.Error()})
+		return
+	}
+
+	c.JSON(201, group)
+	return
+}
+
+// Delete deletes a group, the folders shared with it are not shared anymore
+func Delete(c *gin.Context) {
+	group, ok := getGroup(c)
+	if !ok {
+		return
+	}
+
+	models.DeleteGroup(group.ID)
+	c.JSON(200, gin.H{
+		"message": "Group deleted",
+	})
+	return
+}
+
+// AddMember adds a user to a group
+func AddMember(c *gin.Context) {
+	group, ok := getGroup(c)
+	if !ok {
+		return
+	}
+	userID, ok := getUserID(c)
+	if !ok {
+		return
+	}
+
+	err := models.AddGroupMember(group.ID, userID)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not add member": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Member added",
+	})
+	return
+}
+
+// RemoveMember removes a user from a group
+func RemoveMember(c *gin.Context) {
+	group, ok := getGroup(c)
+	if !ok {
+		return
+	}
+	userID, ok := getUserID(c)
+	if !ok {
+		return
+	}
+
+	models.RemoveGroupMember(group.ID, userID)
+	c.JSON(200, gin.H{
+		"message": "Member removed",
+	})
+	return
+}
+
+// AddRole gives a role to every member of a group
+func AddRole(c *gin.Context) {
+	group, ok := getGroup(c)
+	if !ok {
+		return
+	}
+	roleID, ok := getRoleID(c)
+	if !ok {
+		return
+	}
+
+	err := models.AddGroupRole(group.ID, roleID)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not add role": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Role added",
+	})
+	return
+}
+
+// RemoveRole takes a role back from a group
+func RemoveRole(c *gin.Context) {
+	group, ok := getGroup(c)
+	if !ok {
+		return
+	}
+	roleID, ok := getRoleID(c)
+	if !ok {
+		return
+	}
+
+	models.RemoveGroupRole(group.ID, roleID)
+	c.JSON(200, gin.H{
+		"message": "Role removed",
+	})
+	return
+}
+
+func getGroup(c *gin.Context) (models.Group, bool) {
+	ID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "ID not valid",
+		})
+		return models.Group{}, false
+	}
+
+	group, err := models.GetGroup(ID)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"message": "Group not found.",
+		})
+		return group, false
+	}
+	return group, true
+}
+
+func getUserID(c *gin.Context) (int, bool) {
+	ID, err := strconv.Atoi(c.Param("userId"))
+	if err == nil {
+		_, err = models.GetUserByID(ID)
+	}
+	if err != nil {
+		c.JSON(404, gin.H{
+			"message": "User not found.",
+		})
+		return 0, false
+	}
+	return ID, true
+}
+
+func getRoleID(c *gin.Context) (int, bool) {
+	ID, err := strconv.Atoi(c.Param("roleId"))
+	if err == nil {
+		_, err = models.GetRole(ID)
+	}
+	if err != nil {
+		c.JSON(404, gin.H{
+			"message": "Role not found.",
+		})
+		return 0, false
+	}
+	return ID, true
+}
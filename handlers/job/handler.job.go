@@ -0,0 +1,58 @@
+package job
+
+import (
+	"rakoon/rakoon-back/jobs"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// List returns the background jobs of the connected user
+func List(c *gin.Context) {
+	c.JSON(200, jobs.List(storage.UserID(c)))
+	return
+}
+
+// Get returns the state of a background job
+func Get(c *gin.Context) {
+	job, ok := getJob(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, job)
+	return
+}
+
+// Cancel stops a running background job
+func Cancel(c *gin.Context) {
+	job, ok := getJob(c)
+	if !ok {
+		return
+	}
+
+	if !jobs.Cancel(job.ID) {
+		c.JSON(409, gin.H{
+			"message": "Job is not running.",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Job canceled",
+	})
+	return
+}
+
+// This function fetches the job of the route parameters, a user can only access his own jobs.
+func getJob(c *gin.Context) (models.Job, bool) {
+	job, ok := jobs.Get(c.Param("id"))
+	if !ok || job.UserID != storage.UserID(c) {
+		c.JSON(404, gin.H{
+			"message": "Job not found.",
+		})
+		return job, false
+	}
+	return job, true
+}
@@ -0,0 +1,149 @@
+package music
+
+import (
+	"net/http"
+	"path/filepath"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/music"
+	"rakoon/rakoon-back/storage"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Artists lists the artists of the user's music, with their number of albums and tracks
+func Artists(c *gin.Context) {
+	artists, err := models.GetArtists(storage.UserID(c))
+	if err != nil {
+		c.JSON(500, gin.H{"Could not list artists": err.Error()})
+		return
+	}
+
+	c.JSON(200, artists)
+	return
+}
+
+// Albums lists the albums of the user's music, or the ones of an artist
+func Albums(c *gin.Context) {
+	albums, err := models.GetAlbums(storage.UserID(c), optionalQuery(c, "artist"))
+	if err != nil {
+		c.JSON(500, gin.H{"Could not list albums": err.Error()})
+		return
+	}
+
+	c.JSON(200, albums)
+	return
+}
+
+// Tracks lists the tracks of the user's music, or the ones of an artist and of an album, in the order of the albums
+func Tracks(c *gin.Context) {
+	tracks, err := models.GetTracks(storage.UserID(c), optionalQuery(c, "artist"), optionalQuery(c, "album"))
+	if err != nil {
+		c.JSON(500, gin.H{"Could not list tracks": err.Error()})
+		return
+	}
+
+	c.JSON(200, tracks)
+	return
+}
+
+// Stream sends the audio file of a track, the players can seek in it with Range requests
+func Stream(c *gin.Context) {
+	track, path, ok := getTrack(c)
+	if !ok {
+		return
+	}
+
+	storage.ServeInline(c, path, filepath.Base(track.Path))
+}
+
+// Cover sends the picture embedded in the audio file of a track.
+// The tags are written by anyone, only pictures are sent and the browser must not guess another type.
+func Cover(c *gin.Context) {
+	_, path, ok := getTrack(c)
+	if !ok {
+		return
+	}
+
+	picture, err := music.Cover(path)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"message": "Cover not found.",
+		})
+		return
+	}
+
+	var contentType string = strings.ToLower(strings.TrimSpace(picture.MIMEType))
+	if !isPicture(contentType) {
+		contentType = http.DetectContentType(picture.Data)
+	}
+	if !isPicture(contentType) {
+		c.JSON(415, gin.H{
+			"message": "The cover is not a picture.",
+		})
+		return
+	}
+	c.Header("Cache-Control", "private, no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(200, contentType, picture.Data)
+	return
+}
+
+// Index reads the tags of the user's audio files in the background, for the ones stored before the catalogue existed
+func Index(c *gin.Context) {
+	err := music.Reindex(storage.UserID(c))
+	if err != nil {
+		c.JSON(500, gin.H{"Could not index music": err.Error()})
+		return
+	}
+
+	c.JSON(202, gin.H{
+		"message": "Indexing started",
+	})
+	return
+}
+
+// An empty artist or album is a filter too, the tracks without one are listed with it
+func optionalQuery(c *gin.Context, name string) *string {
+	value, ok := c.GetQuery(name)
+	if !ok {
+		return nil
+	}
+	return &value
+}
+
+func getTrack(c *gin.Context) (models.Track, string, bool) {
+	ID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "Id not valid",
+		})
+		return models.Track{}, "", false
+	}
+
+	track, err := models.GetTrack(storage.UserID(c), ID)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"message": "Track not found.",
+		})
+		return track, "", false
+	}
+
+	path, err := storage.Resolve(track.UserID, track.Path)
+	if err == storage.ErrOutsideHome {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: path is outside of your space.",
+		})
+		return track, "", false
+	} else if err != nil {
+		c.JSON(500, gin.H{"Could not resolve track": err.Error()})
+		return track, "", false
+	}
+	return track, path, true
+}
+
+// SVG pictures can hold scripts, they are not sent as covers
+func isPicture(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(contentType, "image/svg")
+}
@@ -0,0 +1,69 @@
+package notification
+
+import (
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/storage"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// List returns the notifications of the connected user, the most recent first
+func List(c *gin.Context) {
+	notifications, err := models.GetNotificationList(storage.UserID(c))
+	if err != nil {
+		c.JSON(500, gin.H{"Could not list notifications": err.Error()})
+		return
+	}
+
+	c.JSON(200, notifications)
+	return
+}
+
+// Read marks a notification as read
+func Read(c *gin.Context) {
+	notification, ok := getNotification(c)
+	if !ok {
+		return
+	}
+
+	models.MarkNotificationRead(notification.ID)
+	c.JSON(200, gin.H{
+		"message": "Notification read",
+	})
+	return
+}
+
+// Delete removes a notification
+func Delete(c *gin.Context) {
+	notification, ok := getNotification(c)
+	if !ok {
+		return
+	}
+
+	models.DeleteNotification(notification.ID)
+	c.JSON(200, gin.H{
+		"message": "Notification deleted",
+	})
+	return
+}
+
+// This function fetches the notification of the route parameters, only its owner can access it.
+func getNotification(c *gin.Context) (models.Notification, bool) {
+	ID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "ID not valid",
+		})
+		return models.Notification{}, false
+	}
+
+	notification, err := models.GetNotification(ID)
+	if err != nil || notification.UserID != storage.UserID(c) {
+		c.JSON(404, gin.H{
+			"message": "Notification not found.",
+		})
+		return notification, false
+	}
+	return notification, true
+}
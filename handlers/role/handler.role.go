@@ -0,0 +1,186 @@
+package role
+
+import (
+	"rakoon/rakoon-back/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Permissions returns every permission a role can give
+func Permissions(c *gin.Context) {
+	c.JSON(200, models.Permissions)
+	return
+}
+
+// List returns every role
+func List(c *gin.Context) {
+	roles, err := models.GetRoleList()
+	if err != nil {
+		c.JSON(500, gin.H{"Could not list roles": err.Error()})
+		return
+	}
+
+	c.JSON(200, roles)
+	return
+}
+
+// Create creates a role
+func Create(c *gin.Context) {
+	role, ok := bindRole(c)
+	if !ok {
+		return
+	}
+
+	ID, err := models.CreateRole(role)
+	if err == nil {
+		role, err = models.GetRole(ID)
+	}
+	if err != nil {
+		c.JSON(409, gin.H{"Could not create role": err.Error()})
+		return
+	}
+
+	c.JSON(201, role)
+	return
+}
+
+// Update changes the name, the permissions or the default status of a role
+func Update(c *gin.Context) {
+	existing, ok := getRole(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	role, ok := bindRole(c)
+	if !ok {
+		return
+	}
+
+	role.ID = existing.ID
+	err := models.UpdateRole(role)
+	if err != nil {
+		c.JSON(409, gin.H{"Could not update role": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Role updated",
+	})
+	return
+}
+
+// Delete deletes a role, the users and groups holding it lose its permissions
+func Delete(c *gin.Context) {
+	role, ok := getRole(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	models.DeleteRole(role.ID)
+	c.JSON(200, gin.H{
+		"message": "Role deleted",
+	})
+	return
+}
+
+// AddUser gives a role to a user
+func AddUser(c *gin.Context) {
+	userID, role, ok := getUserAndRole(c)
+	if !ok {
+		return
+	}
+
+	err := models.AddUserRole(userID, role.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not add role": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Role added",
+	})
+	return
+}
+
+// RemoveUser takes a role back from a user
+func RemoveUser(c *gin.Context) {
+	userID, role, ok := getUserAndRole(c)
+	if !ok {
+		return
+	}
+
+	models.RemoveUserRole(userID, role.ID)
+	c.JSON(200, gin.H{
+		"message": "Role removed",
+	})
+	return
+}
+
+// This function binds and checks a role sent by the client.
+func bindRole(c *gin.Context) (models.Role, bool) {
+	var roleInput models.RoleInput
+	err := c.BindJSON(&roleInput)
+
+	// Check formatting
+	if err != nil {
+		c.JSON(400, gin.H{"Incorrect input data": err.Error()})
+		return models.Role{}, false
+	}
+	for _, permission := range roleInput.Permissions {
+		if !models.ValidPermission(permission) {
+			c.JSON(400, gin.H{
+				"message": "Unknown permission: " + permission,
+			})
+			return models.Role{}, false
+		}
+	}
+
+	var role models.Role = models.Role{
+		Name:        roleInput.Name,
+		Permissions: roleInput.Permissions,
+		IsDefault:   roleInput.IsDefault,
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	return role, true
+}
+
+func getRole(c *gin.Context, param string) (models.Role, bool) {
+	ID, err := strconv.Atoi(param)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "ID not valid",
+		})
+		return models.Role{}, false
+	}
+
+	role, err := models.GetRole(ID)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"message": "Role not found.",
+		})
+		return role, false
+	}
+	return role, true
+}
+
+func getUserAndRole(c *gin.Context) (int, models.Role, bool) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "ID not valid",
+		})
+		return 0, models.Role{}, false
+	}
+	_, err = models.GetUserByID(userID)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"message": "User not found.",
+		})
+		return 0, models.Role{}, false
+	}
+
+	role, ok := getRole(c, c.Param("roleId"))
+	return userID, role, ok
+}
@@ -0,0 +1,137 @@
+package search
+
+import (
+	"os"
+	"rakoon/rakoon-back/search"
+	"rakoon/rakoon-back/storage"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The number of results sent by default, and at most
+const defaultLimit = 100
+const maxLimit = 1000
+
+// Search finds files under a folder, by default the whole space of the user with the folders shared with them.
+// The name is matched with q, as a glob or a fuzzy query (match=auto, glob or fuzzy). The results can be filtered by
+// type (comma separated), minSize and maxSize in bytes, after and before (RFC 3339 or YYYY-MM-DD) on the modification time,
+// and by content words searched in the indexed text and PDF files. Hidden files are only searched when hidden is true.
+func Search(c *gin.Context) {
+	matcher, err := search.NewMatcher(c.Query("q"), c.Query("match"))
+	if err != nil {
+		c.JSON(400, gin.H{"Incorrect query": err.Error()})
+		return
+	}
+
+	var query search.Query = search.Query{
+		Name:       matcher,
+		Content:    strings.TrimSpace(c.Query("content")),
+		ShowHidden: c.Query("hidden") == "true",
+	}
+	if types := c.Query("type"); len(types) > 0 {
+		query.Types = strings.Split(types, ",")
+	}
+
+	var ok bool
+	if query.MinSize, ok = sizeParam(c, "minSize"); !ok {
+		return
+	}
+	if query.MaxSize, ok = sizeParam(c, "maxSize"); !ok {
+		return
+	}
+	if query.After, ok = dateParam(c, "after", false); !ok {
+		return
+	}
+	if query.Before, ok = dateParam(c, "before", true); !ok {
+		return
+	}
+
+	query.Limit, err = strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || query.Limit <= 0 || query.Limit > maxLimit {
+		c.JSON(400, gin.H{
+			"message": "Limit must be between 1 and " + strconv.Itoa(maxLimit),
+		})
+		return
+	}
+
+	areas, err := search.Areas(storage.UserID(c), c.DefaultQuery("path", "/"))
+	if err == storage.ErrOutsideHome {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: path is outside of your space.",
+		})
+		return
+	} else if os.IsNotExist(err) {
+		c.JSON(404, gin.H{
+			"message": "Path not found.",
+		})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"Could not search": err.Error()})
+		return
+	}
+
+	results, err := search.Find(c.Request.Context(), areas, query)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not search": err.Error()})
+		return
+	}
+
+	c.JSON(200, results)
+	return
+}
+
+// Index rebuilds the content index of the user's files in the background
+func Index(c *gin.Context) {
+	err := search.Reindex(storage.UserID(c))
+	if err != nil {
+		c.JSON(500, gin.H{"Could not index files": err.Error()})
+		return
+	}
+
+	c.JSON(202, gin.H{
+		"message": "Indexing started",
+	})
+	return
+}
+
+func sizeParam(c *gin.Context, name string) (int64, bool) {
+	if len(c.Query(name)) <= 0 {
+		return 0, true
+	}
+
+	size, err := strconv.ParseInt(c.Query(name), 10, 64)
+	if err != nil || size < 0 {
+		c.JSON(400, gin.H{
+			"message": name + " not valid",
+		})
+		return 0, false
+	}
+	return size, true
+}
+
+// A date without time covers the whole day, it ends at midnight when it is the upper bound
+func dateParam(c *gin.Context, name string, upper bool) (time.Time, bool) {
+	var value string = c.Query(name)
+	if len(value) <= 0 {
+		return time.Time{}, true
+	}
+
+	date, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return date, true
+	}
+	date, err = time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": name + " must be a RFC 3339 date or YYYY-MM-DD",
+		})
+		return time.Time{}, false
+	}
+	if upper {
+		date = date.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return date, true
+}
@@ -0,0 +1,595 @@
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/archiver"
+	"rakoon/rakoon-back/fileops"
+	"rakoon/rakoon-back/handlers/authentication"
+	"rakoon/rakoon-back/handlers/desktop"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/quota"
+	"rakoon/rakoon-back/storage"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Create makes a public link to a file or a folder of the connected user's space
+func Create(c *gin.Context) {
+	var shareCreate models.ShareCreate
+	err := c.BindJSON(&shareCreate)
+
+	// Check formatting
+	if err != nil {
+		c.JSON(400, gin.H{"Incorrect input data": err.Error()})
+		return
+	}
+	if shareCreate.ExpiresOn != nil && shareCreate.ExpiresOn.Before(time.Now()) {
+		c.JSON(400, gin.H{
+			"message": "Expiration date must be in the future",
+		})
+		return
+	}
+	if shareCreate.MaxDownloads != nil && *shareCreate.MaxDownloads <= 0 {
+		c.JSON(400, gin.H{
+			"message": "Max downloads must be positive",
+		})
+		return
+	}
+	if shareCreate.MaxSize != nil && *shareCreate.MaxSize <= 0 {
+		c.JSON(400, gin.H{
+			"message": "Max size must be positive",
+		})
+		return
+	}
+	if len(shareCreate.Kind) <= 0 {
+		shareCreate.Kind = models.ShareDownload
+	}
+	if shareCreate.Kind != models.ShareDownload && shareCreate.Kind != models.ShareUpload {
+		c.JSON(400, gin.H{
+			"message": "Kind must be download or upload",
+		})
+		return
+	}
+
+	location, ok := storage.LocateContext(c, shareCreate.Path, false)
+	if !ok {
+		return
+	}
+	if location.Grant != nil {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: only the owner of a file can create a link to it.",
+		})
+		return
+	}
+	var path string = location.Path
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"message": "Path not found.",
+		})
+		return
+	}
+
+	if shareCreate.Kind == models.ShareUpload && !fileInfo.IsDir() {
+		c.JSON(400, gin.H{
+			"message": "An upload link must target a folder",
+		})
+		return
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		c.JSON(500, gin.H{"Could not create share": err.Error()})
+		return
+	}
+
+	var share models.Share = models.Share{
+		Token:        token,
+		UserID:       storage.UserID(c),
+		IsDir:        fileInfo.IsDir(),
+		Kind:         shareCreate.Kind,
+		ExpiresOn:    shareCreate.ExpiresOn,
+		MaxDownloads: shareCreate.MaxDownloads,
+		MaxSize:      shareCreate.MaxSize,
+		AllowedTypes: normalizeTypes(shareCreate.AllowedTypes),
+	}
+	share.Path, err = storage.Relative(share.UserID, path)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not create share": err.Error()})
+		return
+	}
+	if len(shareCreate.Password) > 0 {
+		hash, err := authentication.HashPassword(shareCreate.Password)
+		if err != nil {
+			c.JSON(500, gin.H{"Could not create share": err.Error()})
+			return
+		}
+		share.Password = &hash
+	}
+
+	share, err = models.CreateShare(share)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not create share": err.Error()})
+		return
+	}
+
+	c.JSON(201, share)
+	return
+}
+
+// List returns the shares of the connected user
+func List(c *gin.Context) {
+	shares, err := models.GetShareList(storage.UserID(c))
+	if err != nil {
+		c.JSON(500, gin.H{"Could not list shares": err.Error()})
+		return
+	}
+
+	c.JSON(200, shares)
+	return
+}
+
+// Delete revokes a share, its link stops working immediately
+func Delete(c *gin.Context) {
+	ID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "ID not valid",
+		})
+		return
+	}
+
+	share, err := models.GetShare(ID)
+	if err != nil || share.UserID != storage.UserID(c) {
+		c.JSON(404, gin.H{
+			"message": "Share not found.",
+		})
+		return
+	}
+
+	models.DeleteShare(share.ID)
+	c.JSON(200, gin.H{
+		"message": "Share deleted",
+	})
+	return
+}
+
+// Unlock checks the password of a share and returns the key giving access to it
+func Unlock(c *gin.Context) {
+	var shareUnlock models.ShareUnlock
+	err := c.BindJSON(&shareUnlock)
+
+	// Check formatting
+	if err != nil {
+		c.JSON(400, gin.H{"Incorrect input data": err.Error()})
+		return
+	}
+
+	share, ok := getPublicShare(c)
+	if !ok {
+		return
+	}
+
+	if share.Password == nil {
+		c.JSON(200, gin.H{"key": ""})
+		return
+	}
+	if !authentication.CheckPasswordHash(shareUnlock.Password, *share.Password) {
+		c.JSON(403, gin.H{
+			"message": "Wrong password.",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{"key": accessKey(share)})
+	return
+}
+
+// Get describes a share to a visitor. For a folder, the content of the sub folder given by the path query parameter is listed.
+func Get(c *gin.Context) {
+	share, ok := getPublicShare(c)
+	if !ok || !checkKey(c, share) {
+		return
+	}
+
+	var publicShare models.PublicShare = models.PublicShare{
+		Name:      filepath.Base(share.Path),
+		IsDir:     share.IsDir,
+		Kind:      share.Kind,
+		ExpiresOn: share.ExpiresOn,
+	}
+
+	// The visitors of an upload link only learn its limits
+	if share.Kind == models.ShareUpload {
+		publicShare.MaxSize = share.MaxSize
+		publicShare.AllowedTypes = share.AllowedTypes
+		c.JSON(200, publicShare)
+		return
+	}
+
+	path, ok := resolveInShare(c, share, c.Query("path"))
+	if !ok {
+		return
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"message": "Path not found.",
+		})
+		return
+	}
+
+	if !fileInfo.IsDir() {
+		var file models.FileDescriptor = storage.Describe(filepath.Dir(path), fileInfo, false)
+		publicShare.File = &file
+		c.JSON(200, publicShare)
+		return
+	}
+
+	fileInfos, err := ioutil.ReadDir(path)
+	if err != nil {
+		c.JSON(400, gin.H{"Could not read directory": err.Error()})
+		return
+	}
+	publicShare.Content = []models.FileDescriptor{}
+	for _, fileInfo := range fileInfos {
+		if storage.IsHidden(fileInfo.Name()) {
+			continue
+		}
+		publicShare.Content = append(publicShare.Content, storage.Describe(path, fileInfo, false))
+	}
+	sort.SliceStable(publicShare.Content, func(i, j int) bool {
+		var a, b models.FileDescriptor = publicShare.Content[i], publicShare.Content[j]
+		if (a.Type == storage.TypeDirectory) != (b.Type == storage.TypeDirectory) {
+			return a.Type == storage.TypeDirectory
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+
+	c.JSON(200, publicShare)
+	return
+}
+
+// Download sends a shared file, or a zip archive of a shared folder. Every download counts against the share's limit.
+func Download(c *gin.Context) {
+	share, ok := getPublicShare(c)
+	if !ok || !checkKey(c, share) {
+		return
+	}
+	if share.Kind != models.ShareDownload {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: this link only accepts uploads.",
+		})
+		return
+	}
+
+	path, ok := resolveInShare(c, share, c.Query("path"))
+	if !ok {
+		return
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"message": "Path not found.",
+		})
+		return
+	}
+
+	// The following requests of a resumed or streamed file download are not counted again, a zip archive is always counted
+	if fileInfo.IsDir() || !isContinuation(c, share) {
+		allowed, err := models.CountShareDownload(share.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"Could not download share": err.Error()})
+			return
+		} else if !allowed {
+			c.JSON(410, gin.H{
+				"message": "This link has reached its download limit.",
+			})
+			return
+		}
+		if !fileInfo.IsDir() {
+			giveTicket(c, share)
+		}
+	}
+
+	if !fileInfo.IsDir() {
+		storage.Serve(c, path, fileInfo.Name())
+		return
+	}
+
+	c.Header("Content-Type", archiver.ContentType(archiver.Zip))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileInfo.Name() + "." + archiver.Zip}))
+	c.Status(200)
+
+	// Headers are already sent, an error can only interrupt the stream
+	err = archiver.WriteZip(c.Writer, filepath.Dir(path), []string{path})
+	if err != nil {
+		log.Println("Share download interrupted:", err)
+	}
+}
+
+// Upload receives a file dropped by a visitor through an upload link, the owner of the link is notified.
+// A dropped file never replaces an existing one, it is renamed instead.
+func Upload(c *gin.Context) {
+	share, ok := getPublicShare(c)
+	if !ok || !checkKey(c, share) {
+		return
+	}
+	if share.Kind != models.ShareUpload {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: this link does not accept uploads.",
+		})
+		return
+	}
+
+	// The body is limited before it is parsed, the visitors can not fill the disk with the spooled form
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, uploadLimit(share))
+	file, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(413, gin.H{
+			"message": "File is too large.",
+		})
+		return
+	} else if err != nil {
+		c.JSON(400, gin.H{"Incorrect input data": err.Error()})
+		return
+	}
+	var name string = filepath.Base(file.Filename)
+	if name == "." || name == string(filepath.Separator) || storage.IsHidden(name) {
+		c.JSON(400, gin.H{
+			"message": "File name not valid.",
+		})
+		return
+	}
+	if share.MaxSize != nil && file.Size > *share.MaxSize {
+		c.JSON(413, gin.H{
+			"message": "File is too large.",
+		})
+		return
+	}
+	if !allowedType(share, name) {
+		c.JSON(415, gin.H{
+			"message": "File type not allowed: " + share.AllowedTypes,
+		})
+		return
+	}
+
+	folder, ok := resolveInShare(c, share, "")
+	if !ok {
+		return
+	}
+	folderInfo, err := os.Stat(folder)
+	if err != nil || !folderInfo.IsDir() {
+		c.JSON(404, gin.H{
+			"message": "Target folder not found.",
+		})
+		return
+	}
+
+	// The dropped files count in the owner's quota
+	err = quota.Reserve(share.UserID, file.Size)
+	if err == quota.ErrExceeded {
+		c.JSON(507, gin.H{
+			"message": "Insufficient storage.",
+		})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"Could not check quota": err.Error()})
+		return
+	}
+
+	var target string = fileops.FreeName(filepath.Join(folder, name))
+	err = desktop.SaveFile(share.UserID, file, target)
+	if err != nil {
+		quota.Release(share.UserID, file.Size)
+		c.JSON(500, gin.H{"Could not write file": err.Error()})
+		return
+	}
+	quota.Commit(share.UserID, file.Size)
+
+	relative, _ := storage.Relative(share.UserID, target)
+	_, err = models.CreateNotification(models.Notification{
+		UserID:  share.UserID,
+		Type:    models.NotificationDrop,
+		Message: filepath.Base(target) + " was dropped in " + share.Path,
+		Path:    relative,
+	})
+	if err != nil {
+		log.Println("Could not notify drop:", err)
+	}
+
+	c.JSON(201, gin.H{"file": filepath.Base(target)})
+	return
+}
+
+// This function fetches the share of the token route parameter, expired or exhausted shares are gone.
+func getPublicShare(c *gin.Context) (models.Share, bool) {
+	share, err := models.GetShareByToken(c.Param("token"))
+	if err == sql.ErrNoRows {
+		c.JSON(404, gin.H{
+			"message": "Share not found.",
+		})
+		return share, false
+	} else if err != nil {
+		c.JSON(500, gin.H{"Could not get share": err.Error()})
+		return share, false
+	}
+
+	if share.ExpiresOn != nil && share.ExpiresOn.Before(time.Now()) {
+		c.JSON(410, gin.H{
+			"message": "This link has expired.",
+		})
+		return share, false
+	}
+	if share.Kind == models.ShareDownload && share.MaxDownloads != nil && share.Downloads >= *share.MaxDownloads && !isContinuation(c, share) {
+		c.JSON(410, gin.H{
+			"message": "This link has reached its download limit.",
+		})
+		return share, false
+	}
+	return share, true
+}
+
+// The key of a password protected share is sent in the Share-Key header, or the key query parameter for direct links.
+func checkKey(c *gin.Context, share models.Share) bool {
+	if share.Password == nil {
+		return true
+	}
+
+	var key string = c.GetHeader("Share-Key")
+	if len(key) <= 0 {
+		key = c.Query("key")
+	}
+	if !hmac.Equal([]byte(key), []byte(accessKey(share))) {
+		c.JSON(401, gin.H{
+			"message": "Password required.",
+		})
+		return false
+	}
+	return true
+}
+
+// The access key is derived from the password hash, it stops working when the share is deleted or its password changes
+func accessKey(share models.Share) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("SECRET_KEY")))
+	mac.Write([]byte(share.Token + ":" + *share.Password))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// This function resolves a path inside a shared folder, the visitor can never go above it.
+func resolveInShare(c *gin.Context, share models.Share, clientPath string) (string, bool) {
+	root, err := storage.Resolve(share.UserID, share.Path)
+	if err == nil && !share.IsDir && len(clientPath) > 0 && clientPath != "/" {
+		err = storage.ErrOutsideHome
+	}
+	if err == nil && share.IsDir {
+		root, err = storage.Jail(root, clientPath)
+	}
+
+	if err == storage.ErrOutsideHome {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: path is outside of the share.",
+		})
+		return "", false
+	} else if err != nil {
+		c.JSON(404, gin.H{
+			"message": "Path not found.",
+		})
+		return "", false
+	}
+	return root, true
+}
+
+// A counted file download gives the visitor a ticket, the range requests continuing it are not counted again for a day
+const ticketDuration = 24 * time.Hour
+
+// The ticket is a cookie, sent again by the players and download managers with their range requests
+func giveTicket(c *gin.Context, share models.Share) {
+	var expires int64 = time.Now().Add(ticketDuration).Unix()
+	var value string = strconv.FormatInt(expires, 10) + "." + ticket(share, c.Query("path"), expires)
+	c.SetCookie("share_"+share.Token, value, int(ticketDuration.Seconds()), "/", "", false, true)
+}
+
+// The ticket is bound to the share, the downloaded path and its expiry
+func ticket(share models.Share, clientPath string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("SECRET_KEY")))
+	mac.Write([]byte("download:" + share.Token + ":" + clientPath + ":" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// A single range not starting at the beginning of the file continues a download, if the visitor has a valid ticket for it
+func isContinuation(c *gin.Context, share models.Share) bool {
+	var ranges string = c.GetHeader("Range")
+	if !strings.HasPrefix(ranges, "bytes=") || strings.Contains(ranges, ",") {
+		return false
+	}
+	start, err := strconv.ParseInt(strings.SplitN(strings.TrimPrefix(ranges, "bytes="), "-", 2)[0], 10, 64)
+	if err != nil || start <= 0 {
+		return false
+	}
+
+	cookie, err := c.Cookie("share_" + share.Token)
+	if err != nil {
+		return false
+	}
+	parts := strings.SplitN(cookie, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(parts[1]), []byte(ticket(share, c.Query("path"), expires)))
+}
+
+// The multipart encoding adds the boundary and the headers of the part to the file
+const formOverhead = 1 << 20
+
+// The drops are limited by the maximum size of the link, or by UPLOAD_MAX_SIZE and 10GB when it is not set
+func uploadLimit(share models.Share) int64 {
+	if share.MaxSize != nil {
+		return *share.MaxSize + formOverhead
+	}
+	maxSize, err := strconv.ParseInt(os.Getenv("UPLOAD_MAX_SIZE"), 10, 64)
+	if err != nil || maxSize <= 0 {
+		maxSize = 10 << 30
+	}
+	return maxSize + formOverhead
+}
+
+// Allowed types are stored as a comma separated list of lower case extensions, like ".pdf,.docx"
+func normalizeTypes(types []string) string {
+	var extensions []string
+	for _, extension := range types {
+		extension = strings.ToLower(strings.TrimSpace(extension))
+		if len(extension) <= 0 {
+			continue
+		}
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		extensions = append(extensions, extension)
+	}
+	return strings.Join(extensions, ",")
+}
+
+func allowedType(share models.Share, name string) bool {
+	if len(share.AllowedTypes) <= 0 {
+		return true
+	}
+
+	var lower string = strings.ToLower(name)
+	for _, extension := range strings.Split(share.AllowedTypes, ",") {
+		if strings.HasSuffix(lower, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
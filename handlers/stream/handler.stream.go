@@ -0,0 +1,154 @@
+package stream
+
+import (
+	"io"
+	"log"
+	"path"
+	"path/filepath"
+	"rakoon/rakoon-back/events"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/storage"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A comment is sent this often, so that the proxies keep an idle stream open
+const keepAlive = 30 * time.Second
+
+// The folders shared with a connected user are listed again this often
+const sharedRefresh = 30 * time.Second
+
+// Events pushes the events the connected user is allowed to see with Server-Sent Events: the files created, modified, deleted
+// or moved in their space and in the folders shared with them, their finished uploads, the progress of their jobs and their
+// logout, after which the stream ends.
+func Events(c *gin.Context) {
+	viewer, err := newViewer(storage.UserID(c))
+	if err != nil {
+		c.JSON(500, gin.H{"Could not open stream": err.Error()})
+		return
+	}
+
+	subscription := events.Subscribe()
+	defer subscription.Close()
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(200)
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ticker.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case event, ok := <-subscription.C:
+			if !ok {
+				return false
+			}
+			liveEvent, visible := viewer.see(event)
+			if visible {
+				c.SSEvent(liveEvent.Type, liveEvent)
+			}
+			return !visible || liveEvent.Type != events.LoggedOut
+		}
+	})
+	return
+}
+
+// viewer decides which events a user sees, and at which paths
+type viewer struct {
+	userID   int
+	home     string
+	shared   []sharedRoot
+	sharedOn time.Time
+}
+
+type sharedRoot struct {
+	root       string
+	clientPath string
+}
+
+func newViewer(userID int) (*viewer, error) {
+	home, err := storage.HomeDir(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &viewer{userID: userID, home: home}, nil
+}
+
+func (v *viewer) see(event events.Event) (models.LiveEvent, bool) {
+	var liveEvent models.LiveEvent = models.LiveEvent{Type: event.Type, Data: event.Data, Time: event.Time}
+
+	// The events about a user are only sent to them
+	if !event.IsFileEvent() {
+		if len(event.Path) > 0 {
+			liveEvent.Path, _ = v.clientPath(event.Path)
+		}
+		return liveEvent, event.UserID == v.userID
+	}
+
+	var visible bool
+	liveEvent.Path, visible = v.clientPath(event.Path)
+	if event.Type != events.Moved {
+		return liveEvent, visible
+	}
+
+	// An item moved in or out of what the user can see appears or disappears
+	oldPath, oldVisible := v.clientPath(event.OldPath)
+	if visible && oldVisible {
+		liveEvent.OldPath = oldPath
+	} else if visible {
+		liveEvent.Type = events.Created
+	} else if oldVisible {
+		liveEvent.Type = events.Deleted
+		liveEvent.Path = oldPath
+	}
+	return liveEvent, visible || oldVisible
+}
+
+// This function returns the path the user sees an absolute path at, in their home or in a folder shared with them
+func (v *viewer) clientPath(absolute string) (string, bool) {
+	if storage.Contains(v.home, absolute) {
+		// A real folder named like the virtual shared folder is hidden
+		if storage.Contains(filepath.Join(v.home, filepath.FromSlash(storage.SharedDir)), absolute) {
+			return "", false
+		}
+		rel, err := filepath.Rel(v.home, absolute)
+		return path.Join("/", filepath.ToSlash(rel)), err == nil
+	}
+
+	if time.Since(v.sharedOn) >= sharedRefresh {
+		v.loadShared()
+	}
+	for _, shared := range v.shared {
+		if storage.Contains(shared.root, absolute) {
+			rel, err := filepath.Rel(shared.root, absolute)
+			return path.Join(shared.clientPath, filepath.ToSlash(rel)), err == nil
+		}
+	}
+	return "", false
+}
+
+func (v *viewer) loadShared() {
+	v.sharedOn = time.Now()
+	folders, err := storage.Shared(v.userID)
+	if err != nil {
+		log.Println("Could not list shared folders: " + err.Error())
+		return
+	}
+
+	v.shared = nil
+	for _, folder := range folders {
+		root, err := storage.Resolve(folder.Grant.OwnerID, folder.Grant.Path)
+		if err != nil {
+			continue
+		}
+		v.shared = append(v.shared, sharedRoot{root: root, clientPath: path.Join(storage.SharedDir, folder.Name)})
+	}
+}
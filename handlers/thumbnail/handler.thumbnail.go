@@ -0,0 +1,91 @@
+package thumbnail
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"rakoon/rakoon-back/storage"
+	"rakoon/rakoon-back/thumbnails"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Get sends the thumbnail of an image, fitting in a square of the requested size (128, 256, 512 or 1024 pixels), as JPEG
+// or WebP. A placeholder is sent for the files which are not supported images, with the X-Thumbnail-Placeholder header.
+func Get(c *gin.Context) {
+	size, err := thumbnails.ParseSize(c.Query("size"))
+	if err != nil {
+		c.JSON(400, gin.H{"Incorrect size": err.Error()})
+		return
+	}
+	format, err := thumbnails.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(400, gin.H{"Incorrect format": err.Error()})
+		return
+	}
+
+	location, ok := storage.LocateContext(c, c.Query("path"), false)
+	if !ok {
+		return
+	}
+
+	source, err := os.Stat(location.Path)
+	if os.IsNotExist(err) {
+		c.JSON(404, gin.H{
+			"message": "File not found.",
+		})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"Could not open file": err.Error()})
+		return
+	}
+	if source.IsDir() {
+		c.JSON(400, gin.H{
+			"message": "Path is a directory.",
+		})
+		return
+	}
+
+	// The thumbnail changes with its source, it is revalidated with the source's date and size
+	var etag string = fmt.Sprintf("\"%x-%x-%d-%s\"", source.ModTime().UnixNano(), source.Size(), size, format)
+
+	cached, err := thumbnails.Get(location.OwnerID, location.Path, size, format)
+	if err == thumbnails.ErrUnsupported {
+		placeholder, err := thumbnails.Placeholder(size, format)
+		if err != nil {
+			c.JSON(500, gin.H{"Could not generate thumbnail": err.Error()})
+			return
+		}
+		imageHeaders(c, etag, format)
+		c.Header("X-Thumbnail-Placeholder", "true")
+		http.ServeContent(c.Writer, c.Request, "", time.Time{}, bytes.NewReader(placeholder))
+		return
+	} else if os.IsPermission(err) {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: file can not be read.",
+		})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"Could not generate thumbnail": err.Error()})
+		return
+	}
+
+	file, err := os.Open(cached)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not open thumbnail": err.Error()})
+		return
+	}
+	defer file.Close()
+	imageHeaders(c, etag, format)
+	http.ServeContent(c.Writer, c.Request, "", source.ModTime(), file)
+	return
+}
+
+// The headers of an image are only sent with one, the errors must not be cached nor read as images
+func imageHeaders(c *gin.Context, etag string, format string) {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+	c.Header("Content-Type", thumbnails.ContentType(format))
+}
@@ -0,0 +1,73 @@
+package timeline
+
+import (
+	"os"
+	"rakoon/rakoon-back/photos"
+	"rakoon/rakoon-back/storage"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The number of photos sent by default, and at most
+const defaultLimit = 100
+const maxLimit = 1000
+
+// Get lists the photos of the user's space and of the folders shared with them, or the ones under path, the most recent first.
+// They are grouped by day, month or year (group parameter), and paginated with offset and limit. The total number of photos
+// is sent in the X-Total-Count header.
+func Get(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit <= 0 || limit > maxLimit {
+		c.JSON(400, gin.H{
+			"message": "Limit must be between 1 and " + strconv.Itoa(maxLimit),
+		})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(400, gin.H{
+			"message": "Offset not valid",
+		})
+		return
+	}
+
+	groups, total, err := photos.Timeline(storage.UserID(c), c.DefaultQuery("path", "/"), c.DefaultQuery("group", photos.GroupDay), limit, offset)
+	if err == photos.ErrUnknownGroup {
+		c.JSON(400, gin.H{
+			"message": "Group must be day, month or year",
+		})
+		return
+	} else if err == storage.ErrOutsideHome {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: path is outside of your space.",
+		})
+		return
+	} else if os.IsNotExist(err) {
+		c.JSON(404, gin.H{
+			"message": "Path not found.",
+		})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"Could not list photos": err.Error()})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.JSON(200, groups)
+	return
+}
+
+// Index reads the metadata of the user's images in the background, for the ones stored before the timeline existed
+func Index(c *gin.Context) {
+	err := photos.Reindex(storage.UserID(c))
+	if err != nil {
+		c.JSON(500, gin.H{"Could not index photos": err.Error()})
+		return
+	}
+
+	c.JSON(202, gin.H{
+		"message": "Indexing started",
+	})
+	return
+}
@@ -1,35 +1,426 @@
 package torrent
 
 import (
-	"fmt"
+	"context"
 	"io"
 	"os"
+	"path"
+	"path/filepath"
+	"rakoon/rakoon-back/events"
+	"rakoon/rakoon-back/jobs"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/quota"
+	"rakoon/rakoon-back/storage"
+	"rakoon/rakoon-back/torrents"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Download uploads a file
+// The .torrent files are read in memory, they are never this large
+const maxTorrentFileSize = 10 << 20
+
+// Download starts downloading a torrent in a folder, from its uploaded .torrent file or a magnet link.
+// With select=true, the job waits for the files to download to be selected once the content of the torrent is known.
 func Download(c *gin.Context) {
-	var rootPath = os.Getenv("ROOT_PATH")
-	var path string = rootPath + c.PostFormArray("path")[0]
+	var pathParam string = c.PostForm("path")
+	var magnet string = c.PostForm("magnet")
+	var selectFiles bool = c.PostForm("select") == "true"
+
+	var data []byte
+	if len(magnet) <= 0 {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(400, gin.H{"Incorrect input data": err.Error()})
+			return
+		}
+		if file.Size > maxTorrentFileSize {
+			c.JSON(400, gin.H{
+				"message": "Torrent file too large.",
+			})
+			return
+		}
+		src, err := file.Open()
+		if err != nil {
+			c.JSON(500, gin.H{"Could not read torrent file": err.Error()})
+			return
+		}
+		defer src.Close()
+		data, err = io.ReadAll(src)
+		if err != nil {
+			c.JSON(500, gin.H{"Could not read torrent file": err.Error()})
+			return
+		}
+		_, err = torrents.Parse(data)
+		if err != nil {
+			c.JSON(400, gin.H{"Torrent not valid": err.Error()})
+			return
+		}
+	}
+
+	target, ok := storage.LocateContext(c, pathParam, true)
+	if !ok {
+		return
+	}
+	fileInfo, err := os.Stat(target.Path)
+	if os.IsNotExist(err) {
+		c.JSON(404, gin.H{
+			"message": "Path not found.",
+		})
+		return
+	} else if err != nil || !fileInfo.IsDir() {
+		c.JSON(400, gin.H{
+			"message": "Path is not a folder.",
+		})
+		return
+	}
+
+	var job models.TorrentJob
+	if len(magnet) > 0 {
+		job, err = torrents.AddMagnet(storage.UserID(c), target, pathParam, magnet, selectFiles)
+	} else {
+		job, err = torrents.Add(storage.UserID(c), target, pathParam, data, selectFiles)
+	}
+	if !checkError(c, err) {
+		return
+	}
+
+	c.JSON(201, job)
+	return
+}
 
-	file, err := c.FormFile("file")
-	src, err := file.Open()
+// MetaInfo describes a .torrent file of the user: its name, info hash, size, pieces, trackers and file tree
+func MetaInfo(c *gin.Context) {
+	location, ok := storage.LocateContext(c, c.Query("path"), false)
+	if !ok {
+		return
+	}
+
+	fileInfo, err := os.Stat(location.Path)
+	if os.IsNotExist(err) {
+		c.JSON(404, gin.H{
+			"message": "File not found.",
+		})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"Could not open file": err.Error()})
+		return
+	}
+	if fileInfo.IsDir() {
+		c.JSON(400, gin.H{
+			"message": "Path is a directory.",
+		})
+		return
+	}
+	if fileInfo.Size() > maxTorrentFileSize {
+		c.JSON(400, gin.H{
+			"message": "Torrent file too large.",
+		})
+		return
+	}
+
+	data, err := os.ReadFile(location.Path)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not read torrent file": err.Error()})
+		return
+	}
+	info, err := torrents.Parse(data)
 	if err != nil {
-		c.JSON(401, err.Error())
+		c.JSON(400, gin.H{"Torrent not valid": err.Error()})
 		return
 	}
-	defer src.Close()
 
-	target := fmt.Sprintf("%s/%s", path, file.Filename)
-	out, err := os.Create(target)
+	c.JSON(200, info)
+	return
+}
+
+// Create builds the .torrent file of a file or a folder of the user, and writes it next to it with the .torrent extension.
+// The content is hashed in a background job. With seed=true, the engine then shares it with the peers.
+func Create(c *gin.Context) {
+	var create models.TorrentCreate
+	err := c.ShouldBindJSON(&create)
+	if err != nil {
+		c.JSON(400, gin.H{"Incorrect input data": err.Error()})
+		return
+	}
+	err = torrents.CheckCreate(create)
 	if err != nil {
-		c.JSON(402, err.Error())
+		c.JSON(400, gin.H{"Incorrect input data": err.Error()})
+		return
+	}
+
+	location, ok := storage.LocateContext(c, create.Path, true)
+	if !ok {
+		return
+	}
+	// The .torrent file is written in the folder of its content
+	if location.Path == location.Root {
+		c.JSON(400, gin.H{
+			"message": "Path not valid.",
+		})
+		return
+	}
+	_, err = os.Stat(location.Path)
+	if os.IsNotExist(err) {
+		c.JSON(404, gin.H{
+			"message": "Path not found.",
+		})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"Could not open file": err.Error()})
+		return
+	}
+	var target string = location.Path + ".torrent"
+	if _, err := os.Lstat(target); err == nil {
+		c.JSON(409, gin.H{
+			"message": "A file with the torrent's name already exists.",
+		})
+		return
+	}
+	if create.Seed && torrents.Port() == 0 {
+		c.JSON(503, gin.H{
+			"message": "Torrent engine is not running.",
+		})
 		return
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, src)
-	c.JSON(201, "File(s) uploaded.")
+	var userID int = storage.UserID(c)
+	var folder storage.Location = location
+	folder.Path = filepath.Dir(location.Path)
+	var folderPath string = path.Dir(path.Clean("/" + create.Path))
+	job, err := jobs.Start(userID, "torrent", func(ctx context.Context, tracker jobs.Tracker) error {
+		data, err := torrents.Create(ctx, location.Path, create, tracker.Progress)
+		if err != nil {
+			return err
+		}
+
+		// The .torrent file counts in the quota of the folder's owner
+		err = quota.Reserve(folder.OwnerID, int64(len(data)))
+		if err != nil {
+			return err
+		}
+		file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			quota.Release(folder.OwnerID, int64(len(data)))
+			return err
+		}
+		_, err = file.Write(data)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(target)
+			quota.Release(folder.OwnerID, int64(len(data)))
+			return err
+		}
+		quota.Commit(folder.OwnerID, int64(len(data)))
+		events.Publish(events.Event{Type: events.Created, UserID: folder.OwnerID, Path: target})
+
+		if create.Seed {
+			_, err = torrents.Seed(userID, folder, folderPath, data)
+		}
+		return err
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"Could not start torrent creation": err.Error()})
+		return
+	}
+
+	c.JSON(202, job)
 	return
 }
+
+// List returns the torrent jobs of the user, the most recent first, with their progress and the statistics of their transfer.
+// The jobs of every user are listed with all=true, for the users with the manage_torrents permission.
+func List(c *gin.Context) {
+	var jobs []models.TorrentJob
+	var err error
+	if c.Query("all") == "true" {
+		if !canManage(c) {
+			c.JSON(403, gin.H{
+				"message": "The " + models.PermissionManageTorrents + " permission is required to list every torrent.",
+			})
+			return
+		}
+		jobs, err = models.GetAllTorrentJobs()
+	} else {
+		jobs, err = models.GetTorrentJobs(storage.UserID(c))
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"Could not list torrents": err.Error()})
+		return
+	}
+
+	c.JSON(200, torrents.Stats(jobs))
+	return
+}
+
+// Get returns a torrent job of the user, with its progress
+func Get(c *gin.Context) {
+	job, ok := getJob(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, torrents.Stats([]models.TorrentJob{job})[0])
+	return
+}
+
+// Pause takes a torrent job out of the engine until it is resumed
+func Pause(c *gin.Context) {
+	control(c, torrents.Pause)
+}
+
+// Resume puts a paused torrent job back in the engine
+func Resume(c *gin.Context) {
+	control(c, torrents.Resume)
+}
+
+// Cancel stops a torrent job for good, keeping the data downloaded
+func Cancel(c *gin.Context) {
+	control(c, torrents.Cancel)
+}
+
+// Remove forgets a torrent job, and moves the data it downloaded to the trash with data=true
+func Remove(c *gin.Context) {
+	job, ok := getJob(c)
+	if !ok {
+		return
+	}
+
+	err := torrents.Remove(c.Request.Context(), job, c.Query("data") == "true")
+	if !checkError(c, err) {
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Torrent removed.",
+	})
+	return
+}
+
+// Files lists the files of a torrent job, once the content of the torrent is known
+func Files(c *gin.Context) {
+	job, ok := getJob(c)
+	if !ok {
+		return
+	}
+
+	files, err := torrents.Files(job)
+	if !checkError(c, err) {
+		return
+	}
+
+	c.JSON(200, files)
+	return
+}
+
+// Select starts the transfer of the files selected in a torrent job waiting for a selection
+func Select(c *gin.Context) {
+	var selection models.TorrentSelection
+	err := c.ShouldBindJSON(&selection)
+	if err != nil {
+		c.JSON(400, gin.H{"Incorrect input data": err.Error()})
+		return
+	}
+
+	job, ok := getJob(c)
+	if !ok {
+		return
+	}
+
+	job, err = torrents.Select(job, selection.Files)
+	if !checkError(c, err) {
+		return
+	}
+
+	c.JSON(200, job)
+	return
+}
+
+// This function applies an operation to the job of the request, and sends its new state
+func control(c *gin.Context, operation func(models.TorrentJob) (models.TorrentJob, error)) {
+	job, ok := getJob(c)
+	if !ok {
+		return
+	}
+
+	job, err := operation(job)
+	if !checkError(c, err) {
+		return
+	}
+
+	c.JSON(200, job)
+	return
+}
+
+func getJob(c *gin.Context) (models.TorrentJob, bool) {
+	ID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "Id not valid",
+		})
+		return models.TorrentJob{}, false
+	}
+
+	// The users with the manage_torrents permission control the jobs of every user
+	job, err := models.GetTorrentJob(ID)
+	if err != nil || (job.UserID != storage.UserID(c) && !canManage(c)) {
+		c.JSON(404, gin.H{
+			"message": "Torrent not found.",
+		})
+		return job, false
+	}
+	return job, true
+}
+
+func canManage(c *gin.Context) bool {
+	allowed, err := models.HasPermission(storage.UserID(c), models.PermissionManageTorrents)
+	return err == nil && allowed
+}
+
+// This function sends the error of a torrent operation, and returns false if there was one
+func checkError(c *gin.Context, err error) bool {
+	if err == nil {
+		return true
+	} else if err == torrents.ErrInvalid {
+		c.JSON(400, gin.H{
+			"message": "Torrent not valid.",
+		})
+	} else if err == torrents.ErrUnknownFile {
+		c.JSON(400, gin.H{
+			"message": "File not found in the torrent.",
+		})
+	} else if err == torrents.ErrDuplicate {
+		c.JSON(409, gin.H{
+			"message": "Torrent already downloading.",
+		})
+	} else if os.IsExist(err) {
+		c.JSON(409, gin.H{
+			"message": "A file with the torrent's name already exists.",
+		})
+	} else if err == torrents.ErrNoMetaInfo {
+		c.JSON(409, gin.H{
+			"message": "Torrent metadata not received yet.",
+		})
+	} else if err == torrents.ErrNotWaiting {
+		c.JSON(409, gin.H{
+			"message": "Torrent is not waiting for a selection.",
+		})
+	} else if err == torrents.ErrState {
+		c.JSON(409, gin.H{
+			"message": "Operation not possible in the torrent's state.",
+		})
+	} else if err == quota.ErrExceeded {
+		c.JSON(507, gin.H{
+			"message": "Insufficient storage: this would exceed your quota.",
+		})
+	} else if err == torrents.ErrNotRunning {
+		c.JSON(503, gin.H{
+			"message": "Torrent engine is not running.",
+		})
+	} else {
+		c.JSON(500, gin.H{"Torrent operation failed": err.Error()})
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package trash
+
+import (
+	"rakoon/rakoon-back/events"
+	"rakoon/rakoon-back/fileops"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/recyclebin"
+	"rakoon/rakoon-back/storage"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// List returns the content of the connected user's trash
+func List(c *gin.Context) {
+	items, err := models.GetTrashList(storage.UserID(c))
+	if err != nil {
+		c.JSON(500, gin.H{"Could not list trash": err.Error()})
+		return
+	}
+
+	c.JSON(200, items)
+	return
+}
+
+// Restore moves a trashed item back to its original path.
+// If another item took its place, a 409 is returned unless a conflict policy is given.
+func Restore(c *gin.Context) {
+	var restore models.TrashRestore
+	if c.Request.ContentLength > 0 {
+		err := c.BindJSON(&restore)
+		if err != nil {
+			c.JSON(400, gin.H{"Incorrect input data": err.Error()})
+			return
+		}
+	}
+	if restore.Conflict != "" && !fileops.ValidPolicy(restore.Conflict) {
+		c.JSON(400, gin.H{
+			"message": fileops.ErrUnknownPolicy.Error(),
+		})
+		return
+	}
+
+	item, ok := getItem(c)
+	if !ok {
+		return
+	}
+
+	report, err := recyclebin.Restore(c.Request.Context(), item, restore.Conflict)
+	if len(report.Target) > 0 {
+		events.Publish(events.Event{Type: events.Created, UserID: item.UserID, Path: report.Target})
+	}
+	if err == recyclebin.ErrConflict {
+		c.JSON(409, gin.H{
+			"message": "Conflict: an item already exists at " + item.OriginalPath,
+		})
+		return
+	} else if err == storage.ErrOutsideHome {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: path is outside of your space.",
+		})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"Could not restore item": err.Error()})
+		return
+	}
+
+	report.Target, _ = storage.Relative(item.UserID, report.Target)
+	if report.Failed() {
+		c.JSON(207, report)
+		return
+	}
+
+	c.JSON(200, report)
+	return
+}
+
+// Delete permanently deletes a trashed item
+func Delete(c *gin.Context) {
+	item, ok := getItem(c)
+	if !ok {
+		return
+	}
+
+	err := recyclebin.Remove(c.Request.Context(), item)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not delete item": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Item deleted",
+	})
+	return
+}
+
+// Empty permanently deletes the content of the connected user's trash
+func Empty(c *gin.Context) {
+	err := recyclebin.Empty(c.Request.Context(), storage.UserID(c))
+	if err != nil {
+		c.JSON(500, gin.H{"Could not empty trash": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Trash emptied",
+	})
+	return
+}
+
+// This function fetches the trash item of the route parameters, a user can only access his own trash.
+func getItem(c *gin.Context) (models.TrashItem, bool) {
+	ID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "Id not valid",
+		})
+		return models.TrashItem{}, false
+	}
+
+	item, err := models.GetTrashItem(ID)
+	if err != nil || item.UserID != storage.UserID(c) {
+		c.JSON(404, gin.H{
+			"message": "Item not found.",
+		})
+		return item, false
+	}
+	return item, true
+}
@@ -0,0 +1,533 @@
+package upload
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/events"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/quota"
+	"rakoon/rakoon-back/storage"
+	"rakoon/rakoon-back/versions"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Resumable uploads implement the tus 1.0.0 protocol with the creation and termination extensions.
+// See https://tus.io/protocols/resumable-upload.html
+const tusVersion = "1.0.0"
+const tusExtensions = "creation,termination"
+
+// The staging directory of the partial uploads, under ROOT_PATH
+const stagingName = "uploads"
+
+var errUploadNotFound = errors.New("upload not found")
+
+// The reservations of the quota are kept in memory, the uploads created before a restart have none
+var started time.Time = time.Now()
+
+// An upload can only be patched by one request at a time
+var locksMutex sync.Mutex
+var locks = map[string]*sync.Mutex{}
+
+// Options describes the server's tus configuration
+func Options(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	if maxSize := maxUploadSize(); maxSize > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(maxSize, 10))
+	}
+	c.Status(204)
+}
+
+// Create registers a new upload. The target folder and the file name are sent base64 encoded in the Upload-Metadata header, as "path" and "filename".
+func Create(c *gin.Context) {
+	if !checkVersion(c) {
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(400, gin.H{
+			"message": "Upload-Length header is missing or invalid.",
+		})
+		return
+	}
+	if maxSize := maxUploadSize(); maxSize > 0 && length > maxSize {
+		c.JSON(413, gin.H{
+			"message": "Upload is too large.",
+		})
+		return
+	}
+
+	metadata, err := parseMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(400, gin.H{"Incorrect Upload-Metadata header": err.Error()})
+		return
+	}
+	var fileName string = filepath.Base(metadata["filename"])
+	if fileName == "." || fileName == string(filepath.Separator) {
+		c.JSON(400, gin.H{
+			"message": "No file name specified.",
+		})
+		return
+	}
+
+	// The target folder must exist when the upload is created
+	folder, ok := storage.LocateContext(c, metadata["path"], true)
+	if !ok {
+		return
+	}
+	folderInfo, err := os.Stat(folder.Path)
+	if err != nil || !folderInfo.IsDir() {
+		c.JSON(404, gin.H{
+			"message": "Target folder not found.",
+		})
+		return
+	}
+
+	// The whole upload is accounted in the quota as soon as it is created
+	if !quota.ReserveContext(c, folder.OwnerID, length) {
+		return
+	}
+
+	id, err := generateID()
+	if err != nil {
+		quota.Release(folder.OwnerID, length)
+		c.JSON(500, gin.H{"Could not create upload": err.Error()})
+		return
+	}
+
+	var upload models.Upload = models.Upload{
+		ID:        id,
+		UserID:    storage.UserID(c),
+		OwnerID:   folder.OwnerID,
+		Length:    length,
+		Offset:    0,
+		FileName:  fileName,
+		Path:      metadata["path"],
+		CreatedOn: time.Now(),
+	}
+
+	staging, err := storage.StagingDir(stagingName)
+	if err != nil {
+		quota.Release(upload.OwnerID, length)
+		c.JSON(500, gin.H{"Could not create upload": err.Error()})
+		return
+	}
+	data, err := os.OpenFile(filepath.Join(staging, id+".bin"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		quota.Release(upload.OwnerID, length)
+		c.JSON(500, gin.H{"Could not create upload": err.Error()})
+		return
+	}
+	data.Close()
+
+	err = saveUpload(upload)
+	if err != nil {
+		quota.Release(upload.OwnerID, length)
+		c.JSON(500, gin.H{"Could not create upload": err.Error()})
+		return
+	}
+
+	// Empty files are complete as soon as they are created
+	if length == 0 {
+		err = finishUpload(upload)
+		if err != nil {
+			c.JSON(500, gin.H{"Could not move uploaded file": err.Error()})
+			return
+		}
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Location", "/v1/upload/"+id)
+	c.Status(201)
+}
+
+// Head returns the current offset of an upload
+func Head(c *gin.Context) {
+	if !checkVersion(c) {
+		return
+	}
+
+	upload, ok := getUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Status(200)
+}
+
+// Patch appends a chunk to an upload. Once complete, the file is moved into its target folder.
+func Patch(c *gin.Context) {
+	if !checkVersion(c) {
+		return
+	}
+
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(415, gin.H{
+			"message": "Content-Type must be application/offset+octet-stream.",
+		})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(400, gin.H{
+			"message": "Upload-Offset header is missing or invalid.",
+		})
+		return
+	}
+
+	lock := uploadLock(c.Param("id"))
+	lock.Lock()
+	defer lock.Unlock()
+
+	upload, ok := getUpload(c)
+	if !ok {
+		return
+	}
+
+	if offset != upload.Offset {
+		c.JSON(409, gin.H{
+			"message": "Upload-Offset does not match the current offset.",
+		})
+		return
+	}
+
+	staging, err := storage.StagingDir(stagingName)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not write upload": err.Error()})
+		return
+	}
+	data, err := os.OpenFile(filepath.Join(staging, upload.ID+".bin"), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not write upload": err.Error()})
+		return
+	}
+
+	// The bytes received before a connection loss are kept, the client can resume from there
+	written, copyErr := io.Copy(data, io.LimitReader(c.Request.Body, upload.Length-upload.Offset))
+	data.Close()
+	upload.Offset += written
+	err = saveUpload(upload)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not write upload": err.Error()})
+		return
+	}
+	if copyErr != nil {
+		c.JSON(500, gin.H{"Could not write upload": copyErr.Error()})
+		return
+	}
+
+	if upload.Offset == upload.Length {
+		err = finishUpload(upload)
+		if err != nil {
+			c.JSON(500, gin.H{"Could not move uploaded file": err.Error()})
+			return
+		}
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Status(204)
+}
+
+// Terminate cancels an upload and removes its data
+func Terminate(c *gin.Context) {
+	if !checkVersion(c) {
+		return
+	}
+
+	lock := uploadLock(c.Param("id"))
+	lock.Lock()
+	defer lock.Unlock()
+
+	upload, ok := getUpload(c)
+	if !ok {
+		return
+	}
+
+	err := discardUpload(upload)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not remove upload": err.Error()})
+		return
+	}
+
+	c.Header("Tus-Resumable", tusVersion)
+	c.Status(204)
+}
+
+// StartSweeper removes the uploads left without activity for longer than the expiry, at every interval.
+// Their data is deleted and their reservation in the quota released.
+func StartSweeper(expiry time.Duration, interval time.Duration) {
+	go func() {
+		for {
+			err := sweep(expiry)
+			if err != nil {
+				log.Println("Could not sweep uploads:", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func sweep(expiry time.Duration) error {
+	staging, err := storage.StagingDir(stagingName)
+	if err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(staging)
+	if err != nil {
+		return err
+	}
+
+	// The last activity of an upload is the last write of its data or of its info
+	var activity = map[string]time.Time{}
+	for _, file := range files {
+		var id string = strings.SplitN(file.Name(), ".", 2)[0]
+		if !validID(id) {
+			continue
+		}
+		if file.ModTime().After(activity[id]) {
+			activity[id] = file.ModTime()
+		}
+	}
+
+	for id, lastActivity := range activity {
+		if time.Since(lastActivity) < expiry {
+			continue
+		}
+		lock := uploadLock(id)
+		lock.Lock()
+		upload, err := loadUpload(id)
+		if err == nil {
+			err = discardUpload(upload)
+		} else {
+			// The data of an upload whose creation did not complete
+			os.Remove(filepath.Join(staging, id+".bin"))
+			os.Remove(filepath.Join(staging, id+".info.tmp"))
+			forgetLock(id)
+			err = nil
+		}
+		lock.Unlock()
+		if err != nil {
+			log.Println("Could not remove expired upload", id, ":", err)
+		}
+	}
+	return nil
+}
+
+// This function atomically moves a complete upload into its target folder.
+// The access to a shared folder is checked again, it may have been revoked during the upload.
+// An upload that can not be moved is discarded.
+func finishUpload(upload models.Upload) error {
+	target, err := storage.Locate(upload.UserID, filepath.Join(upload.Path, upload.FileName))
+	if err == nil && !target.Writable() {
+		err = storage.ErrReadOnly
+	}
+	if err != nil {
+		discardUpload(upload)
+		return err
+	}
+
+	staging, err := storage.StagingDir(stagingName)
+	if err != nil {
+		discardUpload(upload)
+		return err
+	}
+
+	// The staging area and the homes are both under ROOT_PATH, the rename is atomic.
+	// An existing file is kept as a version.
+	err = versions.Replace(target.OwnerID, filepath.Join(staging, upload.ID+".bin"), target.Path)
+	if err != nil {
+		discardUpload(upload)
+		return err
+	}
+
+	// The reservations of the uploads created before a restart were lost with it
+	if upload.CreatedOn.After(started) {
+		quota.Commit(upload.OwnerID, upload.Length)
+	} else {
+		quota.Add(upload.OwnerID, upload.Length)
+	}
+	forgetLock(upload.ID)
+	events.Publish(events.Event{Type: events.UploadFinished, UserID: upload.UserID, Path: target.Path, Data: gin.H{"id": upload.ID}})
+	return os.Remove(filepath.Join(staging, upload.ID+".info"))
+}
+
+// This function fetches the upload of the route parameters, only its owner can access it.
+func getUpload(c *gin.Context) (models.Upload, bool) {
+	upload, err := loadUpload(c.Param("id"))
+	if err == nil && upload.UserID != storage.UserID(c) {
+		err = errUploadNotFound
+	}
+
+	if err != nil {
+		c.Header("Tus-Resumable", tusVersion)
+		c.JSON(404, gin.H{
+			"message": "Upload not found.",
+		})
+		return upload, false
+	}
+	return upload, true
+}
+
+func loadUpload(id string) (models.Upload, error) {
+	var upload models.Upload
+	if !validID(id) {
+		return upload, errUploadNotFound
+	}
+
+	staging, err := storage.StagingDir(stagingName)
+	if err != nil {
+		return upload, err
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(staging, id+".info"))
+	if os.IsNotExist(err) {
+		return upload, errUploadNotFound
+	} else if err != nil {
+		return upload, err
+	}
+
+	err = json.Unmarshal(b, &upload)
+	return upload, err
+}
+
+// The upload info is written to a temporary file then renamed, so that it is never half written
+func saveUpload(upload models.Upload) error {
+	staging, err := storage.StagingDir(stagingName)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+
+	var path string = filepath.Join(staging, upload.ID+".info")
+	err = ioutil.WriteFile(path+".tmp", b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func removeUpload(id string) error {
+	staging, err := storage.StagingDir(stagingName)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filepath.Join(staging, id+".bin"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	forgetLock(id)
+	return os.Remove(filepath.Join(staging, id+".info"))
+}
+
+// This function removes the data of an upload and releases its reservation
+func discardUpload(upload models.Upload) error {
+	err := removeUpload(upload.ID)
+	if err != nil {
+		return err
+	}
+	if upload.CreatedOn.After(started) {
+		quota.Release(upload.OwnerID, upload.Length)
+	}
+	return nil
+}
+
+func uploadLock(id string) *sync.Mutex {
+	locksMutex.Lock()
+	defer locksMutex.Unlock()
+
+	lock, ok := locks[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		locks[id] = lock
+	}
+	return lock
+}
+
+func forgetLock(id string) {
+	locksMutex.Lock()
+	defer locksMutex.Unlock()
+	delete(locks, id)
+}
+
+// This function checks the client speaks the same version of the protocol.
+func checkVersion(c *gin.Context) bool {
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.JSON(412, gin.H{
+			"message": "Unsupported tus version.",
+		})
+		return false
+	}
+	return true
+}
+
+// The metadata header is a comma separated list of keys and base64 encoded values
+func parseMetadata(header string) (map[string]string, error) {
+	var metadata = map[string]string{}
+	if len(header) <= 0 {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		var fields []string = strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, errors.New("malformed key value pair")
+		}
+
+		var value []byte
+		if len(fields) == 2 {
+			var err error
+			value, err = base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		metadata[fields[0]] = string(value)
+	}
+	return metadata, nil
+}
+
+func generateID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func validID(id string) bool {
+	_, err := hex.DecodeString(id)
+	return err == nil && len(id) == 32
+}
+
+func maxUploadSize() int64 {
+	maxSize, _ := strconv.ParseInt(os.Getenv("UPLOAD_MAX_SIZE"), 10, 64)
+	return maxSize
+}
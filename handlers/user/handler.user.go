@@ -3,8 +3,10 @@ package user
 import (
 	"fmt"
 	"net/http"
+	"rakoon/rakoon-back/events"
 	"rakoon/rakoon-back/handlers/authentication"
 	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/quota"
 	"strconv"
 	"time"
 
@@ -141,11 +143,111 @@ func UpdatePassword(c *gin.Context) {
 	return
 }
 
+// UpdateQuota function: set a user's storage quota, in bytes. A null quota means unlimited.
+func UpdateQuota(c *gin.Context) {
+	var update models.UserQuota
+	var err = c.BindJSON(&update)
+
+	if err != nil {
+		c.JSON(400, gin.H{"Incorrect input data": err.Error()})
+		return
+	}
+	if update.Quota != nil && *update.Quota < 0 {
+		c.JSON(400, gin.H{
+			"message": "Quota can not be negative",
+		})
+		return
+	}
+
+	ID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || !authentication.UserIDExists(ID) {
+		c.JSON(404, gin.H{
+			"message": "User does not exist.",
+		})
+		return
+	}
+
+	models.UpdateUserQuota(c.Param("id"), update.Quota)
+
+	c.JSON(200, gin.H{
+		"message": "Quota updated",
+	})
+
+	return
+}
+
+// GetQuota returns a user's storage quota and the number of bytes they use
+func GetQuota(c *gin.Context) {
+	var paramID = c.Param("id")
+	var tokenID = fmt.Sprintf("%v", c.MustGet("id"))
+
+	if !matchIDs(c, paramID, tokenID) {
+		return
+	}
+
+	ID, _ := strconv.Atoi(paramID)
+	limit, err := models.GetUserQuota(ID)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"message": "User does not exist.",
+		})
+		return
+	}
+	used, err := quota.Used(ID)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not compute usage": err.Error()})
+		return
+	}
+
+	var userQuota *int64
+	if limit.Valid {
+		userQuota = &limit.Int64
+	}
+	c.JSON(200, gin.H{
+		"quota": userQuota,
+		"used":  used,
+	})
+
+	return
+}
+
+// GetPermissions returns a user's roles and the permissions they give
+func GetPermissions(c *gin.Context) {
+	var paramID = c.Param("id")
+	var tokenID = fmt.Sprintf("%v", c.MustGet("id"))
+
+	if !matchIDs(c, paramID, tokenID) {
+		return
+	}
+
+	ID, _ := strconv.Atoi(paramID)
+	roles, err := models.GetUserRoles(ID)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not get roles": err.Error()})
+		return
+	}
+	permissions, err := models.GetUserPermissions(ID)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"message": "User does not exist.",
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"roles":       roles,
+		"permissions": permissions,
+	})
+
+	return
+}
+
 // Archive a user (soft delete)
 func Archive(c *gin.Context) {
 	var ID = c.Param("id")
 
 	models.ArchiveUser(ID)
+	forceLogout(ID)
 
 	c.JSON(200, gin.H{
 		"message": "User archived",
@@ -159,6 +261,7 @@ func Delete(c *gin.Context) {
 	var ID = c.Param("id")
 
 	models.DeleteUser(ID)
+	forceLogout(ID)
 
 	c.JSON(200, gin.H{
 		"message": "User removed",
@@ -199,11 +302,10 @@ func Connect(c *gin.Context) {
 	models.RefreshUserConnection(user.Name, false)
 
 	// Generate and return a token
-	jwtToken := authentication.GenerateToken(user.ID, user.IsAdmin)
+	jwtToken := authentication.GenerateToken(user.ID)
 	c.JSON(200, gin.H{
-		"token":   jwtToken,
-		"userId":  user.ID,
-		"isAdmin": user.IsAdmin,
+		"token":  jwtToken,
+		"userId": user.ID,
 	})
 	return
 }
@@ -220,11 +322,20 @@ func LogOut(c *gin.Context) {
 	// Setting reauth var to true to force the user to reconnect
 	ID, _ := strconv.Atoi(paramID)
 	models.SetReauth(ID, true)
+	forceLogout(paramID)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User logged out.",
 	})
 }
 
+// This function disconnects the live event streams of a user
+func forceLogout(ID string) {
+	userID, err := strconv.Atoi(ID)
+	if err == nil {
+		events.Publish(events.Event{Type: events.LoggedOut, UserID: userID})
+	}
+}
+
 // This function checks if the id present in the token (retrieved by the middleware) matches with the id in the route parameters, or in the route body.
 func matchIDs(c *gin.Context, ID string, tokenID string) bool {
 	_, err := strconv.Atoi(ID)
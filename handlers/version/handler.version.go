@@ -0,0 +1,105 @@
+package version
+
+import (
+	"path/filepath"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/quota"
+	"rakoon/rakoon-back/storage"
+	"rakoon/rakoon-back/versions"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// List returns the previous versions of a file, the most recent first
+func List(c *gin.Context) {
+	location, ok := storage.LocateContext(c, c.Query("path"), false)
+	if !ok {
+		return
+	}
+	if location.Grant != nil {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: the versions of a shared file are only available to its owner.",
+		})
+		return
+	}
+	clientPath, err := storage.Relative(storage.UserID(c), location.Path)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not resolve path": err.Error()})
+		return
+	}
+
+	list, err := models.GetFileVersions(storage.UserID(c), clientPath)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not list versions": err.Error()})
+		return
+	}
+
+	c.JSON(200, list)
+	return
+}
+
+// Download streams the content of a version
+func Download(c *gin.Context) {
+	version, ok := getVersion(c)
+	if !ok {
+		return
+	}
+
+	data, err := versions.DataPath(version)
+	if err != nil {
+		c.JSON(500, gin.H{"Could not resolve version": err.Error()})
+		return
+	}
+
+	storage.Serve(c, data, filepath.Base(version.Path))
+}
+
+// Restore replaces a file by one of its versions, the current content is kept as a new version
+func Restore(c *gin.Context) {
+	version, ok := getVersion(c)
+	if !ok {
+		return
+	}
+
+	err := versions.Restore(c.Request.Context(), version)
+	if err == storage.ErrOutsideHome {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: path is outside of your space.",
+		})
+		return
+	} else if err == quota.ErrExceeded {
+		c.JSON(507, gin.H{
+			"message": "Insufficient storage: this would exceed your quota.",
+		})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"Could not restore version": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Version restored",
+	})
+	return
+}
+
+// This function fetches the version of the route parameters, a user can only access the versions of his files.
+func getVersion(c *gin.Context) (models.FileVersion, bool) {
+	ID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "Id not valid",
+		})
+		return models.FileVersion{}, false
+	}
+
+	version, err := models.GetFileVersion(ID)
+	if err != nil || version.UserID != storage.UserID(c) {
+		c.JSON(404, gin.H{
+			"message": "Version not found.",
+		})
+		return version, false
+	}
+	return version, true
+}
@@ -0,0 +1,115 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/storage"
+	"time"
+)
+
+// Catalog describes a catalogue of the metadata of some files, such as the photos or the music tracks.
+// The files are saved with their modification date, the unchanged ones are skipped when a folder is indexed again.
+// The paths given to the callbacks are client paths, as seen by the owner of the files.
+type Catalog struct {
+	// Supported checks if a file belongs in the catalogue from its name
+	Supported func(name string) bool
+	// Dates returns the modification dates the files under a path were saved with
+	Dates func(userID int, under string) (map[string]time.Time, error)
+	// Save reads the metadata of a file and saves it, path being the file on the disk
+	Save func(userID int, clientPath string, path string) error
+	// Delete removes a file, or every file under a folder, from the catalogue
+	Delete func(userID int, under string) error
+	// Move changes the path of a file, or of every file under a folder
+	Move func(userID int, source string, target string) error
+}
+
+// NewCatalog creates an index keeping a catalogue up to date
+func NewCatalog(name string, catalog Catalog) *Index {
+	return New(name, Callbacks{Update: catalog.update, Forget: catalog.forget, Move: catalog.move})
+}
+
+func (catalog Catalog) update(userID int, path string) error {
+	home, err := storage.HomeDir(userID)
+	if err != nil {
+		return err
+	}
+	under, err := storage.Relative(userID, path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return catalog.Delete(userID, under)
+	}
+
+	// The files saved before are compared with the files found, the missing ones were removed
+	known, err := catalog.Dates(userID, under)
+	if err != nil {
+		return err
+	}
+	var hiddenShared string = filepath.Join(home, filepath.FromSlash(storage.SharedDir))
+
+	// Symlinks are not followed, their target may be outside of the home
+	err = filepath.Walk(path, func(path string, fileInfo os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if path == hiddenShared || (path != home && storage.IsHidden(fileInfo.Name())) {
+			if fileInfo.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fileInfo.Mode().IsRegular() || !catalog.Supported(fileInfo.Name()) {
+			return nil
+		}
+
+		clientPath, err := storage.Relative(userID, path)
+		if err != nil {
+			return nil
+		}
+		savedOn, ok := known[clientPath]
+		delete(known, clientPath)
+		if ok && wallClock(savedOn).Equal(wallClock(fileInfo.ModTime().Round(time.Microsecond))) {
+			return nil
+		}
+		return catalog.Save(userID, clientPath, path)
+	})
+	if err != nil {
+		return err
+	}
+
+	for clientPath := range known {
+		err = catalog.Delete(userID, clientPath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (catalog Catalog) forget(userID int, path string) error {
+	clientPath, err := storage.Relative(userID, path)
+	if err != nil {
+		return err
+	}
+	return catalog.Delete(userID, clientPath)
+}
+
+func (catalog Catalog) move(userID int, source string, target string) error {
+	sourcePath, err := storage.Relative(userID, source)
+	if err != nil {
+		return err
+	}
+	targetPath, err := storage.Relative(userID, target)
+	if err != nil {
+		return err
+	}
+	return catalog.Move(userID, sourcePath, targetPath)
+}
+
+// The dates are saved without time zone, they are compared by their digits
+func wallClock(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), time.UTC)
+}
@@ -0,0 +1,107 @@
+package indexer
+
+import (
+	"log"
+	"rakoon/rakoon-back/events"
+	"rakoon/rakoon-back/storage"
+	"strconv"
+	"sync"
+)
+
+// The index operations are applied in order by a single worker, so that a file moved right after its upload ends up at the right path
+const (
+	operationUpdate = iota
+	operationForget
+	operationMove
+)
+
+type operation struct {
+	kind   int
+	userID int
+	path   string
+	target string
+}
+
+// Callbacks apply the operations of an index. The paths are absolute and belong to the user's home.
+type Callbacks struct {
+	// Update indexes a file, or every file under a folder
+	Update func(userID int, path string) error
+	// Forget removes a file, or everything under a folder, from the index
+	Forget func(userID int, path string) error
+	// Move updates the index after a file or a folder moved in its owner's space
+	Move func(userID int, source string, target string) error
+}
+
+// Index keeps data about the files of the users up to date in the background, from the changes published on the event bus
+type Index struct {
+	name        string
+	callbacks   Callbacks
+	queue       chan operation
+	startWorker sync.Once
+}
+
+// New creates an index following the event bus. Its name describes it in the logs.
+func New(name string, callbacks Callbacks) *Index {
+	var index = &Index{name: name, callbacks: callbacks, queue: make(chan operation, 10000)}
+	events.Listen(func(event events.Event) {
+		switch event.Type {
+		case events.Created, events.Modified:
+			index.Update(event.UserID, event.Path)
+		case events.Deleted:
+			index.Forget(event.UserID, event.Path)
+		case events.Moved:
+			index.Move(event.UserID, event.OldPath, event.Path)
+		}
+	})
+	return index
+}
+
+// Update indexes a file, or every file under a folder, in the background
+func (index *Index) Update(userID int, path string) {
+	index.enqueue(operation{kind: operationUpdate, userID: userID, path: path})
+}
+
+// Forget removes a file, or everything under a folder, from the index
+func (index *Index) Forget(userID int, path string) {
+	index.enqueue(operation{kind: operationForget, userID: userID, path: path})
+}
+
+// Move updates the index after a file or a folder moved in its owner's space
+func (index *Index) Move(userID int, source string, target string) {
+	index.enqueue(operation{kind: operationMove, userID: userID, path: source, target: target})
+}
+
+// Reindex indexes a user's whole home
+func (index *Index) Reindex(userID int) error {
+	home, err := storage.HomeDir(userID)
+	if err != nil {
+		return err
+	}
+	index.Update(userID, home)
+	return nil
+}
+
+// The worker is started by the first operation
+func (index *Index) enqueue(op operation) {
+	index.startWorker.Do(func() {
+		go index.work()
+	})
+	index.queue <- op
+}
+
+func (index *Index) work() {
+	for op := range index.queue {
+		var err error
+		switch op.kind {
+		case operationUpdate:
+			err = index.callbacks.Update(op.userID, op.path)
+		case operationForget:
+			err = index.callbacks.Forget(op.userID, op.path)
+		case operationMove:
+			err = index.callbacks.Move(op.userID, op.path, op.target)
+		}
+		if err != nil {
+			log.Println("Could not update " + index.name + " of user " + strconv.Itoa(op.userID) + ": " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"rakoon/rakoon-back/events"
+	"rakoon/rakoon-back/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Finished jobs are kept this long so that the clients can fetch their result
+const retention = 24 * time.Hour
+
+// The progress of a job is published at most this often
+const publishInterval = 500 * time.Millisecond
+
+var mutex sync.Mutex
+var jobs = map[string]*models.Job{}
+var cancels = map[string]context.CancelFunc{}
+var published = map[string]time.Time{}
+
+// Tracker is given to a running job to report its progress
+type Tracker struct {
+	id string
+}
+
+// Progress updates the amount of work done and the total amount of work of a job
+func (tracker Tracker) Progress(processed int64, total int64) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	jobs[tracker.id].Processed = processed
+	jobs[tracker.id].Total = total
+
+	if time.Since(published[tracker.id]) >= publishInterval {
+		publish(jobs[tracker.id])
+	}
+}
+
+// Conflict reports an item the job could not process because it already exists
+func (tracker Tracker) Conflict(name string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	jobs[tracker.id].Conflicts = append(jobs[tracker.id].Conflicts, name)
+}
+
+// Start runs a function in the background and returns the job following it
+func Start(userID int, jobType string, run func(ctx context.Context, tracker Tracker) error) (models.Job, error) {
+	id, err := generateID()
+	if err != nil {
+		return models.Job{}, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var job = &models.Job{
+		ID:        id,
+		UserID:    userID,
+		Type:      jobType,
+		State:     models.JobRunning,
+		Conflicts: []string{},
+		CreatedOn: time.Now(),
+	}
+
+	mutex.Lock()
+	purge()
+	jobs[id] = job
+	cancels[id] = cancel
+	var started models.Job = *job
+	publish(job)
+	mutex.Unlock()
+
+	go func() {
+		err := run(ctx, Tracker{id: id})
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		var now = time.Now()
+		job.FinishedOn = &now
+		if ctx.Err() == context.Canceled {
+			job.State = models.JobCanceled
+		} else if err != nil {
+			job.State = models.JobFailed
+			job.Error = err.Error()
+		} else {
+			job.State = models.JobDone
+		}
+		delete(cancels, id)
+		cancel()
+		publish(job)
+		delete(published, id)
+	}()
+
+	return started, nil
+}
+
+// Get returns a copy of a job
+func Get(id string) (models.Job, bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	job, ok := jobs[id]
+	if !ok {
+		return models.Job{}, false
+	}
+	return copyJob(job), true
+}
+
+// List returns the jobs of a user, the most recent first
+func List(userID int) []models.Job {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var list = []models.Job{}
+	for _, job := range jobs {
+		if job.UserID == userID {
+			list = append(list, copyJob(job))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedOn.After(list[j].CreatedOn) })
+	return list
+}
+
+// Cancel stops a running job
+func Cancel(id string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	cancel, ok := cancels[id]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// This function removes the jobs finished for too long, the mutex must be held.
+func purge() {
+	for id, job := range jobs {
+		if job.FinishedOn != nil && time.Since(*job.FinishedOn) > retention {
+			delete(jobs, id)
+		}
+	}
+}
+
+// This function sends the state of a job to its user, the mutex must be held.
+func publish(job *models.Job) {
+	published[job.ID] = time.Now()
+	events.Publish(events.Event{Type: events.JobUpdated, UserID: job.UserID, Data: copyJob(job)})
+}
+
+func copyJob(job *models.Job) models.Job {
+	var ret models.Job = *job
+	ret.Conflicts = append([]string{}, job.Conflicts...)
+	return ret
+}
+
+func generateID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
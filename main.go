@@ -3,9 +3,16 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"rakoon/rakoon-back/db"
+	"rakoon/rakoon-back/handlers/upload"
+	"rakoon/rakoon-back/recyclebin"
 	"rakoon/rakoon-back/routes"
+	"rakoon/rakoon-back/torrents"
+	"rakoon/rakoon-back/versions"
+	"rakoon/rakoon-back/watcher"
 
 	"github.com/tom-rt/goberge"
 )
@@ -22,6 +29,56 @@ func main() {
 	goberge.Goberge()
 
 	db.InitDB()
+
+	// Trashed items are purged after a retention period, 30 days by default.
+	// A wrong value keeps the default, the purge would otherwise empty every trash.
+	var retentionDays int = 30
+	if envRetention := os.Getenv("TRASH_RETENTION_DAYS"); envRetention != "" {
+		days, err := strconv.Atoi(envRetention)
+		if err != nil || days <= 0 {
+			fmt.Println("WARNING: TRASH_RETENTION_DAYS is not a positive number of days, 30 days are used.")
+		} else {
+			retentionDays = days
+		}
+	}
+	recyclebin.StartPurger(time.Duration(retentionDays)*24*time.Hour, time.Hour)
+
+	// The uploads abandoned for a day, or UPLOAD_EXPIRY_HOURS, are removed
+	var uploadExpiryHours int = 24
+	if envExpiry := os.Getenv("UPLOAD_EXPIRY_HOURS"); envExpiry != "" {
+		hours, err := strconv.Atoi(envExpiry)
+		if err != nil || hours <= 0 {
+			fmt.Println("WARNING: UPLOAD_EXPIRY_HOURS is not a positive number of hours, 24 hours are used.")
+		} else {
+			uploadExpiryHours = hours
+		}
+	}
+	upload.StartSweeper(time.Duration(uploadExpiryHours)*time.Hour, time.Hour)
+
+	// Old file versions are purged according to VERSIONS_MAX_AGE_DAYS
+	versions.StartPurger(versions.PolicyFromEnv(), time.Hour)
+
+	// The changes made in the storage behind the API's back, by torrents or administrators, are followed
+	var debounce time.Duration = watcher.DefaultDebounce
+	if envDebounce := os.Getenv("WATCH_DEBOUNCE_MS"); envDebounce != "" {
+		milliseconds, err := strconv.Atoi(envDebounce)
+		if err != nil || milliseconds <= 0 {
+			fmt.Println("WARNING: WATCH_DEBOUNCE_MS is not a positive number of milliseconds, the default is used.")
+		} else {
+			debounce = time.Duration(milliseconds) * time.Millisecond
+		}
+	}
+	_, err := watcher.Start(debounce)
+	if err != nil {
+		fmt.Println("WARNING: storage is not watched: " + err.Error())
+	}
+
+	// The torrents are downloaded by an embedded client, the downloads interrupted by a restart go on
+	err = torrents.Start(torrents.ConfigFromEnv())
+	if err != nil {
+		fmt.Println("WARNING: torrents can not be downloaded: " + err.Error())
+	}
+
 	r := routes.SetupRouter()
 	r.Run(":8081")
 }
@@ -2,13 +2,14 @@ package middleware
 
 import (
 	"rakoon/rakoon-back/handlers/authentication"
+	"rakoon/rakoon-back/models"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-//AdminJwtHandling middleware, checks if the token is well formatted and has expired
-func AdminJwtHandling(c *gin.Context) {
+//JwtHandling middleware, checks if the token is well formatted and has expired
+func JwtHandling(c *gin.Context) {
 	var token string
 
 	// Check a token is present
@@ -48,7 +49,7 @@ func AdminJwtHandling(c *gin.Context) {
 	signature := splittedToken[2]
 
 	// Check token validity
-	validity, message, status, id, isAdmin := authentication.VerifyToken(string(header), string(payload), string(signature))
+	validity, message, status, id := authentication.VerifyToken(string(header), string(payload), string(signature))
 	if validity == false {
 		c.JSON(status, gin.H{
 			"message": message,
@@ -57,68 +58,38 @@ func AdminJwtHandling(c *gin.Context) {
 		return
 	}
 
-	if !isAdmin {
-		c.JSON(status, gin.H{
-			"message": "Admin privileges are required to access this endpoint.",
-		})
-		c.Abort()
-		return
-	}
-
 	c.Set("id", id)
 	c.Next()
 }
 
-//JwtHandling middleware, checks if the token is well formatted and has expired
-func JwtHandling(c *gin.Context) {
-	var token string
-
-	// Check a token is present
+// QueryToken middleware, reads the token from the token query parameter for the clients which can not send headers, such as EventSource.
+// It is used before JwtHandling.
+func QueryToken(c *gin.Context) {
 	_, checkToken := c.Request.Header["Authorization"]
-	if checkToken == false {
-		c.JSON(403, gin.H{
-			"message": "No token provided",
-		})
-		c.Abort()
-		return
+	if !checkToken && len(c.Query("token")) > 0 {
+		c.Request.Header.Set("Authorization", "Bearer "+c.Query("token"))
 	}
+	c.Next()
+}
 
-	// Check the token is formatted correctly
-	authorization := c.Request.Header["Authorization"][0]
-	bearer := strings.Split(authorization, "Bearer ")
-	if len(bearer) != 2 {
-		c.JSON(403, gin.H{
-			"message": "Bad token",
-		})
-		c.Abort()
-		return
-	}
-	token = bearer[1]
-
-	splittedToken := strings.Split(token, ".")
-	if len(splittedToken) != 3 {
-		c.JSON(403, gin.H{
-			"message": "Bad token",
-		})
-		c.Abort()
-		return
-	}
-
-	// Fetching token data
-	header := splittedToken[0]
-	payload := splittedToken[1]
-	signature := splittedToken[2]
-
-	// Check token validity
-	validity, message, status, id, _ := authentication.VerifyToken(string(header), string(payload), string(signature))
-	if validity == false {
-		c.JSON(status, gin.H{
-			"message": message,
-		})
-		c.Abort()
-		return
+// RequirePermission middleware, checks the authenticated user has a permission through their roles. It is used after JwtHandling.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, err := models.HasPermission(c.GetInt("id"), permission)
+		if err != nil {
+			c.JSON(500, gin.H{"Could not check permissions": err.Error()})
+			c.Abort()
+			return
+		}
+
+		if !allowed {
+			c.JSON(403, gin.H{
+				"message": "The " + permission + " permission is required to access this endpoint.",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
 	}
-
-	c.Set("id", id)
-	c.Next()
 }
@@ -15,8 +15,7 @@ type JwtHeader struct {
 
 // JwtPayload struct
 type JwtPayload struct {
-	ID      int  `json:"id"`
-	IsAdmin bool `json:"isAdmin"`
-	Iat     int  `json:"iat"`
-	Exp     int  `json:"exp"`
+	ID  int `json:"id"`
+	Iat int `json:"iat"`
+	Exp int `json:"exp"`
 }
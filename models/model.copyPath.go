@@ -5,4 +5,5 @@ type CopyPath struct {
 	SourceName string `json:"sourceName" binding:"required"`
 	SourcePath string `json:"sourcePath" binding:"required"`
 	TargetPath string `json:"targetPath" binding:"required"`
+	Conflict   string `json:"conflict"`
 }
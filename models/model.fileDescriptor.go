@@ -1,8 +1,15 @@
 package models
 
+import "time"
+
 // FileDescriptor type represents the content of a directory
 type FileDescriptor struct {
-	TrimmedName string `json:"trimmedName"`
-	Name        string `json:"name"`
-	Type        string `json:"type"`
+	TrimmedName string    `json:"trimmedName"`
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"modTime"`
+	MimeType    string    `json:"mimeType,omitempty"`
+	ChildCount  *int      `json:"childCount,omitempty"`
+	Permissions string    `json:"permissions"`
 }
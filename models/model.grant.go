@@ -0,0 +1,94 @@
+package models
+
+import (
+	"rakoon/rakoon-back/db"
+	"time"
+)
+
+// Permissions of a grant
+const (
+	GrantRead  = "read"
+	GrantWrite = "write"
+)
+
+// Grant gives another user, or the members of a group, access to a folder of the owner's space
+type Grant struct {
+	ID          int       `db:"id" json:"id"`
+	OwnerID     int       `db:"owner_id" json:"ownerId"`
+	OwnerName   string    `db:"owner_name" json:"ownerName"`
+	Path        string    `db:"path" json:"path"`
+	GranteeID   *int      `db:"grantee_id" json:"granteeId"`
+	GranteeName *string   `db:"grantee_name" json:"granteeName"`
+	GroupID     *int      `db:"group_id" json:"groupId"`
+	GroupName   *string   `db:"group_name" json:"groupName"`
+	Permission  string    `db:"permission" json:"permission"`
+	CreatedOn   time.Time `db:"created_on" json:"createdOn"`
+}
+
+// GrantCreate input of a grant, the grantee is designated by their name, or a group by its name
+type GrantCreate struct {
+	Path       string `json:"path" binding:"required"`
+	Grantee    string `json:"grantee"`
+	Group      string `json:"group"`
+	Permission string `json:"permission" binding:"required"`
+}
+
+const grantSelect = `SELECT	grants.id,
+					grants.owner_id,
+					owners.name AS owner_name,
+					grants.path,
+					grants.grantee_id,
+					grantees.name AS grantee_name,
+					grants.group_id,
+					groups.name AS group_name,
+					grants.permission,
+					grants.created_on::timestamp with time zone
+		FROM grants
+		JOIN users owners ON owners.id = grants.owner_id
+		LEFT JOIN users grantees ON grantees.id = grants.grantee_id
+		LEFT JOIN groups ON groups.id = grants.group_id`
+
+// CreateGrant function, granting the same folder again to a user updates the permission
+func CreateGrant(grant Grant) (int, error) {
+	var ID int
+	err := db.DB.Get(&ID,
+		`INSERT INTO grants (owner_id, path, grantee_id, group_id, permission)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (owner_id, path, (COALESCE(grantee_id, 0)), (COALESCE(group_id, 0))) DO UPDATE SET permission = EXCLUDED.permission
+		RETURNING id`,
+		grant.OwnerID, grant.Path, grant.GranteeID, grant.GroupID, grant.Permission)
+	return ID, err
+}
+
+// GetGrant func model
+func GetGrant(ID int) (Grant, error) {
+	var grant Grant
+	err := db.DB.Get(&grant, grantSelect+` WHERE grants.id = $1`, ID)
+	return grant, err
+}
+
+// GetGrantsByOwner func model, the grants given by a user
+func GetGrantsByOwner(ownerID int) ([]Grant, error) {
+	grants := []Grant{}
+	err := db.DB.Select(&grants, grantSelect+` WHERE grants.owner_id = $1 ORDER BY grants.path, grantees.name, groups.name`, ownerID)
+	return grants, err
+}
+
+// GetGrantsForUser func model, the grants received by a user directly or through their groups.
+// The write grants come first, so that they win over a read grant of the same folder.
+func GetGrantsForUser(granteeID int) ([]Grant, error) {
+	grants := []Grant{}
+	err := db.DB.Select(&grants,
+		grantSelect+` WHERE grants.owner_id <> $1 AND (grants.grantee_id = $1
+			OR grants.group_id IN (SELECT group_id FROM group_members WHERE user_id = $1))
+		ORDER BY grants.permission = 'write' DESC, grants.id`,
+		granteeID)
+	return grants, err
+}
+
+// DeleteGrant function
+func DeleteGrant(ID int) {
+	tx := db.DB.MustBegin()
+	tx.MustExec("DELETE FROM grants WHERE id = $1", ID)
+	tx.Commit()
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"rakoon/rakoon-back/db"
+	"time"
+)
+
+// Group gathers users, to give them roles or share folders with them at once
+type Group struct {
+	ID        int       `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	CreatedOn time.Time `db:"created_on" json:"createdOn"`
+}
+
+// GroupInput input of a group creation
+type GroupInput struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// CreateGroup function
+func CreateGroup(group Group) (int, error) {
+	var ID int
+	err := db.DB.Get(&ID, `INSERT INTO groups (name) VALUES ($1) RETURNING id`, group.Name)
+	return ID, err
+}
+
+// GetGroup func model
+func GetGroup(ID int) (Group, error) {
+	var group Group
+	err := db.DB.Get(&group,
+		`SELECT	id,
+					name,
+					created_on::timestamp with time zone
+		FROM groups WHERE id = $1`,
+		ID)
+	return group, err
+}
+
+// GetGroupByName func model
+func GetGroupByName(name string) (Group, error) {
+	var group Group
+	err := db.DB.Get(&group,
+		`SELECT	id,
+					name,
+					created_on::timestamp with time zone
+		FROM groups WHERE name = $1`,
+		name)
+	return group, err
+}
+
+// GetGroupList func model
+func GetGroupList() ([]Group, error) {
+	groups := []Group{}
+	err := db.DB.Select(&groups,
+		`SELECT	id,
+					name,
+					created_on::timestamp with time zone
+		FROM groups ORDER BY name`)
+	return groups, err
+}
+
+// GetGroupMembers func model
+func GetGroupMembers(groupID int) ([]UserPublic, error) {
+	members := []UserPublic{}
+	err := db.DB.Select(&members,
+		`SELECT	users.id,
+					users.name,
+					users.reauth,
+					users.last_login::timestamp with time zone,
+					users.created_on::timestamp with time zone
+		FROM users JOIN group_members ON group_members.user_id = users.id
+		WHERE group_members.group_id = $1 ORDER BY users.name`,
+		groupID)
+	return members, err
+}
+
+// GetGroupRoles func model
+func GetGroupRoles(groupID int) ([]Role, error) {
+	roles := []Role{}
+	err := db.DB.Select(&roles,
+		`SELECT	roles.id,
+					roles.name,
+					roles.permissions,
+					roles.is_default,
+					roles.created_on::timestamp with time zone
+		FROM roles JOIN group_roles ON group_roles.role_id = roles.id
+		WHERE group_roles.group_id = $1 ORDER BY roles.name`,
+		groupID)
+	return roles, err
+}
+
+// DeleteGroup function
+func DeleteGroup(ID int) {
+	tx := db.DB.MustBegin()
+	tx.MustExec("DELETE FROM groups WHERE id = $1", ID)
+	tx.Commit()
+}
+
+// AddGroupMember function
+func AddGroupMember(groupID int, userID int) error {
+	_, err := db.DB.Exec(
+		`INSERT INTO group_members (group_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		groupID, userID)
+	return err
+}
+
+// RemoveGroupMember function
+func RemoveGroupMember(groupID int, userID int) {
+	tx := db.DB.MustBegin()
+	tx.MustExec("DELETE FROM group_members WHERE group_id = $1 AND user_id = $2", groupID, userID)
+	tx.Commit()
+}
+
+// AddGroupRole function
+func AddGroupRole(groupID int, roleID int) error {
+	_, err := db.DB.Exec(
+		`INSERT INTO group_roles (group_id, role_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		groupID, roleID)
+	return err
+}
+
+// RemoveGroupRole function
+func RemoveGroupRole(groupID int, roleID int) {
+	tx := db.DB.MustBegin()
+	tx.MustExec("DELETE FROM group_roles WHERE group_id = $1 AND role_id = $2", groupID, roleID)
+	tx.Commit()
+}
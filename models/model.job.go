@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Job states
+const (
+	JobRunning  = "running"
+	JobDone     = "done"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+// Job represents a long running task executed in the background
+type Job struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"userId"`
+	Type       string     `json:"type"`
+	State      string     `json:"state"`
+	Processed  int64      `json:"processed"`
+	Total      int64      `json:"total"`
+	Error      string     `json:"error,omitempty"`
+	Conflicts  []string   `json:"conflicts"`
+	CreatedOn  time.Time  `json:"createdOn"`
+	FinishedOn *time.Time `json:"finishedOn"`
+}
+
+// Extract input of an archive extraction
+type Extract struct {
+	Path       string `json:"path" binding:"required"`
+	TargetPath string `json:"targetPath" binding:"required"`
+	Overwrite  bool   `json:"overwrite"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LiveEvent is an event pushed to a connected client, with the paths it sees the files at
+type LiveEvent struct {
+	Type    string      `json:"type"`
+	Path    string      `json:"path,omitempty"`
+	OldPath string      `json:"oldPath,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Time    time.Time   `json:"time"`
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"rakoon/rakoon-back/db"
+	"time"
+)
+
+// Types of notification
+const (
+	NotificationDrop = "drop"
+)
+
+// Notification tells a user about something that happened in their space
+type Notification struct {
+	ID        int       `db:"id" json:"id"`
+	UserID    int       `db:"user_id" json:"userId"`
+	Type      string    `db:"type" json:"type"`
+	Message   string    `db:"message" json:"message"`
+	Path      string    `db:"path" json:"path"`
+	Read      bool      `db:"read" json:"read"`
+	CreatedOn time.Time `db:"created_on" json:"createdOn"`
+}
+
+// CreateNotification function
+func CreateNotification(notification Notification) (Notification, error) {
+	err := db.DB.Get(&notification,
+		`INSERT INTO notifications (user_id, type, message, path)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, read, created_on::timestamp with time zone`,
+		notification.UserID, notification.Type, notification.Message, notification.Path)
+	return notification, err
+}
+
+// GetNotification func model
+func GetNotification(ID int) (Notification, error) {
+	var notification Notification
+	err := db.DB.Get(&notification,
+		`SELECT	id,
+					user_id,
+					type,
+					message,
+					path,
+					read,
+					created_on::timestamp with time zone
+		FROM notifications WHERE id = $1`,
+		ID)
+	return notification, err
+}
+
+// GetNotificationList func model
+func GetNotificationList(userID int) ([]Notification, error) {
+	notifications := []Notification{}
+	err := db.DB.Select(&notifications,
+		`SELECT	id,
+					user_id,
+					type,
+					message,
+					path,
+					read,
+					created_on::timestamp with time zone
+		FROM notifications WHERE user_id = $1 ORDER BY created_on DESC`,
+		userID)
+	return notifications, err
+}
+
+// MarkNotificationRead function
+func MarkNotificationRead(ID int) {
+	tx := db.DB.MustBegin()
+	tx.MustExec("UPDATE notifications SET read = true WHERE id = $1", ID)
+	tx.Commit()
+}
+
+// DeleteNotification function
+func DeleteNotification(ID int) {
+	tx := db.DB.MustBegin()
+	tx.MustExec("DELETE FROM notifications WHERE id = $1", ID)
+	tx.Commit()
+}
@@ -2,5 +2,6 @@ package models
 
 // PathDelete path deletion
 type PathDelete struct {
-	Path string `json:"path"`
+	Path      string `json:"path"`
+	Permanent bool   `json:"permanent"`
 }
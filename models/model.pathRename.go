@@ -5,4 +5,5 @@ type PathRename struct {
 	Name         string `json:"name" binding:"required"`
 	NewPath      string `json:"newPath" binding:"required"`
 	OriginalPath string `json:"originalPath" binding:"required"`
+	Conflict     string `json:"conflict"`
 }
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"fmt"
+	"rakoon/rakoon-back/db"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Photo is an image of a user's space, described by its EXIF metadata.
+// The dates are the local time of the camera, the photos without a capture date are dated by their modification.
+type Photo struct {
+	ID          int        `db:"id" json:"-"`
+	UserID      int        `db:"user_id" json:"-"`
+	Path        string     `db:"path" json:"path"`
+	Date        time.Time  `db:"date" json:"date"`
+	TakenOn     *time.Time `db:"taken_on" json:"takenOn"`
+	ModifiedOn  time.Time  `db:"modified_on" json:"modifiedOn"`
+	CameraMake  *string    `db:"camera_make" json:"cameraMake"`
+	CameraModel *string    `db:"camera_model" json:"cameraModel"`
+	Width       int        `db:"width" json:"width"`
+	Height      int        `db:"height" json:"height"`
+	Latitude    *float64   `db:"latitude" json:"latitude"`
+	Longitude   *float64   `db:"longitude" json:"longitude"`
+}
+
+// TimelineGroup holds the photos of a year, a month or a day. Count is the number of photos of the whole group,
+// which may be split between several pages.
+type TimelineGroup struct {
+	Key    string  `json:"key"`
+	Count  int     `json:"count"`
+	Photos []Photo `json:"photos"`
+}
+
+// PhotoArea is a folder of an owner's space, the timeline lists the photos under it
+type PhotoArea struct {
+	UserID int
+	Path   string
+}
+
+// SavePhoto function, the metadata replace the ones previously saved for the path
+func SavePhoto(photo Photo) error {
+	_, err := db.DB.Exec(
+		`INSERT INTO photos (user_id, path, taken_on, modified_on, camera_make, camera_model, width, height, latitude, longitude)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (user_id, path) DO UPDATE SET taken_on = EXCLUDED.taken_on, modified_on = EXCLUDED.modified_on,
+			camera_make = EXCLUDED.camera_make, camera_model = EXCLUDED.camera_model, width = EXCLUDED.width, height = EXCLUDED.height,
+			latitude = EXCLUDED.latitude, longitude = EXCLUDED.longitude, indexed_on = now()`,
+		photo.UserID, photo.Path, photo.TakenOn, photo.ModifiedOn, photo.CameraMake, photo.CameraModel,
+		photo.Width, photo.Height, photo.Latitude, photo.Longitude)
+	return err
+}
+
+// DeletePhotos function, removes a path and every photo under it
+func DeletePhotos(userID int, path string) error {
+	_, err := db.DB.Exec(
+		"DELETE FROM photos WHERE user_id = $1 AND (path = $2 OR path LIKE $3)",
+		userID, path, childrenPattern(path))
+	return err
+}
+
+// MovePhotos function, the photos under the source path are moved under the target path
+func MovePhotos(userID int, source string, target string) error {
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"DELETE FROM photos WHERE user_id = $1 AND (path = $2 OR path LIKE $3)",
+		userID, target, childrenPattern(target))
+	if err == nil {
+		_, err = tx.Exec(
+			`UPDATE photos SET path = $3::text || substr(path, length($2::text) + 1)
+			WHERE user_id = $1 AND (path = $2 OR path LIKE $4)`,
+			userID, source, target, childrenPattern(source))
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetPhotoDates function, returns the modification date of the photos under a path when they were saved, by path.
+// The dates are returned as they were saved, without time zone.
+func GetPhotoDates(userID int, path string) (map[string]time.Time, error) {
+	photos := []Photo{}
+	err := db.DB.Select(&photos,
+		"SELECT path, modified_on FROM photos WHERE user_id = $1 AND (path = $2 OR path LIKE $3)",
+		userID, path, childrenPattern(path))
+
+	var dates = map[string]time.Time{}
+	for _, photo := range photos {
+		dates[photo.Path] = photo.ModifiedOn
+	}
+	return dates, err
+}
+
+// GetTimelinePhotos function, returns a page of the photos of some areas, the most recent first
+func GetTimelinePhotos(areas []PhotoArea, limit int, offset int) ([]Photo, error) {
+	photos := []Photo{}
+	condition, args := photoAreasCondition(areas, nil)
+	args = append(args, limit, offset)
+	err := db.DB.Select(&photos,
+		fmt.Sprintf(
+			`SELECT	id,
+					user_id,
+					path,
+					COALESCE(taken_on, modified_on)::timestamp with time zone AS date,
+					taken_on::timestamp with time zone,
+					modified_on::timestamp with time zone,
+					camera_make,
+					camera_model,
+					width,
+					height,
+					latitude,
+					longitude
+			FROM photos WHERE %s
+			ORDER BY COALESCE(taken_on, modified_on) DESC, path LIMIT $%d OFFSET $%d`,
+			condition, len(args)-1, len(args)),
+		args...)
+	return photos, err
+}
+
+// CountTimelinePhotos function, returns the number of photos of some areas
+func CountTimelinePhotos(areas []PhotoArea) (int, error) {
+	var count int
+	condition, args := photoAreasCondition(areas, nil)
+	err := db.DB.Get(&count, "SELECT count(*) FROM photos WHERE "+condition, args...)
+	return count, err
+}
+
+// CountTimelineGroups function, returns the number of photos of some areas in each of the given groups.
+// The groups are keyed by their date formatted with a to_char pattern.
+func CountTimelineGroups(areas []PhotoArea, pattern string, keys []string) (map[string]int, error) {
+	var groups []struct {
+		Key   string `db:"key"`
+		Count int    `db:"count"`
+	}
+	condition, args := photoAreasCondition(areas, []interface{}{pattern, pq.Array(keys)})
+	err := db.DB.Select(&groups,
+		`SELECT to_char(COALESCE(taken_on, modified_on), $1) AS key, count(*) AS count
+		FROM photos WHERE to_char(COALESCE(taken_on, modified_on), $1) = ANY($2) AND `+condition+`
+		GROUP BY key`,
+		args...)
+
+	var counts = map[string]int{}
+	for _, group := range groups {
+		counts[group.Key] = group.Count
+	}
+	return counts, err
+}
+
+// This function builds the condition matching the photos of some areas, its parameters follow the given ones
+func photoAreasCondition(areas []PhotoArea, args []interface{}) (string, []interface{}) {
+	var conditions []string
+	for _, area := range areas {
+		args = append(args, area.UserID, area.Path, childrenPattern(area.Path))
+		conditions = append(conditions,
+			fmt.Sprintf("(user_id = $%d AND (path = $%d OR path LIKE $%d))", len(args)-2, len(args)-1, len(args)))
+	}
+	if len(conditions) <= 0 {
+		return "FALSE", args
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
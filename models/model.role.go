@@ -0,0 +1,160 @@
+package models
+
+import (
+	"rakoon/rakoon-back/db"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Permissions a role can give
+const (
+	PermissionManageUsers      = "manage_users"
+	PermissionManageRoles      = "manage_roles"
+	PermissionManageTorrents   = "manage_torrents"
+	PermissionUnlimitedQuota   = "unlimited_quota"
+	PermissionSharePublicly    = "share_publicly"
+	PermissionDownloadTorrents = "download_torrents"
+)
+
+// Permissions lists every known permission
+var Permissions = []string{
+	PermissionManageUsers,
+	PermissionManageRoles,
+	PermissionManageTorrents,
+	PermissionUnlimitedQuota,
+	PermissionSharePublicly,
+	PermissionDownloadTorrents,
+}
+
+// Role is a named set of permissions, given to users directly or through their groups.
+// A default role is given to every user.
+type Role struct {
+	ID          int            `db:"id" json:"id"`
+	Name        string         `db:"name" json:"name"`
+	Permissions pq.StringArray `db:"permissions" json:"permissions"`
+	IsDefault   bool           `db:"is_default" json:"isDefault"`
+	CreatedOn   time.Time      `db:"created_on" json:"createdOn"`
+}
+
+// RoleInput input of a role creation or update
+type RoleInput struct {
+	Name        string   `json:"name" binding:"required"`
+	Permissions []string `json:"permissions"`
+	IsDefault   bool     `json:"isDefault"`
+}
+
+// ValidPermission checks a permission name
+func ValidPermission(permission string) bool {
+	for _, known := range Permissions {
+		if permission == known {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateRole function
+func CreateRole(role Role) (int, error) {
+	var ID int
+	err := db.DB.Get(&ID,
+		`INSERT INTO roles (name, permissions, is_default) VALUES ($1, $2, $3) RETURNING id`,
+		role.Name, role.Permissions, role.IsDefault)
+	return ID, err
+}
+
+// GetRole func model
+func GetRole(ID int) (Role, error) {
+	var role Role
+	err := db.DB.Get(&role,
+		`SELECT	id,
+					name,
+					permissions,
+					is_default,
+					created_on::timestamp with time zone
+		FROM roles WHERE id = $1`,
+		ID)
+	return role, err
+}
+
+// GetRoleList func model
+func GetRoleList() ([]Role, error) {
+	roles := []Role{}
+	err := db.DB.Select(&roles,
+		`SELECT	id,
+					name,
+					permissions,
+					is_default,
+					created_on::timestamp with time zone
+		FROM roles ORDER BY name`)
+	return roles, err
+}
+
+// UpdateRole function
+func UpdateRole(role Role) error {
+	_, err := db.DB.Exec(
+		`UPDATE roles SET name = $1, permissions = $2, is_default = $3 WHERE id = $4`,
+		role.Name, role.Permissions, role.IsDefault, role.ID)
+	return err
+}
+
+// DeleteRole function
+func DeleteRole(ID int) {
+	tx := db.DB.MustBegin()
+	tx.MustExec("DELETE FROM roles WHERE id = $1", ID)
+	tx.Commit()
+}
+
+// AddUserRole function
+func AddUserRole(userID int, roleID int) error {
+	_, err := db.DB.Exec(
+		`INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		userID, roleID)
+	return err
+}
+
+// RemoveUserRole function
+func RemoveUserRole(userID int, roleID int) {
+	tx := db.DB.MustBegin()
+	tx.MustExec("DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2", userID, roleID)
+	tx.Commit()
+}
+
+// The roles of a user: the default roles, their own roles and the roles of their groups
+const userRolesCondition = `roles.is_default
+		OR roles.id IN (SELECT role_id FROM user_roles WHERE user_id = $1)
+		OR roles.id IN (SELECT group_roles.role_id FROM group_roles
+			JOIN group_members ON group_members.group_id = group_roles.group_id
+			WHERE group_members.user_id = $1)`
+
+// GetUserRoles func model
+func GetUserRoles(userID int) ([]Role, error) {
+	roles := []Role{}
+	err := db.DB.Select(&roles,
+		`SELECT	id,
+					name,
+					permissions,
+					is_default,
+					created_on::timestamp with time zone
+		FROM roles WHERE `+userRolesCondition+` ORDER BY name`,
+		userID)
+	return roles, err
+}
+
+// GetUserPermissions func model
+func GetUserPermissions(userID int) ([]string, error) {
+	permissions := []string{}
+	err := db.DB.Select(&permissions,
+		`SELECT DISTINCT unnest(permissions) FROM roles WHERE `+userRolesCondition,
+		userID)
+	return permissions, err
+}
+
+// HasPermission func model
+func HasPermission(userID int, permission string) (bool, error) {
+	var allowed bool
+	err := db.DB.Get(&allowed,
+		`SELECT EXISTS (SELECT 1 FROM roles WHERE $2 = ANY(permissions) AND (`+userRolesCondition+`))`,
+		userID, permission)
+	return allowed, err
+}
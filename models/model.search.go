@@ -0,0 +1,79 @@
+package models
+
+import (
+	"rakoon/rakoon-back/db"
+	"strings"
+)
+
+// SearchResult is a file found by a search, with the path the user sees it at
+type SearchResult struct {
+	FileDescriptor
+	Path  string  `json:"path"`
+	Score float64 `json:"score"`
+}
+
+// ContentMatch is an indexed file whose content matches a search
+type ContentMatch struct {
+	Path string  `db:"path"`
+	Rank float64 `db:"rank"`
+}
+
+// SaveFileContent function, the text replaces the previous content indexed for the path
+func SaveFileContent(userID int, path string, text string) error {
+	_, err := db.DB.Exec(
+		`INSERT INTO file_contents (user_id, path, content)
+		VALUES ($1, $2, to_tsvector('simple', $3::text))
+		ON CONFLICT (user_id, path) DO UPDATE SET content = EXCLUDED.content, indexed_on = now()`,
+		userID, path, text)
+	return err
+}
+
+// DeleteFileContents function, removes a path and everything indexed under it
+func DeleteFileContents(userID int, path string) error {
+	_, err := db.DB.Exec(
+		"DELETE FROM file_contents WHERE user_id = $1 AND (path = $2 OR path LIKE $3)",
+		userID, path, childrenPattern(path))
+	return err
+}
+
+// MoveFileContents function, the contents indexed under the source path are moved under the target path
+func MoveFileContents(userID int, source string, target string) error {
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"DELETE FROM file_contents WHERE user_id = $1 AND (path = $2 OR path LIKE $3)",
+		userID, target, childrenPattern(target))
+	if err == nil {
+		_, err = tx.Exec(
+			`UPDATE file_contents SET path = $3::text || substr(path, length($2::text) + 1)
+			WHERE user_id = $1 AND (path = $2 OR path LIKE $4)`,
+			userID, source, target, childrenPattern(source))
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// SearchFileContents function, returns the best ranked files under a path whose content matches the words of a query
+func SearchFileContents(userID int, query string, under string, limit int) ([]ContentMatch, error) {
+	matches := []ContentMatch{}
+	err := db.DB.Select(&matches,
+		`SELECT	path,
+				ts_rank(content, query) AS rank
+		FROM file_contents, plainto_tsquery('simple', $2::text) query
+		WHERE user_id = $1 AND content @@ query AND (path = $3 OR path LIKE $4)
+		ORDER BY rank DESC, path LIMIT $5`,
+		userID, query, under, childrenPattern(under), limit)
+	return matches, err
+}
+
+// This function builds the LIKE pattern matching the paths under a folder
+func childrenPattern(path string) string {
+	var escaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return escaper.Replace(strings.TrimSuffix(path, "/")) + "/%"
+}
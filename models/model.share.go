@@ -0,0 +1,127 @@
+package models
+
+import (
+	"database/sql"
+	"rakoon/rakoon-back/db"
+	"time"
+)
+
+// Kinds of share: a download link gives access to the shared content, an upload link only accepts new files in a folder
+const (
+	ShareDownload = "download"
+	ShareUpload   = "upload"
+)
+
+// Share is a public link giving access to a file or a folder of a user's space, without a Rakoon account
+type Share struct {
+	ID           int        `db:"id" json:"id"`
+	Token        string     `db:"token" json:"token"`
+	UserID       int        `db:"user_id" json:"userId"`
+	Path         string     `db:"path" json:"path"`
+	IsDir        bool       `db:"is_dir" json:"isDir"`
+	Kind         string     `db:"kind" json:"kind"`
+	Password     *string    `db:"password" json:"-"`
+	HasPassword  bool       `db:"has_password" json:"hasPassword"`
+	ExpiresOn    *time.Time `db:"expires_on" json:"expiresOn"`
+	MaxDownloads *int       `db:"max_downloads" json:"maxDownloads"`
+	Downloads    int        `db:"downloads" json:"downloads"`
+	MaxSize      *int64     `db:"max_size" json:"maxSize"`
+	AllowedTypes string     `db:"allowed_types" json:"allowedTypes"`
+	CreatedOn    time.Time  `db:"created_on" json:"createdOn"`
+}
+
+// ShareCreate input of a share creation, every limit is optional.
+// MaxSize and AllowedTypes, a list of file extensions, only apply to upload links.
+type ShareCreate struct {
+	Path         string     `json:"path"`
+	Kind         string     `json:"kind"`
+	Password     string     `json:"password"`
+	ExpiresOn    *time.Time `json:"expiresOn"`
+	MaxDownloads *int       `json:"maxDownloads"`
+	MaxSize      *int64     `json:"maxSize"`
+	AllowedTypes []string   `json:"allowedTypes"`
+}
+
+// ShareUnlock input of a password protected share
+type ShareUnlock struct {
+	Password string `json:"password"`
+}
+
+// PublicShare is what a visitor sees of a share, the content of an upload link is never shown
+type PublicShare struct {
+	Name         string           `json:"name"`
+	IsDir        bool             `json:"isDir"`
+	Kind         string           `json:"kind"`
+	ExpiresOn    *time.Time       `json:"expiresOn"`
+	MaxSize      *int64           `json:"maxSize,omitempty"`
+	AllowedTypes string           `json:"allowedTypes,omitempty"`
+	File         *FileDescriptor  `json:"file,omitempty"`
+	Content      []FileDescriptor `json:"content,omitempty"`
+}
+
+const shareColumns = `id,
+					token,
+					user_id,
+					path,
+					is_dir,
+					kind,
+					password,
+					password IS NOT NULL AS has_password,
+					expires_on::timestamp with time zone,
+					max_downloads,
+					downloads,
+					max_size,
+					allowed_types,
+					created_on::timestamp with time zone`
+
+// CreateShare function
+func CreateShare(share Share) (Share, error) {
+	err := db.DB.Get(&share,
+		`INSERT INTO shares (token, user_id, path, is_dir, kind, password, expires_on, max_downloads, max_size, allowed_types)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING `+shareColumns,
+		share.Token, share.UserID, share.Path, share.IsDir, share.Kind, share.Password, share.ExpiresOn, share.MaxDownloads, share.MaxSize, share.AllowedTypes)
+	return share, err
+}
+
+// GetShare func model
+func GetShare(ID int) (Share, error) {
+	var share Share
+	err := db.DB.Get(&share, `SELECT `+shareColumns+` FROM shares WHERE id = $1`, ID)
+	return share, err
+}
+
+// GetShareByToken func model
+func GetShareByToken(token string) (Share, error) {
+	var share Share
+	err := db.DB.Get(&share, `SELECT `+shareColumns+` FROM shares WHERE token = $1`, token)
+	return share, err
+}
+
+// GetShareList func model
+func GetShareList(userID int) ([]Share, error) {
+	shares := []Share{}
+	err := db.DB.Select(&shares, `SELECT `+shareColumns+` FROM shares WHERE user_id = $1 ORDER BY created_on DESC`, userID)
+	return shares, err
+}
+
+// CountShareDownload func model, returns false when the share has no download left
+func CountShareDownload(ID int) (bool, error) {
+	var downloads int
+	err := db.DB.Get(&downloads,
+		`UPDATE shares SET downloads = downloads + 1
+		WHERE id = $1 AND (max_downloads IS NULL OR downloads < max_downloads)
+		RETURNING downloads`,
+		ID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DeleteShare function
+func DeleteShare(ID int) {
+	tx := db.DB.MustBegin()
+	tx.MustExec("DELETE FROM shares WHERE id = $1", ID)
+	tx.Commit()
+}
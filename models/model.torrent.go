@@ -0,0 +1,205 @@
+package models
+
+import (
+	"rakoon/rakoon-back/db"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Torrent job states, besides the job states
+const (
+	// TorrentMetadata jobs are fetching the metadata of a magnet link from the peers
+	TorrentMetadata = "metadata"
+	// TorrentWaiting jobs wait for the user to select the files to download
+	TorrentWaiting = "waiting"
+	// TorrentPaused jobs are out of the engine until they are resumed
+	TorrentPaused = "paused"
+	// TorrentSeeding jobs share content the user already has with the peers, until they are canceled
+	TorrentSeeding = "seeding"
+)
+
+// TorrentJob is a torrent downloaded in a folder of a user, or seeded from it. It is saved so that the downloads go on after a restart.
+// Its state is one of the job states, or one of the torrent job states before the transfer starts.
+type TorrentJob struct {
+	ID       int    `db:"id" json:"id"`
+	UserID   int    `db:"user_id" json:"userId"`
+	OwnerID  int    `db:"owner_id" json:"-"`
+	InfoHash string `db:"info_hash" json:"infoHash"`
+	Name     string `db:"name" json:"name"`
+	// Path is the folder the torrent is downloaded in, as seen by the user
+	Path string `db:"path" json:"path"`
+	// OwnerPath is the same folder in the home of its owner, the user or the owner of a shared folder
+	OwnerPath string `db:"owner_path" json:"-"`
+	// MetaInfo is the content of the .torrent file, nil until the metadata of a magnet link is known
+	MetaInfo []byte `db:"metainfo" json:"-"`
+	Magnet   string `db:"magnet" json:"-"`
+	// Files are the paths of the files downloaded in the torrent, nil for all of them
+	Files pq.StringArray `db:"files" json:"files"`
+	// SelectFiles jobs wait for the user to select the files once the metadata is known
+	SelectFiles bool `db:"select_files" json:"selectFiles"`
+	// Seed jobs are created with their content, they are seeding when they run
+	Seed       bool       `db:"seed" json:"seed"`
+	State      string     `db:"state" json:"state"`
+	Total      int64      `db:"total" json:"total"`
+	Completed  int64      `db:"completed" json:"completed"`
+	Error      string     `db:"error" json:"error,omitempty"`
+	CreatedOn  time.Time  `db:"created_on" json:"createdOn"`
+	FinishedOn *time.Time `db:"finished_on" json:"finishedOn"`
+	// The statistics of the transfer, only known while the torrent is in the engine.
+	// Speed is in bytes per second and ETA in seconds, nil when it is unknown.
+	Speed int64  `db:"-" json:"speed"`
+	Peers int    `db:"-" json:"peers"`
+	ETA   *int64 `db:"-" json:"eta"`
+}
+
+// TorrentFile is a file of a torrent, its path is relative to the torrent's folder
+type TorrentFile struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Selected bool   `json:"selected"`
+}
+
+// TorrentSelection input, the paths of the files to download
+type TorrentSelection struct {
+	Files []string `json:"files" binding:"required"`
+}
+
+// TorrentCreate input of a .torrent file built from a file or a folder of the user
+type TorrentCreate struct {
+	Path string `json:"path" binding:"required"`
+	// PieceSize is a power of two from 16 KiB to 16 MiB, chosen from the size of the content when it is 0
+	PieceSize int64    `json:"pieceSize"`
+	Trackers  []string `json:"trackers"`
+	Private   bool     `json:"private"`
+	Comment   string   `json:"comment"`
+	// Hybrid torrents are both BitTorrent v1 and v2 torrents
+	Hybrid bool `json:"hybrid"`
+	// Seed shares the content with the peers once the .torrent file is written
+	Seed bool `json:"seed"`
+}
+
+// TorrentInfo is the content of a .torrent file
+type TorrentInfo struct {
+	Name string `json:"name"`
+	// InfoHash identifies the torrent, InfoHashV2 is only set for BitTorrent v2 and hybrid torrents
+	InfoHash   string     `json:"infoHash"`
+	InfoHashV2 string     `json:"infoHashV2,omitempty"`
+	TotalSize  int64      `json:"totalSize"`
+	PieceSize  int64      `json:"pieceSize"`
+	Pieces     int        `json:"pieces"`
+	Private    bool       `json:"private"`
+	Comment    string     `json:"comment,omitempty"`
+	CreatedBy  string     `json:"createdBy,omitempty"`
+	CreatedOn  *time.Time `json:"createdOn,omitempty"`
+	Trackers   []string   `json:"trackers"`
+	// Files is the tree of the torrent, a folder named after it or its only file
+	Files TorrentEntry `json:"files"`
+}
+
+// TorrentEntry is a file or a folder of a torrent, the size of a folder is the size of its files
+type TorrentEntry struct {
+	Name     string         `json:"name"`
+	Size     int64          `json:"size"`
+	IsDir    bool           `json:"isDir"`
+	Children []TorrentEntry `json:"children,omitempty"`
+}
+
+// The columns of a torrent job
+const torrentJobColumns = `id,
+					user_id,
+					owner_id,
+					info_hash,
+					name,
+					path,
+					owner_path,
+					metainfo,
+					magnet,
+					files,
+					select_files,
+					seed,
+					state,
+					total,
+					completed,
+					error,
+					created_on::timestamp with time zone,
+					finished_on::timestamp with time zone`
+
+// CreateTorrentJob function
+func CreateTorrentJob(job TorrentJob) (TorrentJob, error) {
+	err := db.DB.Get(&job,
+		`INSERT INTO torrents (user_id, owner_id, info_hash, name, path, owner_path, metainfo, magnet, files, select_files, seed, state, total, completed)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id, created_on::timestamp with time zone`,
+		job.UserID, job.OwnerID, job.InfoHash, job.Name, job.Path, job.OwnerPath, job.MetaInfo, job.Magnet, job.Files, job.SelectFiles,
+		job.Seed, job.State, job.Total, job.Completed)
+	return job, err
+}
+
+// GetTorrentJob func model
+func GetTorrentJob(ID int) (TorrentJob, error) {
+	var job TorrentJob
+	err := db.DB.Get(&job, "SELECT "+torrentJobColumns+" FROM torrents WHERE id = $1", ID)
+	return job, err
+}
+
+// GetTorrentJobs func model, the jobs of a user, the most recent first
+func GetTorrentJobs(userID int) ([]TorrentJob, error) {
+	jobs := []TorrentJob{}
+	err := db.DB.Select(&jobs, "SELECT "+torrentJobColumns+" FROM torrents WHERE user_id = $1 ORDER BY id DESC", userID)
+	return jobs, err
+}
+
+// GetAllTorrentJobs func model, the jobs of every user, the most recent first
+func GetAllTorrentJobs() ([]TorrentJob, error) {
+	jobs := []TorrentJob{}
+	err := db.DB.Select(&jobs, "SELECT "+torrentJobColumns+" FROM torrents ORDER BY id DESC")
+	return jobs, err
+}
+
+// GetTorrentJobsByState func model, the jobs in one of the states, the oldest job first
+func GetTorrentJobsByState(states ...string) ([]TorrentJob, error) {
+	jobs := []TorrentJob{}
+	err := db.DB.Select(&jobs, "SELECT "+torrentJobColumns+" FROM torrents WHERE state = ANY($1) ORDER BY id", pq.Array(states))
+	return jobs, err
+}
+
+// SaveTorrentMetaInfo function, saves the metadata fetched for a magnet link
+func SaveTorrentMetaInfo(ID int, name string, metaInfo []byte, total int64, state string) error {
+	_, err := db.DB.Exec("UPDATE torrents SET name = $2, metainfo = $3, total = $4, state = $5 WHERE id = $1",
+		ID, name, metaInfo, total, state)
+	return err
+}
+
+// SelectTorrentFiles function, saves the files selected in a torrent and starts its transfer
+func SelectTorrentFiles(ID int, files []string, total int64) error {
+	_, err := db.DB.Exec("UPDATE torrents SET files = $2, total = $3, state = $4 WHERE id = $1",
+		ID, pq.Array(files), total, JobRunning)
+	return err
+}
+
+// UpdateTorrentProgress function
+func UpdateTorrentProgress(ID int, completed int64) error {
+	_, err := db.DB.Exec("UPDATE torrents SET completed = $2 WHERE id = $1", ID, completed)
+	return err
+}
+
+// SetTorrentJobState function, the finished jobs keep their state
+func SetTorrentJobState(ID int, state string) error {
+	_, err := db.DB.Exec("UPDATE torrents SET state = $2 WHERE id = $1 AND finished_on IS NULL", ID, state)
+	return err
+}
+
+// FinishTorrentJob function, sets the final state of a job and its error if it failed. A job is only finished once.
+func FinishTorrentJob(ID int, state string, completed int64, message string) error {
+	_, err := db.DB.Exec("UPDATE torrents SET state = $2, completed = $3, error = $4, finished_on = now() WHERE id = $1 AND finished_on IS NULL",
+		ID, state, completed, message)
+	return err
+}
+
+// DeleteTorrentJob function
+func DeleteTorrentJob(ID int) {
+	tx := db.DB.MustBegin()
+	tx.MustExec("DELETE FROM torrents WHERE id = $1", ID)
+	tx.Commit()
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"rakoon/rakoon-back/db"
+	"time"
+)
+
+// Track is an audio file of a user's space, described by its tags. The empty tags are empty strings or zeros.
+type Track struct {
+	ID          int       `db:"id" json:"id"`
+	UserID      int       `db:"user_id" json:"-"`
+	Path        string    `db:"path" json:"path"`
+	Title       string    `db:"title" json:"title"`
+	Artist      string    `db:"artist" json:"artist"`
+	AlbumArtist string    `db:"album_artist" json:"albumArtist"`
+	Album       string    `db:"album" json:"album"`
+	TrackNumber int       `db:"track_number" json:"trackNumber"`
+	DiscNumber  int       `db:"disc_number" json:"discNumber"`
+	Year        int       `db:"year" json:"year"`
+	Genre       string    `db:"genre" json:"genre"`
+	Duration    float64   `db:"duration" json:"duration"`
+	HasCover    bool      `db:"has_cover" json:"hasCover"`
+	ModifiedOn  time.Time `db:"modified_on" json:"-"`
+}
+
+// Artist of the music catalogue, the artist of an album being its album artist when its tracks have one
+type Artist struct {
+	Name   string `db:"name" json:"name"`
+	Albums int    `db:"albums" json:"albums"`
+	Tracks int    `db:"tracks" json:"tracks"`
+}
+
+// Album of the music catalogue. CoverTrackID is a track of the album holding a cover, if any.
+type Album struct {
+	Name         string  `db:"name" json:"name"`
+	Artist       string  `db:"artist" json:"artist"`
+	Year         int     `db:"year" json:"year"`
+	Tracks       int     `db:"tracks" json:"tracks"`
+	Duration     float64 `db:"duration" json:"duration"`
+	CoverTrackID *int    `db:"cover_track_id" json:"coverTrackId"`
+}
+
+// The artist of a track in the catalogue
+const trackArtist = "COALESCE(NULLIF(album_artist, ''), artist)"
+
+// SaveTrack function, the tags replace the ones previously saved for the path
+func SaveTrack(track Track) error {
+	_, err := db.DB.Exec(
+		`INSERT INTO tracks (user_id, path, title, artist, album_artist, album, track_number, disc_number, year, genre, duration, has_cover, modified_on)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (user_id, path) DO UPDATE SET title = EXCLUDED.title, artist = EXCLUDED.artist, album_artist = EXCLUDED.album_artist,
+			album = EXCLUDED.album, track_number = EXCLUDED.track_number, disc_number = EXCLUDED.disc_number, year = EXCLUDED.year,
+			genre = EXCLUDED.genre, duration = EXCLUDED.duration, has_cover = EXCLUDED.has_cover, modified_on = EXCLUDED.modified_on,
+			indexed_on = now()`,
+		track.UserID, track.Path, track.Title, track.Artist, track.AlbumArtist, track.Album, track.TrackNumber, track.DiscNumber,
+		track.Year, track.Genre, track.Duration, track.HasCover, track.ModifiedOn)
+	return err
+}
+
+// DeleteTracks function, removes a path and every track under it
+func DeleteTracks(userID int, path string) error {
+	_, err := db.DB.Exec(
+		"DELETE FROM tracks WHERE user_id = $1 AND (path = $2 OR path LIKE $3)",
+		userID, path, childrenPattern(path))
+	return err
+}
+
+// MoveTracks function, the tracks under the source path are moved under the target path
+func MoveTracks(userID int, source string, target string) error {
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"DELETE FROM tracks WHERE user_id = $1 AND (path = $2 OR path LIKE $3)",
+		userID, target, childrenPattern(target))
+	if err == nil {
+		_, err = tx.Exec(
+			`UPDATE tracks SET path = $3::text || substr(path, length($2::text) + 1)
+			WHERE user_id = $1 AND (path = $2 OR path LIKE $4)`,
+			userID, source, target, childrenPattern(source))
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetTrackDates function, returns the modification date of the tracks under a path when they were saved, by path.
+// The dates are returned as they were saved, without time zone.
+func GetTrackDates(userID int, path string) (map[string]time.Time, error) {
+	tracks := []Track{}
+	err := db.DB.Select(&tracks,
+		"SELECT path, modified_on FROM tracks WHERE user_id = $1 AND (path = $2 OR path LIKE $3)",
+		userID, path, childrenPattern(path))
+
+	var dates = map[string]time.Time{}
+	for _, track := range tracks {
+		dates[track.Path] = track.ModifiedOn
+	}
+	return dates, err
+}
+
+// GetTrack func model
+func GetTrack(userID int, ID int) (Track, error) {
+	var track Track
+	err := db.DB.Get(&track,
+		`SELECT	id, user_id, path, title, artist, album_artist, album, track_number, disc_number, year, genre, duration, has_cover, modified_on
+		FROM tracks WHERE user_id = $1 AND id = $2`,
+		userID, ID)
+	return track, err
+}
+
+// GetArtists func model, sorted by name
+func GetArtists(userID int) ([]Artist, error) {
+	artists := []Artist{}
+	err := db.DB.Select(&artists,
+		`SELECT	`+trackArtist+` AS name,
+				count(DISTINCT album) AS albums,
+				count(*) AS tracks
+		FROM tracks WHERE user_id = $1
+		GROUP BY `+trackArtist+` ORDER BY lower(`+trackArtist+`), `+trackArtist,
+		userID)
+	return artists, err
+}
+
+// GetAlbums func model, the albums of an artist, or of every artist when it is nil, sorted by artist, year and name
+func GetAlbums(userID int, artist *string) ([]Album, error) {
+	albums := []Album{}
+	err := db.DB.Select(&albums,
+		`SELECT	album AS name,
+				`+trackArtist+` AS artist,
+				COALESCE(MAX(year), 0) AS year,
+				count(*) AS tracks,
+				SUM(duration) AS duration,
+				MIN(id) FILTER (WHERE has_cover) AS cover_track_id
+		FROM tracks WHERE user_id = $1 AND ($2::text IS NULL OR `+trackArtist+` = $2::text)
+		GROUP BY `+trackArtist+`, album ORDER BY lower(`+trackArtist+`), year, lower(album), album`,
+		userID, artist)
+	return albums, err
+}
+
+// GetTracks func model, the tracks of an artist and of an album when they are not nil, in the order of the albums
+func GetTracks(userID int, artist *string, album *string) ([]Track, error) {
+	tracks := []Track{}
+	err := db.DB.Select(&tracks,
+		`SELECT	id, user_id, path, title, artist, album_artist, album, track_number, disc_number, year, genre, duration, has_cover, modified_on
+		FROM tracks WHERE user_id = $1 AND ($2::text IS NULL OR `+trackArtist+` = $2::text) AND ($3::text IS NULL OR album = $3::text)
+		ORDER BY lower(`+trackArtist+`), lower(album), disc_number, track_number, lower(title), path`,
+		userID, artist, album)
+	return tracks, err
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"rakoon/rakoon-back/db"
+	"time"
+)
+
+// TrashItem is an item deleted by a user, kept in his trash until it is restored or purged
+type TrashItem struct {
+	ID           int       `db:"id" json:"id"`
+	UserID       int       `db:"user_id" json:"userId"`
+	OriginalPath string    `db:"original_path" json:"originalPath"`
+	Name         string    `db:"name" json:"name"`
+	IsDir        bool      `db:"is_dir" json:"isDir"`
+	Size         int64     `db:"size" json:"size"`
+	DeletedOn    time.Time `db:"deleted_on" json:"deletedOn"`
+}
+
+// TrashRestore input of a trash item restoration
+type TrashRestore struct {
+	Conflict string `json:"conflict"`
+}
+
+// CreateTrashItem function
+func CreateTrashItem(item TrashItem) (int, error) {
+	var ID int
+	err := db.DB.Get(&ID,
+		`INSERT INTO trash (user_id, original_path, name, is_dir, size)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		item.UserID, item.OriginalPath, item.Name, item.IsDir, item.Size)
+	return ID, err
+}
+
+// GetTrashItem func model
+func GetTrashItem(ID int) (TrashItem, error) {
+	var item TrashItem
+	err := db.DB.Get(&item,
+		`SELECT	id,
+					user_id,
+					original_path,
+					name,
+					is_dir,
+					size,
+					deleted_on::timestamp with time zone
+		FROM trash WHERE id = $1`,
+		ID)
+	return item, err
+}
+
+// GetTrashList func model
+func GetTrashList(userID int) ([]TrashItem, error) {
+	items := []TrashItem{}
+	err := db.DB.Select(&items,
+		`SELECT	id,
+					user_id,
+					original_path,
+					name,
+					is_dir,
+					size,
+					deleted_on::timestamp with time zone
+		FROM trash WHERE user_id = $1 ORDER BY deleted_on DESC`,
+		userID)
+	return items, err
+}
+
+// GetExpiredTrashItems func model, the items deleted for longer than the retention
+func GetExpiredTrashItems(retention time.Duration) ([]TrashItem, error) {
+	items := []TrashItem{}
+	err := db.DB.Select(&items,
+		`SELECT	id,
+					user_id,
+					original_path,
+					name,
+					is_dir,
+					size,
+					deleted_on::timestamp with time zone
+		FROM trash WHERE deleted_on < now() - $1 * interval '1 second'`,
+		retention.Seconds())
+	return items, err
+}
+
+// DeleteTrashItem function
+func DeleteTrashItem(ID int) {
+	tx := db.DB.MustBegin()
+	tx.MustExec("DELETE FROM trash WHERE id = $1", ID)
+	tx.Commit()
+}
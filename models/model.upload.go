@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Upload represents a resumable upload in progress. The owner is the user whose space receives the file, the uploader or the owner of a shared folder.
+type Upload struct {
+	ID        string    `json:"id"`
+	UserID    int       `json:"userId"`
+	OwnerID   int       `json:"ownerId"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"offset"`
+	FileName  string    `json:"fileName"`
+	Path      string    `json:"path"`
+	CreatedOn time.Time `json:"createdOn"`
+}
@@ -17,7 +17,7 @@ type User struct {
 	LastLogin  time.Time    `db:"last_login" json:"last_login"`
 	ArchivedOn sql.NullTime `db:"archived_on" json:"archived_on"`
 	// ArchivedOn time.Time `db:"archived_on" json:"archived_on"`
-	IsAdmin bool `db:"is_admin" json:"is_admin"`
+	Quota *int64 `db:"quota" json:"quota"`
 }
 
 // UserPublic object
@@ -51,6 +51,11 @@ type UserUpdate struct {
 	Name string `db:"name" json:"name" binding:"required"`
 }
 
+// UserQuota input for a user's storage quota, in bytes. A null quota means unlimited.
+type UserQuota struct {
+	Quota *int64 `json:"quota"`
+}
+
 // UserPassword input for user's password
 type UserPassword struct {
 	ID       string `db:"id" json:"id"`
@@ -67,22 +72,13 @@ func GetUserByName(name string) (User, error) {
 					salt,
 					reauth,
 					created_on::timestamp with time zone,
-					last_login::timestamp with time zone,
-					is_admin
+					last_login::timestamp with time zone
 		FROM users
 		WHERE name = $1 AND archived_on IS NULL`,
 		name)
 	return user, err
 }
 
-// IsAdmin func
-func IsAdmin(ID int) (bool, error) {
-	var user User
-	err := db.DB.Get(&user,
-		"SELECT is_admin FROM users where id = $1", ID)
-	return user.IsAdmin, err
-}
-
 // GetList func model
 func GetList() ([]User, error) {
 	users := []User{}
@@ -90,10 +86,10 @@ func GetList() ([]User, error) {
 		`SELECT	id,
 					name,
 					reauth,
-					is_admin,
 					created_on::timestamp with time zone,
 					last_login::timestamp with time zone,
-					archived_on::timestamp with time zone
+					archived_on::timestamp with time zone,
+					quota
 		FROM users ORDER BY id ASC`,
 	)
 	return users, err
@@ -109,8 +105,7 @@ func GetUserByID(ID int) (User, error) {
 					salt,
 					reauth,
 					created_on::timestamp with time zone,
-					last_login::timestamp with time zone,
-					is_admin
+					last_login::timestamp with time zone
 		FROM users WHERE id = $1`,
 		ID)
 	return user, err
@@ -130,6 +125,20 @@ func GetUserPublic(ID string) (UserPublic, error) {
 	return user, err
 }
 
+// GetUserQuota func model
+func GetUserQuota(ID int) (sql.NullInt64, error) {
+	var quota sql.NullInt64
+	err := db.DB.Get(&quota, "SELECT quota FROM users WHERE id = $1", ID)
+	return quota, err
+}
+
+// UpdateUserQuota func
+func UpdateUserQuota(ID string, quota *int64) {
+	tx := db.DB.MustBegin()
+	tx.MustExec("UPDATE users SET quota = $1 WHERE id = $2", quota, ID)
+	tx.Commit()
+}
+
 // RefreshUserConnection func
 func RefreshUserConnection(userName string, value bool) {
 	tx := db.DB.MustBegin()
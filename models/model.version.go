@@ -0,0 +1,78 @@
+package models
+
+import (
+	"rakoon/rakoon-back/db"
+	"time"
+)
+
+// FileVersion is a previous content of a file, kept when the file was overwritten
+type FileVersion struct {
+	ID        int       `db:"id" json:"id"`
+	UserID    int       `db:"user_id" json:"userId"`
+	Path      string    `db:"path" json:"path"`
+	Version   int       `db:"version" json:"version"`
+	Size      int64     `db:"size" json:"size"`
+	CreatedOn time.Time `db:"created_on" json:"createdOn"`
+}
+
+// CreateFileVersion function, the version number follows the last version of the path
+func CreateFileVersion(version FileVersion) (FileVersion, error) {
+	err := db.DB.Get(&version,
+		`INSERT INTO file_versions (user_id, path, version, size)
+		VALUES ($1, $2, (SELECT COALESCE(MAX(version), 0) + 1 FROM file_versions WHERE user_id = $1 AND path = $2), $3)
+		RETURNING id, version, created_on::timestamp with time zone`,
+		version.UserID, version.Path, version.Size)
+	return version, err
+}
+
+// GetFileVersion func model
+func GetFileVersion(ID int) (FileVersion, error) {
+	var version FileVersion
+	err := db.DB.Get(&version,
+		`SELECT	id,
+					user_id,
+					path,
+					version,
+					size,
+					created_on::timestamp with time zone
+		FROM file_versions WHERE id = $1`,
+		ID)
+	return version, err
+}
+
+// GetFileVersions func model, the most recent version first
+func GetFileVersions(userID int, path string) ([]FileVersion, error) {
+	versions := []FileVersion{}
+	err := db.DB.Select(&versions,
+		`SELECT	id,
+					user_id,
+					path,
+					version,
+					size,
+					created_on::timestamp with time zone
+		FROM file_versions WHERE user_id = $1 AND path = $2 ORDER BY version DESC`,
+		userID, path)
+	return versions, err
+}
+
+// GetExpiredFileVersions func model, the versions older than the maximum age
+func GetExpiredFileVersions(maxAge time.Duration) ([]FileVersion, error) {
+	versions := []FileVersion{}
+	err := db.DB.Select(&versions,
+		`SELECT	id,
+					user_id,
+					path,
+					version,
+					size,
+					created_on::timestamp with time zone
+		FROM file_versions WHERE created_on < now() - $1 * interval '1 second'`,
+		maxAge.Seconds())
+	return versions, err
+}
+
+// DeleteFileVersion function
+func DeleteFileVersion(ID int) {
+	tx := db.DB.MustBegin()
+	tx.MustExec("DELETE FROM file_versions WHERE id = $1", ID)
+	tx.Commit()
+}
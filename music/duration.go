@@ -0,0 +1,272 @@
+package music
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrNoDuration is returned when the duration of an audio file can not be found in its headers
+var ErrNoDuration = errors.New("the duration of the audio file is unknown")
+
+// The end of an Ogg file is read to find its last page, which is at most this long
+const oggTailSize = 65536 + 27 + 255
+
+// Duration reads the duration in seconds of an audio file from its headers, its format is given by its extension
+func Duration(r io.ReadSeeker, size int64, extension string) (float64, error) {
+	switch extension {
+	case ".flac":
+		return flacDuration(r)
+	case ".ogg":
+		return oggDuration(r, size)
+	case ".m4a":
+		return mp4Duration(r, size)
+	case ".mp3":
+		return mp3Duration(r, size)
+	}
+	return 0, ErrNoDuration
+}
+
+// The STREAMINFO block, always the first one, holds the sample rate and the number of samples
+func flacDuration(r io.Reader) (float64, error) {
+	var header = make([]byte, 4+4+34)
+	_, err := io.ReadFull(r, header)
+	if err != nil || string(header[:4]) != "fLaC" || header[4]&0x7f != 0 {
+		return 0, ErrNoDuration
+	}
+
+	var info []byte = header[8:]
+	var sampleRate uint64 = uint64(info[10])<<12 | uint64(info[11])<<4 | uint64(info[12])>>4
+	var samples uint64 = uint64(info[13]&0x0f)<<32 | uint64(binary.BigEndian.Uint32(info[14:18]))
+	if sampleRate <= 0 || samples <= 0 {
+		return 0, ErrNoDuration
+	}
+	return float64(samples) / float64(sampleRate), nil
+}
+
+// The sample rate is in the identification header of the first page, the position of the last page is its number of samples
+func oggDuration(r io.ReadSeeker, size int64) (float64, error) {
+	var head = make([]byte, 512)
+	n, _ := io.ReadFull(r, head)
+	head = head[:n]
+
+	var sampleRate uint32
+	var preSkip uint16
+	if i := bytes.Index(head, []byte("\x01vorbis")); i >= 0 && len(head) >= i+16 {
+		sampleRate = binary.LittleEndian.Uint32(head[i+12 : i+16])
+	} else if i := bytes.Index(head, []byte("OpusHead")); i >= 0 && len(head) >= i+12 {
+		// Opus is always decoded at 48 kHz, the first samples are dropped
+		sampleRate = 48000
+		preSkip = binary.LittleEndian.Uint16(head[i+10 : i+12])
+	}
+	if sampleRate <= 0 {
+		return 0, ErrNoDuration
+	}
+
+	var offset int64 = size - oggTailSize
+	if offset < 0 {
+		offset = 0
+	}
+	_, err := r.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	tail, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var last int = bytes.LastIndex(tail, []byte("OggS"))
+	if last < 0 || len(tail) < last+14 {
+		return 0, ErrNoDuration
+	}
+	var granule int64 = int64(binary.LittleEndian.Uint64(tail[last+6:last+14])) - int64(preSkip)
+	if granule <= 0 {
+		return 0, ErrNoDuration
+	}
+	return float64(granule) / float64(sampleRate), nil
+}
+
+// The movie header box, inside the movie box, holds the time scale and the duration
+func mp4Duration(r io.ReadSeeker, size int64) (float64, error) {
+	moov, moovSize, err := findBox(r, 0, size, "moov")
+	if err != nil {
+		return 0, err
+	}
+	mvhd, _, err := findBox(r, moov, moov+moovSize, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = r.Seek(mvhd, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	var header = make([]byte, 32)
+	_, err = io.ReadFull(r, header)
+	if err != nil {
+		return 0, ErrNoDuration
+	}
+
+	var timeScale uint32
+	var duration uint64
+	if header[0] == 1 {
+		timeScale = binary.BigEndian.Uint32(header[20:24])
+		duration = binary.BigEndian.Uint64(header[24:32])
+	} else {
+		timeScale = binary.BigEndian.Uint32(header[12:16])
+		duration = uint64(binary.BigEndian.Uint32(header[16:20]))
+	}
+	if timeScale <= 0 {
+		return 0, ErrNoDuration
+	}
+	return float64(duration) / float64(timeScale), nil
+}
+
+// This function finds a box between two offsets, and returns the offset and the size of its content
+func findBox(r io.ReadSeeker, start int64, end int64, name string) (int64, int64, error) {
+	var header = make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		_, err := r.Seek(offset, io.SeekStart)
+		if err != nil {
+			return 0, 0, err
+		}
+		_, err = io.ReadFull(r, header[:8])
+		if err != nil {
+			return 0, 0, ErrNoDuration
+		}
+
+		var boxSize int64 = int64(binary.BigEndian.Uint32(header[:4]))
+		var headerSize int64 = 8
+		if boxSize == 1 {
+			_, err = io.ReadFull(r, header[8:16])
+			if err != nil {
+				return 0, 0, ErrNoDuration
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		} else if boxSize == 0 {
+			boxSize = end - offset
+		}
+		if boxSize < headerSize {
+			return 0, 0, ErrNoDuration
+		}
+
+		if string(header[4:8]) == name {
+			return offset + headerSize, boxSize - headerSize, nil
+		}
+		offset += boxSize
+	}
+	return 0, 0, ErrNoDuration
+}
+
+// MPEG audio frames, indexed by version and layer
+var (
+	// Bit rates in kbit/s, for MPEG 1 and MPEG 2 or 2.5, by layer and index
+	mpeg1BitRates = [3][16]int{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	}
+	mpeg2BitRates = [3][16]int{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	}
+	// Sample rates of MPEG 1, halved for MPEG 2 and quartered for MPEG 2.5
+	mpeg1SampleRates = [3]int{44100, 48000, 32000}
+)
+
+// The number of frames is given by the Xing or VBRI header of the variable bit rate files,
+// the duration of the other ones is computed from their size and bit rate
+func mp3Duration(r io.ReadSeeker, size int64) (float64, error) {
+	var start int64
+	var id3 = make([]byte, 10)
+	if _, err := io.ReadFull(r, id3); err == nil && string(id3[:3]) == "ID3" {
+		start = int64(id3[6]&0x7f)<<21 | int64(id3[7]&0x7f)<<14 | int64(id3[8]&0x7f)<<7 | int64(id3[9]&0x7f) + 10
+		if id3[5]&0x10 != 0 {
+			start += 10
+		}
+	}
+
+	// The first frame is searched in the beginning of the audio data
+	_, err := r.Seek(start, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	var data = make([]byte, 16384)
+	n, _ := io.ReadFull(r, data)
+	data = data[:n]
+
+	for i := 0; i+4 <= len(data); i++ {
+		if data[i] != 0xff || data[i+1]&0xe0 != 0xe0 {
+			continue
+		}
+		var version int = int(data[i+1]>>3) & 0x03
+		var layer int = int(data[i+1]>>1) & 0x03
+		var bitRateIndex int = int(data[i+2] >> 4)
+		var sampleRateIndex int = int(data[i+2]>>2) & 0x03
+		if version == 1 || layer == 0 || bitRateIndex == 0 || bitRateIndex == 15 || sampleRateIndex == 3 {
+			continue
+		}
+
+		var mpeg1 bool = version == 3
+		var sampleRate int = mpeg1SampleRates[sampleRateIndex]
+		var bitRate int
+		var samplesPerFrame int
+		// Layers are numbered from 3 to 1 in the header
+		if mpeg1 {
+			bitRate = mpeg1BitRates[3-layer][bitRateIndex]
+			samplesPerFrame = []int{0, 1152, 1152, 384}[layer]
+		} else {
+			bitRate = mpeg2BitRates[3-layer][bitRateIndex]
+			samplesPerFrame = []int{0, 576, 1152, 384}[layer]
+			sampleRate /= 2
+			if version == 0 {
+				sampleRate /= 2
+			}
+		}
+
+		var mono bool = data[i+3]>>6 == 3
+		var sideInfo int = 32
+		if mpeg1 && mono {
+			sideInfo = 17
+		} else if !mpeg1 && !mono {
+			sideInfo = 17
+		} else if !mpeg1 {
+			sideInfo = 9
+		}
+
+		if frames := vbrFrames(data[i:], sideInfo); frames > 0 {
+			return float64(frames) * float64(samplesPerFrame) / float64(sampleRate), nil
+		}
+
+		// An ID3v1 tag takes the last 128 bytes
+		var audioSize int64 = size - start - int64(i)
+		var tag = make([]byte, 3)
+		if _, err := r.Seek(size-128, io.SeekStart); err == nil && size >= 128 {
+			if _, err := io.ReadFull(r, tag); err == nil && string(tag) == "TAG" {
+				audioSize -= 128
+			}
+		}
+		return float64(audioSize) * 8 / float64(bitRate*1000), nil
+	}
+	return 0, ErrNoDuration
+}
+
+// This function reads the number of frames of a Xing, Info or VBRI header in the first frame
+func vbrFrames(frame []byte, sideInfo int) uint32 {
+	var xing int = 4 + sideInfo
+	if len(frame) >= xing+12 {
+		var tag string = string(frame[xing : xing+4])
+		if (tag == "Xing" || tag == "Info") && frame[xing+7]&0x01 != 0 {
+			return binary.BigEndian.Uint32(frame[xing+8 : xing+12])
+		}
+	}
+	var vbri int = 4 + 32
+	if len(frame) >= vbri+18 && string(frame[vbri:vbri+4]) == "VBRI" {
+		return binary.BigEndian.Uint32(frame[vbri+14 : vbri+18])
+	}
+	return 0
+}
@@ -0,0 +1,92 @@
+package music
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/storage"
+	"strings"
+	"time"
+
+	"github.com/dhowden/tag"
+)
+
+// ErrNoCover is returned for the audio files without an embedded picture
+var ErrNoCover = errors.New("the audio file has no cover")
+
+// Supported checks if a file is an audio file, from its name
+func Supported(name string) bool {
+	return storage.FileType(name) == storage.TypeAudio
+}
+
+// Extract reads the tags and the duration of an audio file. A file without title is titled after its name.
+func Extract(path string) (models.Track, error) {
+	var track models.Track
+	file, err := os.Open(path)
+	if err != nil {
+		return track, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return track, err
+	}
+	track.ModifiedOn = fileInfo.ModTime().Round(time.Microsecond)
+
+	metadata, err := readTags(file)
+	if err == nil {
+		track.Title = clean(metadata.Title())
+		track.Artist = clean(metadata.Artist())
+		track.AlbumArtist = clean(metadata.AlbumArtist())
+		track.Album = clean(metadata.Album())
+		track.TrackNumber, _ = metadata.Track()
+		track.DiscNumber, _ = metadata.Disc()
+		track.Year = metadata.Year()
+		track.Genre = clean(metadata.Genre())
+		track.HasCover = metadata.Picture() != nil && len(metadata.Picture().Data) > 0
+	}
+	if len(track.Title) <= 0 {
+		track.Title = strings.TrimSuffix(fileInfo.Name(), filepath.Ext(fileInfo.Name()))
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return track, err
+	}
+	// A file without duration is still listed
+	track.Duration, _ = Duration(file, fileInfo.Size(), strings.ToLower(filepath.Ext(fileInfo.Name())))
+	return track, nil
+}
+
+// Cover returns the picture embedded in an audio file
+func Cover(path string) (*tag.Picture, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	metadata, err := readTags(file)
+	if err != nil || metadata.Picture() == nil || len(metadata.Picture().Data) <= 0 {
+		return nil, ErrNoCover
+	}
+	return metadata.Picture(), nil
+}
+
+// The tag parser trusts the sizes it reads, a malformed file could make it panic
+func readTags(r io.ReadSeeker) (metadata tag.Metadata, err error) {
+	defer func() {
+		if recover() != nil {
+			metadata, err = nil, tag.ErrNoTagsFound
+		}
+	}()
+	return tag.ReadFrom(r)
+}
+
+// The tags are padded with spaces or NUL characters by some taggers
+func clean(value string) string {
+	return strings.TrimSpace(strings.Trim(value, "\x00"))
+}
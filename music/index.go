@@ -0,0 +1,31 @@
+package music
+
+import (
+	"rakoon/rakoon-back/indexer"
+	"rakoon/rakoon-back/models"
+)
+
+// The catalogue follows the changes published on the event bus
+var index = indexer.NewCatalog("music catalogue", indexer.Catalog{
+	Supported: Supported,
+	Dates:     models.GetTrackDates,
+	Save:      save,
+	Delete:    models.DeleteTracks,
+	Move:      models.MoveTracks,
+})
+
+// Reindex reads the tags of the audio files of a user's whole home, the unchanged ones are skipped
+func Reindex(userID int) error {
+	return index.Reindex(userID)
+}
+
+// An audio file whose tags can not be read is removed from the catalogue
+func save(userID int, clientPath string, path string) error {
+	track, err := Extract(path)
+	if err != nil {
+		return models.DeleteTracks(userID, clientPath)
+	}
+	track.UserID = userID
+	track.Path = clientPath
+	return models.SaveTrack(track)
+}
@@ -0,0 +1,154 @@
+package photos
+
+import (
+	"errors"
+	"image"
+	"io"
+	"math"
+	"os"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/storage"
+	"strings"
+	"time"
+
+	// The decoders of the supported formats, all written in Go
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// ErrNotPhoto is returned for the files which are not images that can be decoded
+var ErrNotPhoto = errors.New("the file is not a supported image")
+
+// The layout of the EXIF dates, which carry no time zone
+const exifDateLayout = "2006:01:02 15:04:05"
+
+// Supported checks if a file is an image, from its name
+func Supported(name string) bool {
+	return storage.FileType(name) == storage.TypeImage
+}
+
+// Extract reads the dimensions of an image, and the capture date, camera and position its EXIF metadata hold.
+// The dimensions are the ones of the image turned upright.
+func Extract(path string) (models.Photo, error) {
+	var photo models.Photo
+	file, err := os.Open(path)
+	if err != nil {
+		return photo, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return photo, err
+	}
+	photo.ModifiedOn = fileInfo.ModTime().Round(time.Microsecond)
+
+	// Only the header of the image is decoded
+	config, format, err := image.DecodeConfig(file)
+	if err != nil || config.Width <= 0 || config.Height <= 0 {
+		return photo, ErrNotPhoto
+	}
+	photo.Width = config.Width
+	photo.Height = config.Height
+
+	if format != "jpeg" && format != "tiff" {
+		return photo, nil
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return photo, err
+	}
+	data := decodeExif(file)
+	if data != nil {
+		describe(&photo, data)
+	}
+	return photo, nil
+}
+
+// Orientation reads the EXIF orientation of an image, from 1 to 8, 1 being upright
+func Orientation(r io.Reader) int {
+	return orientation(decodeExif(r))
+}
+
+// The EXIF parser trusts the offsets it reads, a malformed file could make it panic
+func decodeExif(r io.Reader) (data *exif.Exif) {
+	defer func() {
+		if recover() != nil {
+			data = nil
+		}
+	}()
+
+	data, err := exif.Decode(r)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func orientation(data *exif.Exif) int {
+	if data == nil {
+		return 1
+	}
+	tag, err := data.Get(exif.Orientation)
+	if err != nil || tag.Count < 1 {
+		return 1
+	}
+	value, err := tag.Int(0)
+	if err != nil || value < 1 || value > 8 {
+		return 1
+	}
+	return value
+}
+
+func describe(photo *models.Photo, data *exif.Exif) {
+	defer func() {
+		recover()
+	}()
+
+	// The orientations from 5 to 8 swap the width and the height
+	if orientation(data) >= 5 {
+		photo.Width, photo.Height = photo.Height, photo.Width
+	}
+
+	photo.CameraMake = text(data, exif.Make)
+	photo.CameraModel = text(data, exif.Model)
+
+	for _, field := range []exif.FieldName{exif.DateTimeOriginal, exif.DateTimeDigitized} {
+		if value := text(data, field); value != nil {
+			takenOn, err := time.ParseInLocation(exifDateLayout, *value, time.Local)
+			if err == nil && takenOn.Year() > 1 {
+				photo.TakenOn = &takenOn
+				break
+			}
+		}
+	}
+
+	latitude, longitude, err := data.LatLong()
+	var valid bool = err == nil && !math.IsNaN(latitude) && !math.IsNaN(longitude) &&
+		math.Abs(latitude) <= 90 && math.Abs(longitude) <= 180 && (latitude != 0 || longitude != 0)
+	if valid {
+		photo.Latitude = &latitude
+		photo.Longitude = &longitude
+	}
+}
+
+// The EXIF texts are padded with spaces or NUL characters by some cameras
+func text(data *exif.Exif, field exif.FieldName) *string {
+	tag, err := data.Get(field)
+	if err != nil {
+		return nil
+	}
+	value, err := tag.StringVal()
+	value = strings.TrimSpace(strings.Trim(value, "\x00"))
+	if err != nil || len(value) <= 0 {
+		return nil
+	}
+	return &value
+}
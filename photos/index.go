@@ -0,0 +1,31 @@
+package photos
+
+import (
+	"rakoon/rakoon-back/indexer"
+	"rakoon/rakoon-back/models"
+)
+
+// The photos follow the changes published on the event bus
+var index = indexer.NewCatalog("photos", indexer.Catalog{
+	Supported: Supported,
+	Dates:     models.GetPhotoDates,
+	Save:      save,
+	Delete:    models.DeletePhotos,
+	Move:      models.MovePhotos,
+})
+
+// Reindex reads the metadata of the images of a user's whole home, the unchanged ones are skipped
+func Reindex(userID int) error {
+	return index.Reindex(userID)
+}
+
+// An image whose metadata can not be read is removed from the photos
+func save(userID int, clientPath string, path string) error {
+	photo, err := Extract(path)
+	if err != nil {
+		return models.DeletePhotos(userID, clientPath)
+	}
+	photo.UserID = userID
+	photo.Path = clientPath
+	return models.SavePhoto(photo)
+}
@@ -0,0 +1,93 @@
+package photos
+
+import (
+	"errors"
+	"path"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/search"
+	"rakoon/rakoon-back/storage"
+	"strings"
+)
+
+// Groups of the timeline
+const (
+	GroupYear  = "year"
+	GroupMonth = "month"
+	GroupDay   = "day"
+)
+
+// ErrUnknownGroup is returned for a group which is not a year, a month or a day
+var ErrUnknownGroup = errors.New("unknown timeline group")
+
+// The keys of the groups, formatted by Go and by postgres
+var keyLayouts = map[string]string{GroupYear: "2006", GroupMonth: "2006-01", GroupDay: "2006-01-02"}
+var keyPatterns = map[string]string{GroupYear: "YYYY", GroupMonth: "YYYY-MM", GroupDay: "YYYY-MM-DD"}
+
+// Timeline returns a page of the photos under a client path, the most recent first, grouped by year, month or day,
+// and the total number of photos. From the root of the home, the photos of the folders shared with the user are listed too.
+func Timeline(userID int, clientPath string, group string, limit int, offset int) ([]models.TimelineGroup, int, error) {
+	var groups = []models.TimelineGroup{}
+	layout, ok := keyLayouts[group]
+	if !ok {
+		return groups, 0, ErrUnknownGroup
+	}
+
+	searchAreas, err := search.Areas(userID, clientPath)
+	if err != nil {
+		return groups, 0, err
+	}
+	var areas []models.PhotoArea
+	for _, area := range searchAreas {
+		under, err := storage.Relative(area.OwnerID, area.Path)
+		if err != nil {
+			return groups, 0, err
+		}
+		areas = append(areas, models.PhotoArea{UserID: area.OwnerID, Path: under})
+	}
+
+	total, err := models.CountTimelinePhotos(areas)
+	if err != nil {
+		return groups, 0, err
+	}
+	photos, err := models.GetTimelinePhotos(areas, limit, offset)
+	if err != nil {
+		return groups, 0, err
+	}
+
+	var keys []string
+	for _, photo := range photos {
+		photo.Path = visiblePath(photo, areas, searchAreas)
+		var key string = photo.Date.Format(layout)
+		if len(groups) <= 0 || groups[len(groups)-1].Key != key {
+			groups = append(groups, models.TimelineGroup{Key: key})
+			keys = append(keys, key)
+		}
+		groups[len(groups)-1].Photos = append(groups[len(groups)-1].Photos, photo)
+	}
+	if len(keys) <= 0 {
+		return groups, total, nil
+	}
+
+	// The groups at the edges of the page may have photos on the other pages
+	counts, err := models.CountTimelineGroups(areas, keyPatterns[group], keys)
+	if err != nil {
+		return groups, total, err
+	}
+	for i := range groups {
+		groups[i].Count = counts[groups[i].Key]
+	}
+	return groups, total, nil
+}
+
+// The photos are saved with the path their owner sees, it is changed for the one the user sees
+func visiblePath(photo models.Photo, areas []models.PhotoArea, searchAreas []search.Area) string {
+	for i, area := range areas {
+		if area.UserID != photo.UserID {
+			continue
+		}
+		if photo.Path == area.Path || strings.HasPrefix(photo.Path, strings.TrimSuffix(area.Path, "/")+"/") {
+			return path.Join(searchAreas[i].ClientPath, strings.TrimPrefix(photo.Path, strings.TrimSuffix(area.Path, "/")))
+		}
+	}
+	return photo.Path
+}
@@ -0,0 +1,12 @@
+BEGIN;
+DROP TABLE IF EXISTS file_contents;
+CREATE TABLE file_contents (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    path text NOT NULL,
+    content tsvector NOT NULL,
+    indexed_on timestamp DEFAULT now(),
+    UNIQUE (user_id, path)
+);
+CREATE INDEX file_contents_content ON file_contents USING GIN (content);
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+DROP TABLE IF EXISTS grants;
+CREATE TABLE grants (
+    id serial PRIMARY KEY,
+    owner_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    path text NOT NULL,
+    grantee_id integer DEFAULT NULL REFERENCES users(id) ON DELETE CASCADE,
+    group_id integer DEFAULT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    permission varchar(8) NOT NULL,
+    created_on timestamp DEFAULT now(),
+    CHECK ((grantee_id IS NULL) <> (group_id IS NULL))
+);
+CREATE UNIQUE INDEX grants_unique ON grants (owner_id, path, (COALESCE(grantee_id, 0)), (COALESCE(group_id, 0)));
+CREATE INDEX grants_grantee_id ON grants (grantee_id);
+CREATE INDEX grants_group_id ON grants (group_id);
+COMMIT;
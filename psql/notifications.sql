@@ -0,0 +1,13 @@
+BEGIN;
+DROP TABLE IF EXISTS notifications;
+CREATE TABLE notifications (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type varchar(32) NOT NULL,
+    message text NOT NULL,
+    path text DEFAULT '' NOT NULL,
+    read boolean DEFAULT false NOT NULL,
+    created_on timestamp DEFAULT now()
+);
+CREATE INDEX notifications_user_id ON notifications (user_id);
+COMMIT;
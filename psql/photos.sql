@@ -0,0 +1,19 @@
+BEGIN;
+DROP TABLE IF EXISTS photos;
+CREATE TABLE photos (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    path text NOT NULL,
+    taken_on timestamp,
+    modified_on timestamp NOT NULL,
+    camera_make text,
+    camera_model text,
+    width integer NOT NULL,
+    height integer NOT NULL,
+    latitude double precision,
+    longitude double precision,
+    indexed_on timestamp DEFAULT now(),
+    UNIQUE (user_id, path)
+);
+CREATE INDEX photos_date ON photos (user_id, (COALESCE(taken_on, modified_on)) DESC);
+COMMIT;
@@ -0,0 +1,46 @@
+BEGIN;
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS group_roles;
+DROP TABLE IF EXISTS group_members;
+DROP TABLE IF EXISTS groups CASCADE;
+DROP TABLE IF EXISTS roles;
+CREATE TABLE roles (
+    id serial PRIMARY KEY,
+    name varchar(50) UNIQUE NOT NULL,
+    permissions text[] DEFAULT '{}' NOT NULL,
+    is_default boolean DEFAULT false NOT NULL,
+    created_on timestamp DEFAULT now()
+);
+CREATE TABLE groups (
+    id serial PRIMARY KEY,
+    name varchar(50) UNIQUE NOT NULL,
+    created_on timestamp DEFAULT now()
+);
+CREATE TABLE group_members (
+    group_id integer NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, user_id)
+);
+CREATE TABLE group_roles (
+    group_id integer NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    role_id integer NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    PRIMARY KEY (group_id, role_id)
+);
+CREATE TABLE user_roles (
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id integer NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+INSERT INTO roles (name, permissions, is_default) VALUES
+    ('admin', '{manage_users,manage_roles,manage_torrents,unlimited_quota,share_publicly,download_torrents}', false),
+    ('user', '{share_publicly,download_torrents}', true);
+-- The administrators flagged with is_admin before the roles existed are given the admin role
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'is_admin') THEN
+        INSERT INTO user_roles (user_id, role_id)
+            SELECT users.id, roles.id FROM users, roles WHERE users.is_admin AND roles.name = 'admin';
+        ALTER TABLE users DROP COLUMN is_admin;
+    END IF;
+END $$;
+COMMIT;
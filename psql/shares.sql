@@ -0,0 +1,19 @@
+BEGIN;
+DROP TABLE IF EXISTS shares;
+CREATE TABLE shares (
+    id serial PRIMARY KEY,
+    token varchar(64) UNIQUE NOT NULL,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    path text NOT NULL,
+    is_dir boolean NOT NULL,
+    kind varchar(16) DEFAULT 'download' NOT NULL,
+    password varchar(255) DEFAULT NULL,
+    expires_on timestamptz DEFAULT NULL,
+    max_downloads integer DEFAULT NULL,
+    downloads integer DEFAULT 0 NOT NULL,
+    max_size bigint DEFAULT NULL,
+    allowed_types text DEFAULT '' NOT NULL,
+    created_on timestamp DEFAULT now()
+);
+CREATE INDEX shares_user_id ON shares (user_id);
+COMMIT;
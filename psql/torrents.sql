@@ -0,0 +1,25 @@
+BEGIN;
+DROP TABLE IF EXISTS torrents;
+CREATE TABLE torrents (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    owner_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    info_hash text NOT NULL,
+    name text NOT NULL,
+    path text NOT NULL,
+    owner_path text NOT NULL,
+    metainfo bytea,
+    magnet text DEFAULT '' NOT NULL,
+    files text[],
+    select_files boolean DEFAULT false NOT NULL,
+    seed boolean DEFAULT false NOT NULL,
+    state text NOT NULL,
+    total bigint DEFAULT 0 NOT NULL,
+    completed bigint DEFAULT 0 NOT NULL,
+    error text DEFAULT '' NOT NULL,
+    created_on timestamp DEFAULT now(),
+    finished_on timestamp
+);
+CREATE INDEX torrents_user ON torrents (user_id);
+CREATE INDEX torrents_state ON torrents (state);
+COMMIT;
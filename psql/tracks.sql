@@ -0,0 +1,22 @@
+BEGIN;
+DROP TABLE IF EXISTS tracks;
+CREATE TABLE tracks (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    path text NOT NULL,
+    title text NOT NULL,
+    artist text DEFAULT '' NOT NULL,
+    album_artist text DEFAULT '' NOT NULL,
+    album text DEFAULT '' NOT NULL,
+    track_number integer DEFAULT 0 NOT NULL,
+    disc_number integer DEFAULT 0 NOT NULL,
+    year integer DEFAULT 0 NOT NULL,
+    genre text DEFAULT '' NOT NULL,
+    duration double precision DEFAULT 0 NOT NULL,
+    has_cover boolean DEFAULT false NOT NULL,
+    modified_on timestamp NOT NULL,
+    indexed_on timestamp DEFAULT now(),
+    UNIQUE (user_id, path)
+);
+CREATE INDEX tracks_album ON tracks (user_id, (COALESCE(NULLIF(album_artist, ''), artist)), album);
+COMMIT;
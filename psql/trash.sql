@@ -0,0 +1,13 @@
+BEGIN;
+DROP TABLE IF EXISTS trash;
+CREATE TABLE trash (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    original_path text NOT NULL,
+    name varchar(255) NOT NULL,
+    is_dir boolean NOT NULL,
+    size bigint DEFAULT 0 NOT NULL,
+    deleted_on timestamp DEFAULT now()
+);
+CREATE INDEX trash_user_id ON trash (user_id);
+COMMIT;
@@ -9,7 +9,7 @@ CREATE TABLE users (
     created_on timestamp DEFAULT now(),
     last_login timestamp DEFAULT now(),
     archived_on timestamp DEFAULT NULL,
-    is_admin boolean DEFAULT FALSE NOT NULL
+    quota bigint DEFAULT NULL
 );
 COMMIT;
 
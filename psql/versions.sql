@@ -0,0 +1,12 @@
+BEGIN;
+DROP TABLE IF EXISTS file_versions;
+CREATE TABLE file_versions (
+    id serial PRIMARY KEY,
+    user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    path text NOT NULL,
+    version integer NOT NULL,
+    size bigint DEFAULT 0 NOT NULL,
+    created_on timestamp DEFAULT now(),
+    UNIQUE (user_id, path, version)
+);
+COMMIT;
@@ -0,0 +1,176 @@
+package quota
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/events"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/storage"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrExceeded is returned when a write would exceed the user's quota
+var ErrExceeded = errors.New("storage quota exceeded")
+
+// The bytes used by every user. A user's usage is computed by walking their home, trash and versions the first time it is needed,
+// then it is updated incrementally by the operations writing or removing data.
+var mutex sync.Mutex
+var usages = map[int]int64{}
+
+// The bytes reserved by every user for the writes in progress. They are kept apart from the usages, which can be computed again from the disk at any time,
+// until the write is committed or released.
+var reservations = map[int]int64{}
+
+// The API keeps the usages up to date, the changes made behind its back make them unknown
+func init() {
+	events.Listen(func(event events.Event) {
+		if event.Source == events.SourceWatcher {
+			Invalidate(event.UserID)
+		}
+	})
+}
+
+// Used returns the number of bytes stored for a user, in their home, their trash and the versions of their files
+func Used(userID int) (int64, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return used(userID)
+}
+
+// Reserve accounts for bytes about to be written in a user's home, if their quota allows it.
+// The reservation must be committed once the bytes are written, or released if the write fails.
+func Reserve(userID int, bytes int64) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	usage, err := used(userID)
+	if err != nil {
+		return err
+	}
+	usage += reservations[userID]
+
+	limit, err := models.GetUserQuota(userID)
+	if err != nil {
+		return err
+	}
+	if limit.Valid && usage+bytes > limit.Int64 {
+		unlimited, err := models.HasPermission(userID, models.PermissionUnlimitedQuota)
+		if err != nil {
+			return err
+		} else if !unlimited {
+			return ErrExceeded
+		}
+	}
+
+	reservations[userID] += bytes
+	return nil
+}
+
+// Release gives back bytes reserved for a write that did not happen
+func Release(userID int, bytes int64) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	release(userID, bytes)
+}
+
+// Commit turns reserved bytes into used ones, once they are written
+func Commit(userID int, bytes int64) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	release(userID, bytes)
+	add(userID, bytes)
+}
+
+// Add updates the usage of a user after bytes were written, or removed when negative, without checking the quota
+func Add(userID int, bytes int64) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	add(userID, bytes)
+}
+
+// Invalidate forgets the usage of a user, it will be computed again from the disk.
+// It is used after the operations whose exact effect on the usage is not known. The reservations are kept.
+func Invalidate(userID int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	delete(usages, userID)
+}
+
+// The mutex must be held
+func add(userID int, bytes int64) {
+	usage, ok := usages[userID]
+	if !ok {
+		return
+	}
+	usage += bytes
+	if usage < 0 {
+		usage = 0
+	}
+	usages[userID] = usage
+}
+
+// The mutex must be held
+func release(userID int, bytes int64) {
+	var reserved int64 = reservations[userID] - bytes
+	if reserved > 0 {
+		reservations[userID] = reserved
+	} else {
+		delete(reservations, userID)
+	}
+}
+
+// ReserveContext reserves bytes for the owner of the data a request writes, the authenticated user or the owner of a shared folder.
+// If they can not be reserved, an error is sent and false is returned.
+func ReserveContext(c *gin.Context, userID int, bytes int64) bool {
+	err := Reserve(userID, bytes)
+	if err == ErrExceeded {
+		c.JSON(507, gin.H{
+			"message": "Insufficient storage: this would exceed your quota.",
+		})
+		return false
+	} else if err != nil {
+		c.JSON(500, gin.H{"Could not check quota": err.Error()})
+		return false
+	}
+	return true
+}
+
+// Size returns the total size of the regular files under a path
+func Size(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(path string, fileInfo os.FileInfo, err error) error {
+		if err == nil && fileInfo.Mode().IsRegular() {
+			size += fileInfo.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// The mutex must be held
+func used(userID int) (int64, error) {
+	usage, ok := usages[userID]
+	if ok {
+		return usage, nil
+	}
+
+	home, err := storage.HomeDir(userID)
+	if err != nil {
+		return 0, err
+	}
+	usage = Size(home)
+	// The trash and the versions stay on the disk until they are purged, they are counted too
+	for _, name := range []string{"trash", "versions"} {
+		staging, err := storage.StagingDir(name)
+		if err != nil {
+			return 0, err
+		}
+		usage += Size(filepath.Join(staging, strconv.Itoa(userID)))
+	}
+	usages[userID] = usage
+	return usage, nil
+}
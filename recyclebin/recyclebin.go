@@ -0,0 +1,191 @@
+package recyclebin
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/fileops"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/quota"
+	"rakoon/rakoon-back/storage"
+	"rakoon/rakoon-back/versions"
+	"strconv"
+	"time"
+)
+
+// ErrConflict is returned when an item is restored where another one now exists, and no conflict policy is given
+var ErrConflict = errors.New("an item already exists at the original path")
+
+// Dir returns the directory holding the trashed items of a user, under the server's staging area
+func Dir(userID int) (string, error) {
+	staging, err := storage.StagingDir("trash")
+	if err != nil {
+		return "", err
+	}
+
+	var dir string = filepath.Join(staging, strconv.Itoa(userID))
+	return dir, os.MkdirAll(dir, 0755)
+}
+
+// Trash moves a path of a user's space to his trash, its original path is kept in the database
+func Trash(ctx context.Context, userID int, path string) (models.TrashItem, error) {
+	var item models.TrashItem
+
+	fileInfo, err := os.Lstat(path)
+	if err != nil {
+		return item, err
+	}
+	originalPath, err := storage.Relative(userID, path)
+	if err != nil {
+		return item, err
+	}
+	dir, err := Dir(userID)
+	if err != nil {
+		return item, err
+	}
+
+	item.UserID = userID
+	item.OriginalPath = originalPath
+	item.Name = filepath.Base(path)
+	item.IsDir = fileInfo.IsDir()
+	item.Size = quota.Size(path)
+	item.ID, err = models.CreateTrashItem(item)
+	if err != nil {
+		return item, err
+	}
+
+	report, err := fileops.Move(ctx, path, itemPath(dir, item.ID), fileops.Overwrite, nil)
+	if err == nil && report.Failed() {
+		err = errors.New(report.Errors[0].Path + ": " + report.Errors[0].Error)
+	}
+	if err != nil {
+		models.DeleteTrashItem(item.ID)
+		quota.Invalidate(userID)
+		return item, err
+	}
+	return item, nil
+}
+
+// Restore moves an item back to its original path. The conflict policy is applied if another item took its place.
+func Restore(ctx context.Context, item models.TrashItem, policy string) (fileops.Report, error) {
+	var report fileops.Report
+
+	dir, err := Dir(item.UserID)
+	if err != nil {
+		return report, err
+	}
+	dst, err := storage.Resolve(item.UserID, item.OriginalPath)
+	if err != nil {
+		return report, err
+	}
+
+	_, err = os.Lstat(dst)
+	if err == nil && policy == "" {
+		return report, ErrConflict
+	}
+	if policy == "" {
+		policy = fileops.Overwrite
+	}
+
+	// The original folder may have been removed since
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return report, err
+	}
+
+	report, err = fileops.Move(ctx, itemPath(dir, item.ID), dst, policy, Replacer(ctx, item.UserID))
+	if err != nil || report.Failed() || len(report.Skipped) > 0 {
+		quota.Invalidate(item.UserID)
+		return report, err
+	}
+
+	models.DeleteTrashItem(item.ID)
+	return report, nil
+}
+
+// Replacer keeps the items of a user's space overwritten by an operation: a file becomes a version, anything else is trashed
+func Replacer(ctx context.Context, userID int) fileops.Replacer {
+	return func(path string) error {
+		fileInfo, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if fileInfo.Mode().IsRegular() {
+			return versions.Keep(userID, path)
+		}
+		_, err = Trash(ctx, userID, path)
+		return err
+	}
+}
+
+// Remove permanently deletes a trashed item
+func Remove(ctx context.Context, item models.TrashItem) error {
+	dir, err := Dir(item.UserID)
+	if err != nil {
+		return err
+	}
+
+	report, err := fileops.Delete(ctx, itemPath(dir, item.ID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if report.Failed() {
+		quota.Invalidate(item.UserID)
+		return errors.New(report.Errors[0].Path + ": " + report.Errors[0].Error)
+	}
+
+	quota.Add(item.UserID, -item.Size)
+	models.DeleteTrashItem(item.ID)
+	return nil
+}
+
+// Empty permanently deletes all the items of a user's trash
+func Empty(ctx context.Context, userID int) error {
+	items, err := models.GetTrashList(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		err = Remove(ctx, item)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Purge permanently deletes the items trashed for longer than the retention period
+func Purge(ctx context.Context, retention time.Duration) error {
+	items, err := models.GetExpiredTrashItems(retention)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		err = Remove(ctx, item)
+		if err != nil {
+			log.Println("Could not purge trash item", item.ID, ":", err)
+		}
+	}
+	return nil
+}
+
+// StartPurger purges the expired items in the background, at every interval
+func StartPurger(retention time.Duration, interval time.Duration) {
+	go func() {
+		for {
+			err := Purge(context.Background(), retention)
+			if err != nil {
+				log.Println("Could not purge trash:", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func itemPath(dir string, ID int) string {
+	return filepath.Join(dir, strconv.Itoa(ID))
+}
@@ -3,9 +3,24 @@ package routes
 import (
 	"rakoon/rakoon-back/handlers/authentication"
 	"rakoon/rakoon-back/handlers/desktop"
+	"rakoon/rakoon-back/handlers/grant"
+	"rakoon/rakoon-back/handlers/group"
+	"rakoon/rakoon-back/handlers/job"
+	"rakoon/rakoon-back/handlers/music"
+	"rakoon/rakoon-back/handlers/notification"
+	"rakoon/rakoon-back/handlers/role"
+	"rakoon/rakoon-back/handlers/search"
+	"rakoon/rakoon-back/handlers/share"
+	"rakoon/rakoon-back/handlers/stream"
+	"rakoon/rakoon-back/handlers/thumbnail"
+	"rakoon/rakoon-back/handlers/timeline"
 	"rakoon/rakoon-back/handlers/torrent"
+	"rakoon/rakoon-back/handlers/trash"
+	"rakoon/rakoon-back/handlers/upload"
 	"rakoon/rakoon-back/handlers/user"
+	"rakoon/rakoon-back/handlers/version"
 	"rakoon/rakoon-back/middleware"
+	"rakoon/rakoon-back/models"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -16,13 +31,20 @@ func SetupRouter() *gin.Engine {
 	router := gin.New()
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"*"}
-	config.AllowHeaders = append(config.AllowHeaders, "Authorization")
+	config.AllowHeaders = append(config.AllowHeaders, "Authorization", "Range", "If-Range", "If-None-Match", "If-Modified-Since",
+		"Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset", "Share-Key")
+	config.ExposeHeaders = append(config.ExposeHeaders, "Content-Disposition", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified", "X-Total-Count",
+		"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "X-Thumbnail-Placeholder")
 	router.Use(cors.New(config))
 
 	// Public routes
 	public := router.Group("/v1")
 	public.POST("/user/login", func(c *gin.Context) { user.Connect(c) })
 	public.POST("/refresh/token", func(c *gin.Context) { authentication.RefreshToken(c) })
+	public.GET("/public/share/:token", func(c *gin.Context) { share.Get(c) })
+	public.POST("/public/share/:token/unlock", func(c *gin.Context) { share.Unlock(c) })
+	public.GET("/public/share/:token/download", func(c *gin.Context) { share.Download(c) })
+	public.POST("/public/share/:token/upload", func(c *gin.Context) { share.Upload(c) })
 
 	// Private Routes, for authenticated users
 	private := router.Group("/v1")
@@ -30,23 +52,97 @@ func SetupRouter() *gin.Engine {
 	private.GET("/user/:id", func(c *gin.Context) { user.Get(c) })
 	private.GET("/list/directory", func(c *gin.Context) { desktop.GetDirectory(c) })
 	private.GET("/file", func(c *gin.Context) { desktop.ServeFile(c) })
+	private.GET("/thumbnail", func(c *gin.Context) { thumbnail.Get(c) })
+	private.GET("/archive", func(c *gin.Context) { desktop.DownloadArchive(c) })
 	private.POST("/folder", func(c *gin.Context) { desktop.CreateFolder(c) })
 	private.POST("/file", func(c *gin.Context) { desktop.UploadFile(c) })
-	private.POST("/torrent", func(c *gin.Context) { torrent.Download(c) })
+	private.POST("/torrent", middleware.RequirePermission(models.PermissionDownloadTorrents), func(c *gin.Context) { torrent.Download(c) })
+	private.GET("/metainfo", func(c *gin.Context) { torrent.MetaInfo(c) })
+	private.POST("/metainfo", middleware.RequirePermission(models.PermissionDownloadTorrents), func(c *gin.Context) { torrent.Create(c) })
+	private.GET("/torrents", func(c *gin.Context) { torrent.List(c) })
+	private.GET("/torrent/:id", func(c *gin.Context) { torrent.Get(c) })
+	private.PUT("/torrent/:id/pause", func(c *gin.Context) { torrent.Pause(c) })
+	private.PUT("/torrent/:id/resume", func(c *gin.Context) { torrent.Resume(c) })
+	private.PUT("/torrent/:id/cancel", func(c *gin.Context) { torrent.Cancel(c) })
+	private.DELETE("/torrent/:id", func(c *gin.Context) { torrent.Remove(c) })
+	private.GET("/torrent/:id/files", func(c *gin.Context) { torrent.Files(c) })
+	private.PUT("/torrent/:id/files", func(c *gin.Context) { torrent.Select(c) })
 	private.PUT("/user/:id", func(c *gin.Context) { user.Update(c) })
 	private.PUT("/user/:id/logout", func(c *gin.Context) { user.LogOut(c) })
+	private.GET("/user/:id/quota", func(c *gin.Context) { user.GetQuota(c) })
+	private.GET("/user/:id/permissions", func(c *gin.Context) { user.GetPermissions(c) })
 	private.PUT("/path", func(c *gin.Context) { desktop.RenamePath(c) })
 	private.PUT("/copy/path", func(c *gin.Context) { desktop.CopyPath(c) })
 	private.PUT("/delete/path", func(c *gin.Context) { desktop.DeletePath(c) })
+	private.POST("/extract", func(c *gin.Context) { desktop.ExtractArchive(c) })
+	private.GET("/jobs", func(c *gin.Context) { job.List(c) })
+	private.GET("/job/:id", func(c *gin.Context) { job.Get(c) })
+	private.PUT("/job/:id/cancel", func(c *gin.Context) { job.Cancel(c) })
+	private.GET("/trash", func(c *gin.Context) { trash.List(c) })
+	private.PUT("/trash/:id/restore", func(c *gin.Context) { trash.Restore(c) })
+	private.DELETE("/trash/:id", func(c *gin.Context) { trash.Delete(c) })
+	private.DELETE("/trash", func(c *gin.Context) { trash.Empty(c) })
+	private.GET("/versions", func(c *gin.Context) { version.List(c) })
+	private.GET("/version/:id", func(c *gin.Context) { version.Download(c) })
+	private.PUT("/version/:id/restore", func(c *gin.Context) { version.Restore(c) })
+	private.POST("/share", middleware.RequirePermission(models.PermissionSharePublicly), func(c *gin.Context) { share.Create(c) })
+	private.GET("/shares", func(c *gin.Context) { share.List(c) })
+	private.DELETE("/share/:id", func(c *gin.Context) { share.Delete(c) })
+	private.POST("/grant", func(c *gin.Context) { grant.Create(c) })
+	private.GET("/grants", func(c *gin.Context) { grant.List(c) })
+	private.GET("/grants/received", func(c *gin.Context) { grant.Received(c) })
+	private.DELETE("/grant/:id", func(c *gin.Context) { grant.Delete(c) })
+	private.GET("/search", func(c *gin.Context) { search.Search(c) })
+	private.POST("/search/index", func(c *gin.Context) { search.Index(c) })
+	private.GET("/timeline", func(c *gin.Context) { timeline.Get(c) })
+	private.POST("/timeline/index", func(c *gin.Context) { timeline.Index(c) })
+	private.GET("/music/artists", func(c *gin.Context) { music.Artists(c) })
+	private.GET("/music/albums", func(c *gin.Context) { music.Albums(c) })
+	private.GET("/music/tracks", func(c *gin.Context) { music.Tracks(c) })
+	private.POST("/music/index", func(c *gin.Context) { music.Index(c) })
+	private.GET("/notifications", func(c *gin.Context) { notification.List(c) })
+	private.PUT("/notification/:id/read", func(c *gin.Context) { notification.Read(c) })
+	private.DELETE("/notification/:id", func(c *gin.Context) { notification.Delete(c) })
+	private.OPTIONS("/upload", func(c *gin.Context) { upload.Options(c) })
+	private.POST("/upload", func(c *gin.Context) { upload.Create(c) })
+	private.HEAD("/upload/:id", func(c *gin.Context) { upload.Head(c) })
+	private.PATCH("/upload/:id", func(c *gin.Context) { upload.Patch(c) })
+	private.DELETE("/upload/:id", func(c *gin.Context) { upload.Terminate(c) })
 
-	// Admin routes
-	admin := router.Group("/v1")
-	admin.Use(middleware.AdminJwtHandling)
-	admin.GET("/list/users", func(c *gin.Context) { user.List(c) })
-	admin.PUT("/user/:id/archive", func(c *gin.Context) { user.Archive(c) })
-	admin.DELETE("/user/:id", func(c *gin.Context) { user.Delete(c) })
-	admin.PUT("/user/:id/password", func(c *gin.Context) { user.UpdatePassword(c) })
-	admin.POST("/user", func(c *gin.Context) { user.Create(c) })
+	// Live events and media, the token can be sent in the query since EventSource and the media elements can not send headers
+	live := router.Group("/v1")
+	live.Use(middleware.QueryToken, middleware.JwtHandling)
+	live.GET("/events", func(c *gin.Context) { stream.Events(c) })
+	live.GET("/music/track/:id", func(c *gin.Context) { music.Stream(c) })
+	live.GET("/music/track/:id/cover", func(c *gin.Context) { music.Cover(c) })
+
+	// Administration routes, each of them requires a permission
+	users := router.Group("/v1")
+	users.Use(middleware.JwtHandling, middleware.RequirePermission(models.PermissionManageUsers))
+	users.GET("/list/users", func(c *gin.Context) { user.List(c) })
+	users.PUT("/user/:id/archive", func(c *gin.Context) { user.Archive(c) })
+	users.DELETE("/user/:id", func(c *gin.Context) { user.Delete(c) })
+	users.PUT("/user/:id/password", func(c *gin.Context) { user.UpdatePassword(c) })
+	users.PUT("/user/:id/quota", func(c *gin.Context) { user.UpdateQuota(c) })
+	users.POST("/user", func(c *gin.Context) { user.Create(c) })
+
+	roles := router.Group("/v1")
+	roles.Use(middleware.JwtHandling, middleware.RequirePermission(models.PermissionManageRoles))
+	roles.GET("/permissions", func(c *gin.Context) { role.Permissions(c) })
+	roles.GET("/roles", func(c *gin.Context) { role.List(c) })
+	roles.POST("/role", func(c *gin.Context) { role.Create(c) })
+	roles.PUT("/role/:id", func(c *gin.Context) { role.Update(c) })
+	roles.DELETE("/role/:id", func(c *gin.Context) { role.Delete(c) })
+	roles.PUT("/user/:id/role/:roleId", func(c *gin.Context) { role.AddUser(c) })
+	roles.DELETE("/user/:id/role/:roleId", func(c *gin.Context) { role.RemoveUser(c) })
+	roles.GET("/groups", func(c *gin.Context) { group.List(c) })
+	roles.GET("/group/:id", func(c *gin.Context) { group.Get(c) })
+	roles.POST("/group", func(c *gin.Context) { group.Create(c) })
+	roles.DELETE("/group/:id", func(c *gin.Context) { group.Delete(c) })
+	roles.PUT("/group/:id/member/:userId", func(c *gin.Context) { group.AddMember(c) })
+	roles.DELETE("/group/:id/member/:userId", func(c *gin.Context) { group.RemoveMember(c) })
+	roles.PUT("/group/:id/role/:roleId", func(c *gin.Context) { group.AddRole(c) })
+	roles.DELETE("/group/:id/role/:roleId", func(c *gin.Context) { group.RemoveRole(c) })
 
 	return router
 }
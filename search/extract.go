@@ -0,0 +1,98 @@
+package search
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// The amount of text indexed for a file, the rest of a long document is not searchable
+const maxTextSize = 512 * 1024
+
+// The plain text formats without a text/* mime type
+var textExtensions = map[string]bool{
+	".md": true, ".markdown": true, ".txt": true, ".log": true, ".csv": true, ".json": true, ".yaml": true, ".yml": true,
+	".toml": true, ".ini": true, ".conf": true, ".xml": true, ".sql": true, ".sh": true, ".go": true, ".py": true,
+	".js": true, ".ts": true, ".c": true, ".h": true, ".java": true, ".rs": true, ".srt": true,
+}
+
+// Indexable checks if the content of a file can be extracted from its name
+func Indexable(name string) bool {
+	var extension string = strings.ToLower(filepath.Ext(name))
+	return extension == ".pdf" || textExtensions[extension] || strings.HasPrefix(mime.TypeByExtension(extension), "text/")
+}
+
+// ExtractText returns the text of a plain text or PDF file, truncated to the indexed size
+func ExtractText(path string) (string, error) {
+	if strings.ToLower(filepath.Ext(path)) == ".pdf" {
+		return extractPDF(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(file, maxTextSize))
+	if err != nil {
+		return "", err
+	}
+	return validText(b), nil
+}
+
+// The PDF reader panics on some malformed documents, they are not indexed
+func extractPDF(path string) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = "", fmt.Errorf("malformed pdf %s: %v", filepath.Base(path), r)
+		}
+	}()
+
+	file, reader, err := pdf.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	plain, err := reader.GetPlainText()
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(plain, maxTextSize))
+	if err != nil {
+		return "", err
+	}
+	return validText(b), nil
+}
+
+// This function drops the bytes that are not UTF-8, such as a character cut by the size limit, and the NUL bytes Postgres refuses.
+// Binary files give an empty text.
+func validText(b []byte) string {
+	if utf8.Valid(b) {
+		return strings.Replace(string(b), "\x00", "", -1)
+	}
+
+	var invalid int
+	var text strings.Builder
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size == 1 {
+			invalid++
+		} else if r != 0 {
+			text.WriteRune(r)
+		}
+		b = b[size:]
+	}
+	if invalid > text.Len()/10 {
+		return ""
+	}
+	return text.String()
+}
@@ -0,0 +1,97 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/indexer"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/storage"
+)
+
+// The index follows the changes published on the event bus
+var index = indexer.New("search index", indexer.Callbacks{Update: update, Forget: forget, Move: move})
+
+// Reindex rebuilds the index of a user's whole home
+func Reindex(userID int) error {
+	return index.Reindex(userID)
+}
+
+func update(userID int, path string) error {
+	home, err := storage.HomeDir(userID)
+	if err != nil {
+		return err
+	}
+
+	// The files removed from a folder are only known by indexing it again from scratch
+	fileInfo, err := os.Lstat(path)
+	if os.IsNotExist(err) || (err == nil && fileInfo.IsDir()) {
+		err = forget(userID, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Symlinks are not followed, their target may be outside of the home
+	return filepath.Walk(path, func(path string, fileInfo os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !fileInfo.Mode().IsRegular() || !Indexable(fileInfo.Name()) {
+			return nil
+		}
+
+		clientPath, err := relative(home, path)
+		if err != nil {
+			return nil
+		}
+
+		text, err := ExtractText(path)
+		if err != nil || len(text) <= 0 {
+			// A file replaced by an unreadable content must not keep its previous words
+			return models.DeleteFileContents(userID, clientPath)
+		}
+		return models.SaveFileContent(userID, clientPath, text)
+	})
+}
+
+func forget(userID int, path string) error {
+	home, err := storage.HomeDir(userID)
+	if err != nil {
+		return err
+	}
+	clientPath, err := relative(home, path)
+	if err != nil {
+		return err
+	}
+	return models.DeleteFileContents(userID, clientPath)
+}
+
+func move(userID int, source string, target string) error {
+	home, err := storage.HomeDir(userID)
+	if err != nil {
+		return err
+	}
+	sourcePath, err := relative(home, source)
+	if err != nil {
+		return err
+	}
+	targetPath, err := relative(home, target)
+	if err != nil {
+		return err
+	}
+	return models.MoveFileContents(userID, sourcePath, targetPath)
+}
+
+// The index stores the paths as seen by the owner of the files
+func relative(home string, path string) (string, error) {
+	if !storage.Contains(home, path) {
+		return "", storage.ErrOutsideHome
+	}
+	rel, err := filepath.Rel(home, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(filepath.Join("/", rel)), nil
+}
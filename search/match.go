@@ -0,0 +1,105 @@
+package search
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Name matching modes
+const (
+	// MatchAuto uses a glob when the query holds a wildcard, a fuzzy match otherwise
+	MatchAuto  = "auto"
+	MatchGlob  = "glob"
+	MatchFuzzy = "fuzzy"
+)
+
+// ErrUnknownMode is returned when the matching mode is not known
+var ErrUnknownMode = errors.New("unknown match mode, expected auto, glob or fuzzy")
+
+// Matcher matches file names against a query, ignoring the case
+type Matcher struct {
+	query string
+	glob  bool
+}
+
+// NewMatcher checks a query and its matching mode
+func NewMatcher(query string, mode string) (Matcher, error) {
+	var matcher Matcher = Matcher{query: strings.ToLower(query)}
+
+	switch mode {
+	case "", MatchAuto:
+		matcher.glob = strings.ContainsAny(query, "*?[")
+	case MatchGlob:
+		matcher.glob = true
+	case MatchFuzzy:
+		matcher.glob = false
+	default:
+		return matcher, ErrUnknownMode
+	}
+
+	if matcher.glob {
+		_, err := filepath.Match(matcher.query, "")
+		if err != nil {
+			return matcher, err
+		}
+	}
+	return matcher, nil
+}
+
+// Match checks if a name matches the query. The score orders the fuzzy matches, the higher the better.
+// An empty query matches every name.
+func (matcher Matcher) Match(name string) (float64, bool) {
+	if len(matcher.query) <= 0 {
+		return 0, true
+	}
+
+	var lower string = strings.ToLower(name)
+	if matcher.glob {
+		matched, _ := filepath.Match(matcher.query, lower)
+		if !matched {
+			return 0, false
+		}
+		return 1, true
+	}
+	return fuzzyScore(matcher.query, lower)
+}
+
+// The query characters must appear in the name in the same order.
+// Consecutive characters, characters starting a word and exact substrings score higher, long names lower.
+func fuzzyScore(query string, name string) (float64, bool) {
+	var queryRunes, nameRunes []rune = []rune(query), []rune(name)
+
+	var score float64
+	var matched int
+	var previous int = -2
+	for i, r := range nameRunes {
+		if matched >= len(queryRunes) {
+			break
+		}
+		if r != queryRunes[matched] {
+			continue
+		}
+
+		score++
+		if i == previous+1 {
+			score += 2
+		}
+		if i == 0 || !unicode.IsLetter(nameRunes[i-1]) && !unicode.IsDigit(nameRunes[i-1]) {
+			score += 3
+		}
+		previous = i
+		matched++
+	}
+	if matched < len(queryRunes) {
+		return 0, false
+	}
+
+	if strings.HasPrefix(name, query) {
+		score += 10
+	} else if strings.Contains(name, query) {
+		score += 5
+	}
+	return score / (1 + float64(len(nameRunes)-len(queryRunes))/20), true
+}
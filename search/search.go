@@ -0,0 +1,229 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/storage"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Query describes the files searched. The zero value of a filter disables it.
+type Query struct {
+	Name    Matcher
+	Types   []string
+	MinSize int64
+	MaxSize int64
+	After   time.Time
+	Before  time.Time
+	// Content are the words searched in the indexed content of the files
+	Content    string
+	ShowHidden bool
+	Limit      int
+}
+
+// Area is a folder searched, with the path the user sees it at
+type Area struct {
+	storage.Location
+	ClientPath string
+}
+
+// Areas returns the folders searched under a client path. From the root of the home, the folders shared with the user are searched too.
+func Areas(userID int, clientPath string) ([]Area, error) {
+	var cleaned string = path.Clean("/" + filepath.ToSlash(clientPath))
+	if cleaned != "/" && cleaned != storage.SharedDir {
+		location, err := storage.Locate(userID, cleaned)
+		if err != nil {
+			return nil, err
+		}
+		return []Area{{Location: location, ClientPath: cleaned}}, nil
+	}
+
+	var areas []Area
+	if cleaned == "/" {
+		location, err := storage.Locate(userID, "/")
+		if err != nil {
+			return nil, err
+		}
+		areas = append(areas, Area{Location: location, ClientPath: "/"})
+	}
+
+	folders, err := storage.Shared(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, folder := range folders {
+		var sharedPath string = path.Join(storage.SharedDir, folder.Name)
+		location, err := storage.Locate(userID, sharedPath)
+		if err != nil {
+			// The folder was removed by its owner
+			continue
+		}
+		areas = append(areas, Area{Location: location, ClientPath: sharedPath})
+	}
+	return areas, nil
+}
+
+// Find searches the files of some areas, the best matches first.
+// Without content words, the areas are walked. Otherwise the content index of their owners gives the candidates.
+func Find(ctx context.Context, areas []Area, query Query) ([]models.SearchResult, error) {
+	var results = []models.SearchResult{}
+	var err error
+	for _, area := range areas {
+		if len(query.Content) > 0 {
+			results, err = findContent(area, query, results)
+		} else {
+			results, err = walk(ctx, area, query, results)
+		}
+		if err != nil {
+			return results, err
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Path < results[j].Path
+	})
+	if query.Limit > 0 && len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+	return results, nil
+}
+
+func walk(ctx context.Context, area Area, query Query, results []models.SearchResult) ([]models.SearchResult, error) {
+	// A real folder named like the virtual shared folder is hidden at the root of the home
+	var hiddenShared string = filepath.Join(area.Root, filepath.FromSlash(storage.SharedDir))
+
+	err := filepath.Walk(area.Path, func(path string, fileInfo os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil || path == area.Path {
+			return nil
+		}
+		if (!query.ShowHidden && storage.IsHidden(fileInfo.Name())) || (area.Grant == nil && path == hiddenShared) {
+			if fileInfo.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		result, ok := match(area, path, fileInfo, query)
+		if ok {
+			results = append(results, result)
+		}
+		return nil
+	})
+	return results, err
+}
+
+func findContent(area Area, query Query, results []models.SearchResult) ([]models.SearchResult, error) {
+	home, err := storage.HomeDir(area.OwnerID)
+	if err != nil {
+		return results, err
+	}
+	under, err := relative(home, area.Path)
+	if err != nil {
+		return results, err
+	}
+
+	// The other filters are applied on the best ranked files
+	var limit int = query.Limit * 10
+	if limit <= 0 {
+		limit = 1000
+	}
+	matches, err := models.SearchFileContents(area.OwnerID, query.Content, under, limit)
+	if err != nil {
+		return results, err
+	}
+
+	var hiddenShared string = filepath.Join(area.Root, filepath.FromSlash(storage.SharedDir))
+	for _, contentMatch := range matches {
+		path, err := storage.Jail(home, contentMatch.Path)
+		if err != nil || !storage.Contains(area.Path, path) || (area.Grant == nil && storage.Contains(hiddenShared, path)) {
+			continue
+		}
+		// The index may be behind the disk
+		fileInfo, err := os.Lstat(path)
+		if err != nil || !fileInfo.Mode().IsRegular() {
+			continue
+		}
+		if !query.ShowHidden && hasHiddenElement(area.Path, path) {
+			continue
+		}
+
+		result, ok := match(area, path, fileInfo, query)
+		if ok {
+			result.Score += contentMatch.Rank
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// This function applies the name and the filters of the query to a file
+func match(area Area, path string, fileInfo os.FileInfo, query Query) (models.SearchResult, bool) {
+	score, ok := query.Name.Match(fileInfo.Name())
+	if !ok {
+		return models.SearchResult{}, false
+	}
+
+	var fileDescriptor models.FileDescriptor = storage.Describe(filepath.Dir(path), fileInfo, query.ShowHidden)
+	if len(query.Types) > 0 && !contains(query.Types, fileDescriptor.Type) {
+		return models.SearchResult{}, false
+	}
+	// The sizes only apply to files
+	if (query.MinSize > 0 || query.MaxSize > 0) && fileDescriptor.Type == storage.TypeDirectory {
+		return models.SearchResult{}, false
+	}
+	if query.MinSize > 0 && fileDescriptor.Size < query.MinSize {
+		return models.SearchResult{}, false
+	}
+	if query.MaxSize > 0 && fileDescriptor.Size > query.MaxSize {
+		return models.SearchResult{}, false
+	}
+	if !query.After.IsZero() && fileDescriptor.ModTime.Before(query.After) {
+		return models.SearchResult{}, false
+	}
+	if !query.Before.IsZero() && fileDescriptor.ModTime.After(query.Before) {
+		return models.SearchResult{}, false
+	}
+
+	rel, err := filepath.Rel(area.Path, path)
+	if err != nil {
+		return models.SearchResult{}, false
+	}
+	return models.SearchResult{
+		FileDescriptor: fileDescriptor,
+		Path:           filepath.ToSlash(filepath.Join(area.ClientPath, rel)),
+		Score:          score,
+	}, true
+}
+
+func hasHiddenElement(base string, path string) bool {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return true
+	}
+	for _, element := range strings.Split(filepath.ToSlash(rel), "/") {
+		if storage.IsHidden(element) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
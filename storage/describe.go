@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"mime"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/models"
+	"strings"
+)
+
+// File types, used by the clients to pick an icon or a viewer
+const (
+	TypeDirectory = "directory"
+	TypeImage     = "image"
+	TypeVideo     = "video"
+	TypeAudio     = "audio"
+	TypeTorrent   = "torrent"
+	TypePdf       = "pdf"
+	TypeArchive   = "archive"
+	TypeFile      = "file"
+)
+
+// Extensions of the image files
+var imageExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".bmp": true, ".tif": true, ".tiff": true, ".svg": true,
+}
+
+// FileType classifies a file from its name
+func FileType(name string) string {
+	var extension = strings.ToLower(filepath.Ext(name))
+	if imageExtensions[extension] {
+		return TypeImage
+	} else if extension == ".mp4" || extension == ".mkv" {
+		return TypeVideo
+	} else if extension == ".mp3" || extension == ".flac" || extension == ".ogg" || extension == ".m4a" {
+		return TypeAudio
+	} else if extension == ".torrent" {
+		return TypeTorrent
+	} else if extension == ".pdf" {
+		return TypePdf
+	} else if extension == ".zip" || extension == ".gz" || extension == ".tgz" || extension == ".tar" {
+		return TypeArchive
+	}
+	return TypeFile
+}
+
+// IsHidden checks if a file name is hidden
+func IsHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// Describe builds the descriptor of a file found in a directory.
+// Symlinks are described by their target, directories by their number of children.
+func Describe(dir string, fileInfo os.FileInfo, showHidden bool) models.FileDescriptor {
+	var name string = fileInfo.Name()
+	var path string = filepath.Join(dir, name)
+
+	if fileInfo.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Stat(path)
+		if err == nil {
+			fileInfo = target
+		}
+	}
+
+	var fileDescriptor models.FileDescriptor = models.FileDescriptor{
+		Name:        name,
+		TrimmedName: trimName(name),
+		Size:        fileInfo.Size(),
+		ModTime:     fileInfo.ModTime(),
+		Permissions: fileInfo.Mode().String(),
+	}
+
+	if fileInfo.IsDir() {
+		fileDescriptor.Type = TypeDirectory
+		fileDescriptor.Size = 0
+		fileDescriptor.ChildCount = countChildren(path, showHidden)
+	} else {
+		fileDescriptor.Type = FileType(name)
+		fileDescriptor.MimeType = mime.TypeByExtension(filepath.Ext(name))
+		if fileDescriptor.MimeType == "" {
+			fileDescriptor.MimeType = "application/octet-stream"
+		}
+	}
+
+	return fileDescriptor
+}
+
+func countChildren(path string, showHidden bool) *int {
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return nil
+	}
+
+	var count int
+	for _, name := range names {
+		if showHidden || !IsHidden(name) {
+			count++
+		}
+	}
+	return &count
+}
+
+func trimName(name string) string {
+	if len(name) > 15 {
+		return name[0:13] + "..."
+	}
+	return name
+}
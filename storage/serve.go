@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Media types missing from the builtin table of the mime package
+func init() {
+	mime.AddExtensionType(".mp4", "video/mp4")
+	mime.AddExtensionType(".mkv", "video/x-matroska")
+	mime.AddExtensionType(".mp3", "audio/mpeg")
+	mime.AddExtensionType(".flac", "audio/flac")
+	mime.AddExtensionType(".ogg", "audio/ogg")
+	mime.AddExtensionType(".m4a", "audio/mp4")
+}
+
+// Serve streams a file from the disk to the client.
+// Range, If-Range and conditional requests are handled by net/http, which allows the browser video players to seek in a file.
+// The file is sent as an attachment, unless the inline query parameter is set and its type is safe to display.
+func Serve(c *gin.Context, path string, name string) {
+	serve(c, path, name, c.Query("inline") == "true")
+}
+
+// ServeInline streams a file the browser displays or plays rather than downloads, if its type is safe to display
+func ServeInline(c *gin.Context, path string, name string) {
+	serve(c, path, name, true)
+}
+
+func serve(c *gin.Context, path string, name string, inline bool) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "File not found.",
+		})
+		return
+	} else if os.IsPermission(err) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"message": "Forbidden: file can not be read.",
+		})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"Could not open file": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"Could not open file": err.Error()})
+		return
+	}
+	if fileInfo.IsDir() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "Path is a directory.",
+		})
+		return
+	}
+
+	// The content type is guessed from the extension, net/http sniffs the content if it is unknown
+	var contentType string = mime.TypeByExtension(filepath.Ext(name))
+	if contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+
+	// The files are written by the users, a page or a script displayed on the API's origin could act for whoever opens it
+	var disposition string = "attachment"
+	if inline && safeInline(contentType) {
+		disposition = "inline"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": name}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "sandbox")
+
+	c.Header("ETag", ETag(fileInfo))
+	c.Header("Cache-Control", "private, no-cache")
+	http.ServeContent(c.Writer, c.Request, name, fileInfo.ModTime(), file)
+}
+
+// The types displayed without running anything: raster images, audio, video and pdf
+func safeInline(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return !strings.HasPrefix(mediaType, "image/svg")
+	case strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "video/"):
+		return true
+	}
+	return mediaType == "application/pdf"
+}
+
+// ETag builds a strong entity tag from a file's size and modification date
+func ETag(fileInfo os.FileInfo) string {
+	return fmt.Sprintf("\"%x-%x\"", fileInfo.ModTime().UnixNano(), fileInfo.Size())
+}
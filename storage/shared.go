@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"rakoon/rakoon-back/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SharedDir is the virtual folder holding the folders other users shared with the user.
+// It hides a real folder of the same name at the root of the home.
+const SharedDir = "/Shared with me"
+
+// ErrReadOnly is returned when a write is attempted in a folder shared read-only
+var ErrReadOnly = errors.New("the folder is shared read-only")
+
+// ErrVirtual is returned when the virtual shared folder itself is used as a real path
+var ErrVirtual = errors.New("the shared folder is virtual")
+
+// Location is a client path resolved for a user, either in their home or in a folder shared with them
+type Location struct {
+	// Path is the absolute path
+	Path string
+	// Root is the home or the shared folder the path is jailed in
+	Root string
+	// OwnerID is the user owning the data, whose quota, trash and versions are used
+	OwnerID int
+	// Grant gives access to the path, nil in the user's own home
+	Grant *models.Grant
+}
+
+// SharedFolder is an entry of the virtual shared folder
+type SharedFolder struct {
+	Name  string
+	Grant models.Grant
+}
+
+// Writable checks if the user can modify the location
+func (location Location) Writable() bool {
+	return location.Grant == nil || location.Grant.Permission == models.GrantWrite
+}
+
+// IsRoot checks if the location is the home or the shared folder itself, which can not be moved or removed
+func (location Location) IsRoot() bool {
+	return location.Path == location.Root
+}
+
+// Locate resolves a client path for a user. Paths under SharedDir lead to the folders shared with them.
+func Locate(userID int, clientPath string) (Location, error) {
+	var cleaned string = path.Clean("/" + filepath.ToSlash(clientPath))
+	if cleaned == SharedDir {
+		return Location{}, ErrVirtual
+	}
+
+	if !strings.HasPrefix(cleaned, SharedDir+"/") {
+		home, err := HomeDir(userID)
+		if err != nil {
+			return Location{}, err
+		}
+		resolved, err := Jail(home, cleaned)
+		return Location{Path: resolved, Root: home, OwnerID: userID}, err
+	}
+
+	var name, rest string = strings.TrimPrefix(cleaned, SharedDir+"/"), "/"
+	if i := strings.Index(name, "/"); i >= 0 {
+		name, rest = name[:i], name[i:]
+	}
+
+	folders, err := Shared(userID)
+	if err != nil {
+		return Location{}, err
+	}
+	for _, folder := range folders {
+		if folder.Name != name {
+			continue
+		}
+
+		// The shared folder may have been moved or removed by its owner
+		root, err := Resolve(folder.Grant.OwnerID, folder.Grant.Path)
+		if err != nil {
+			return Location{}, err
+		}
+		rootInfo, err := os.Stat(root)
+		if err != nil {
+			return Location{}, err
+		} else if !rootInfo.IsDir() {
+			return Location{}, os.ErrNotExist
+		}
+
+		resolved, err := Jail(root, rest)
+		var grant models.Grant = folder.Grant
+		return Location{Path: resolved, Root: root, OwnerID: grant.OwnerID, Grant: &grant}, err
+	}
+	return Location{}, os.ErrNotExist
+}
+
+// Shared lists the folders shared with a user, named after the folder and its owner
+func Shared(userID int) ([]SharedFolder, error) {
+	grants, err := models.GetGrantsForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A folder shared with the user and one of their groups is listed once, with the widest permission
+	var folders []SharedFolder
+	var taken = map[string]bool{}
+	var listed = map[string]bool{}
+	for _, grant := range grants {
+		var key string = strconv.Itoa(grant.OwnerID) + ":" + grant.Path
+		if listed[key] {
+			continue
+		}
+		listed[key] = true
+
+		var name string = grant.OwnerName
+		if grant.Path != "/" {
+			name = path.Base(grant.Path) + " (" + grant.OwnerName + ")"
+		}
+		if taken[name] {
+			name += " " + strconv.Itoa(grant.ID)
+		}
+		taken[name] = true
+		folders = append(folders, SharedFolder{Name: name, Grant: grant})
+	}
+	return folders, nil
+}
+
+// ClientPath returns the path a user sees for an absolute path of their home or of a folder shared with them
+func ClientPath(userID int, absolute string) (string, error) {
+	clientPath, err := Relative(userID, absolute)
+	if err != ErrOutsideHome {
+		return clientPath, err
+	}
+
+	folders, err := Shared(userID)
+	if err != nil {
+		return "", err
+	}
+	for _, folder := range folders {
+		root, err := Resolve(folder.Grant.OwnerID, folder.Grant.Path)
+		if err != nil || !Contains(root, absolute) {
+			continue
+		}
+		rel, err := filepath.Rel(root, absolute)
+		if err != nil {
+			continue
+		}
+		return path.Join(SharedDir, folder.Name, filepath.ToSlash(rel)), nil
+	}
+	return "", ErrOutsideHome
+}
+
+// LocateEntry locates an item an operation acts on itself, like a deletion or a move: a symlink is the link, not its target.
+// Only the folders above the item are resolved.
+func LocateEntry(userID int, clientPath string) (Location, error) {
+	var cleaned string = path.Clean("/" + filepath.ToSlash(clientPath))
+	var parent string = path.Dir(cleaned)
+	if cleaned == "/" || cleaned == SharedDir || parent == SharedDir {
+		return Locate(userID, cleaned)
+	}
+
+	location, err := Locate(userID, parent)
+	if err != nil {
+		return location, err
+	}
+	location.Path = filepath.Join(location.Path, path.Base(cleaned))
+	return location, nil
+}
+
+// LocateContext resolves a client path for the authenticated user of the request, checking they can write to it if needed.
+// If the path can not be resolved, an error is sent and false is returned.
+func LocateContext(c *gin.Context, clientPath string, write bool) (Location, bool) {
+	location, err := Locate(UserID(c), clientPath)
+	return checkLocation(c, location, err, write)
+}
+
+// LocateEntryContext is LocateContext for the operations on an item itself
+func LocateEntryContext(c *gin.Context, clientPath string, write bool) (Location, bool) {
+	location, err := LocateEntry(UserID(c), clientPath)
+	return checkLocation(c, location, err, write)
+}
+
+// This function sends the error of a location, and returns false if there was one
+func checkLocation(c *gin.Context, location Location, err error, write bool) (Location, bool) {
+	if err == nil && write && !location.Writable() {
+		err = ErrReadOnly
+	}
+
+	if err == ErrOutsideHome {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: path is outside of your space.",
+		})
+		return location, false
+	} else if err == ErrReadOnly {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: this folder is shared read-only.",
+		})
+		return location, false
+	} else if err == ErrVirtual {
+		c.JSON(403, gin.H{
+			"message": "Forbidden: " + SharedDir + " is a virtual folder.",
+		})
+		return location, false
+	} else if os.IsNotExist(err) {
+		c.JSON(404, gin.H{
+			"message": "Path not found.",
+		})
+		return location, false
+	} else if err != nil {
+		c.JSON(500, gin.H{"Could not resolve path": err.Error()})
+		return location, false
+	}
+	return location, true
+}
+
+// ResolveWriteContext resolves a client path the authenticated user of the request is going to modify
+func ResolveWriteContext(c *gin.Context, clientPath string) (string, bool) {
+	location, ok := LocateContext(c, clientPath, true)
+	return location.Path, ok
+}
+
+// DescribeShared describes the content of the virtual shared folder, the folders removed by their owner are not listed
+func DescribeShared(userID int, showHidden bool) ([]models.FileDescriptor, error) {
+	folders, err := Shared(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var directory = []models.FileDescriptor{}
+	for _, folder := range folders {
+		root, err := Resolve(folder.Grant.OwnerID, folder.Grant.Path)
+		if err != nil {
+			continue
+		}
+		rootInfo, err := os.Stat(root)
+		if err != nil || !rootInfo.IsDir() {
+			continue
+		}
+
+		var fileDescriptor models.FileDescriptor = Describe(filepath.Dir(root), rootInfo, showHidden)
+		fileDescriptor.Name = folder.Name
+		fileDescriptor.TrimmedName = trimName(folder.Name)
+		directory = append(directory, fileDescriptor)
+	}
+	return directory, nil
+}
+
+// DescribeSharedDir describes the virtual shared folder itself
+func DescribeSharedDir(count int) models.FileDescriptor {
+	var name string = strings.TrimPrefix(SharedDir, "/")
+	return models.FileDescriptor{
+		Name:        name,
+		TrimmedName: trimName(name),
+		Type:        TypeDirectory,
+		ChildCount:  &count,
+		Permissions: "dr-xr-xr-x",
+	}
+}
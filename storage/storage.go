@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrOutsideHome is returned when a path resolves outside of the user's home directory
+var ErrOutsideHome = errors.New("path is outside of the user's home directory")
+
+// ErrNoRoot is returned when the ROOT_PATH environment variable is not defined
+var ErrNoRoot = errors.New("ROOT_PATH is not defined")
+
+// Root returns the canonical storage root defined by the ROOT_PATH environment variable
+func Root() (string, error) {
+	var rootPath = os.Getenv("ROOT_PATH")
+	if len(rootPath) <= 0 {
+		return "", ErrNoRoot
+	}
+
+	root, err := filepath.Abs(rootPath)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(root, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.EvalSymlinks(root)
+}
+
+// HomesDir returns the directory holding the homes of all the users
+func HomesDir() (string, error) {
+	root, err := Root()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, "users"), nil
+}
+
+// HomeDir returns the private home directory of a user, creating it if needed
+func HomeDir(userID int) (string, error) {
+	homes, err := HomesDir()
+	if err != nil {
+		return "", err
+	}
+
+	var home string = filepath.Join(homes, strconv.Itoa(userID))
+	err = os.MkdirAll(home, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	return home, nil
+}
+
+// Owner returns the user whose home holds an absolute path
+func Owner(path string) (int, error) {
+	homes, err := HomesDir()
+	if err != nil {
+		return 0, err
+	}
+
+	rel, err := filepath.Rel(homes, path)
+	if err != nil || !Contains(homes, path) || rel == "." {
+		return 0, ErrOutsideHome
+	}
+	userID, err := strconv.Atoi(strings.Split(filepath.ToSlash(rel), "/")[0])
+	if err != nil {
+		return 0, ErrOutsideHome
+	}
+	return userID, nil
+}
+
+// StagingDir returns a directory reserved to the server under ROOT_PATH, creating it if needed.
+// Its content is never reachable through the users' paths.
+func StagingDir(name string) (string, error) {
+	root, err := Root()
+	if err != nil {
+		return "", err
+	}
+
+	var dir string = filepath.Join(root, ".rakoon", name)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// Resolve maps a client supplied path to an absolute path inside the user's home directory.
+// The path is always interpreted relatively to the home, and symlinks are followed to make sure
+// the final target does not escape it.
+func Resolve(userID int, clientPath string) (string, error) {
+	home, err := HomeDir(userID)
+	if err != nil {
+		return "", err
+	}
+
+	return Jail(home, clientPath)
+}
+
+// Jail resolves a client supplied path inside an arbitrary base directory, a symlink is resolved to its target
+func Jail(base string, clientPath string) (string, error) {
+	var cleaned string = filepath.Clean("/" + filepath.FromSlash(clientPath))
+	var path string = filepath.Join(base, cleaned)
+
+	// The path may not exist yet (upload, folder creation...), so the symlinks are evaluated
+	// on its deepest existing ancestor.
+	var existing string = path
+	var rest string
+	for {
+		_, err := os.Lstat(existing)
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = filepath.Dir(existing)
+	}
+
+	// A dangling symlink can not be checked, it is refused as it could point anywhere.
+	resolved, err := filepath.EvalSymlinks(existing)
+	if os.IsNotExist(err) {
+		return "", ErrOutsideHome
+	} else if err != nil {
+		return "", err
+	}
+
+	if !Contains(base, resolved) {
+		return "", ErrOutsideHome
+	}
+
+	return filepath.Join(resolved, rest), nil
+}
+
+// Contains checks if a path is the base directory itself or one of its descendants
+func Contains(base string, path string) bool {
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Relative returns the client facing path of an absolute path inside the user's home
+func Relative(userID int, path string) (string, error) {
+	home, err := HomeDir(userID)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(home, path)
+	if err != nil || !Contains(home, path) {
+		return "", ErrOutsideHome
+	}
+
+	return filepath.ToSlash(filepath.Join("/", rel)), nil
+}
+
+// UserID returns the id of the authenticated user, set by the jwt middleware
+func UserID(c *gin.Context) int {
+	return c.GetInt("id")
+}
+
+// ResolveContext resolves a client path the authenticated user of the request is going to read.
+// If the path can not be resolved, an error is sent and false is returned.
+func ResolveContext(c *gin.Context, clientPath string) (string, bool) {
+	location, ok := LocateContext(c, clientPath, false)
+	return location.Path, ok
+}
@@ -0,0 +1,381 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/db"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/routes"
+	"rakoon/rakoon-back/storage"
+	"rakoon/rakoon-back/tests/utils"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// Asserts a user can only list his own home directory
+func TestDesktopPathJail(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Tom", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Tom", "qwerty1234", t, router)
+	var bearer = "Bearer " + user.Token
+
+	home, _ := storage.HomeDir(user.ID)
+	ioutil.WriteFile(filepath.Join(home, "mine.txt"), []byte("mine"), 0644)
+	ioutil.WriteFile(filepath.Join(rootPath, "secret.txt"), []byte("secret"), 0644)
+	os.Symlink(rootPath, filepath.Join(home, "link"))
+
+	// The home directory is the root of the listing
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/v1/list/directory?path=/", nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+
+	var directory []models.FileDescriptor
+	err := json.Unmarshal([]byte(record.Body.String()), &directory)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+		t.Fail()
+	}
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, directory[0].Name, "link")
+	assert.Equal(t, directory[1].Name, "mine.txt")
+
+	// Parent directories can not be reached
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/file?path="+url.QueryEscape("../../secret.txt"), nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 404)
+
+	// Symlinks escaping the home directory are refused
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/file?path="+url.QueryEscape("/link/secret.txt"), nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 403)
+
+	// A symlink is deleted itself, not its target
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("PUT", "/v1/delete/path", bytes.NewBufferString(`{"path": "/link", "permanent": true}`))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+	_, err = os.Lstat(filepath.Join(home, "link"))
+	assert.Equal(t, os.IsNotExist(err), true)
+	content, _ := ioutil.ReadFile(filepath.Join(rootPath, "secret.txt"))
+	assert.Equal(t, string(content), "secret")
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
+
+// Asserts files are served with range requests and conditional requests support
+func TestServeFileRange(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Tom", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Tom", "qwerty1234", t, router)
+	var bearer = "Bearer " + user.Token
+
+	home, _ := storage.HomeDir(user.ID)
+	ioutil.WriteFile(filepath.Join(home, "video.mp4"), []byte("0123456789"), 0644)
+
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/v1/file?path=/video.mp4", nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, record.Header().Get("Content-Length"), "10")
+	assert.Equal(t, record.Header().Get("Content-Type"), "video/mp4")
+	var etag string = record.Header().Get("ETag")
+
+	// Partial content
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/file?path=/video.mp4", nil)
+	request.Header.Add("Authorization", bearer)
+	request.Header.Add("Range", "bytes=2-5")
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 206)
+	assert.Equal(t, record.Header().Get("Content-Range"), "bytes 2-5/10")
+	assert.Equal(t, record.Body.String(), "2345")
+
+	// Conditional request
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/file?path=/video.mp4", nil)
+	request.Header.Add("Authorization", bearer)
+	request.Header.Add("If-None-Match", etag)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 304)
+
+	// Only the media are displayed inline, the pages are always downloaded
+	ioutil.WriteFile(filepath.Join(home, "page.html"), []byte("<script>alert(1)</script>"), 0644)
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/file?path=/video.mp4&inline=true", nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Header().Get("Content-Disposition"), `inline; filename=video.mp4`)
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/file?path=/page.html&inline=true", nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, record.Header().Get("Content-Disposition"), `attachment; filename=page.html`)
+	assert.Equal(t, record.Header().Get("X-Content-Type-Options"), "nosniff")
+	assert.Equal(t, record.Header().Get("Content-Security-Policy"), "sandbox")
+
+	// Missing files
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/file?path=/missing.mp4", nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 404)
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
+
+// Asserts a selection of paths can be downloaded as a zip archive
+func TestDownloadArchive(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Tom", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Tom", "qwerty1234", t, router)
+	var bearer = "Bearer " + user.Token
+
+	home, _ := storage.HomeDir(user.ID)
+	os.MkdirAll(filepath.Join(home, "docs", "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(home, "docs", "sub", "a.txt"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(home, "b.txt"), []byte("b"), 0644)
+
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/v1/archive?path=/docs&path=/b.txt", nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, record.Header().Get("Content-Type"), "application/zip")
+
+	reader, err := zip.NewReader(bytes.NewReader(record.Body.Bytes()), int64(record.Body.Len()))
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+		t.Fail()
+	}
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	assert.Equal(t, names, []string{"docs/", "docs/sub/", "docs/sub/a.txt", "b.txt"})
+
+	// Missing paths are refused before streaming
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/archive?path=/missing", nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 404)
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
+
+// Asserts an archive is extracted in a background job, and entries escaping the target are refused
+func TestExtractArchive(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Tom", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Tom", "qwerty1234", t, router)
+	var bearer = "Bearer " + user.Token
+
+	home, _ := storage.HomeDir(user.ID)
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	entry, _ := writer.Create("docs/a.txt")
+	entry.Write([]byte("a"))
+	entry, _ = writer.Create("../evil.txt")
+	entry.Write([]byte("evil"))
+	writer.Close()
+	ioutil.WriteFile(filepath.Join(home, "docs.zip"), buffer.Bytes(), 0644)
+
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/v1/extract", bytes.NewBufferString(`{"path": "/docs.zip", "targetPath": "/out"}`))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 202)
+
+	var job models.Job
+	json.Unmarshal([]byte(record.Body.String()), &job)
+	for job.State == models.JobRunning {
+		time.Sleep(10 * time.Millisecond)
+		record = httptest.NewRecorder()
+		request, _ = http.NewRequest("GET", "/v1/job/"+job.ID, nil)
+		request.Header.Add("Authorization", bearer)
+		router.ServeHTTP(record, request)
+		assert.Equal(t, record.Code, 200)
+		json.Unmarshal([]byte(record.Body.String()), &job)
+	}
+
+	assert.Equal(t, job.State, models.JobFailed)
+	content, _ := ioutil.ReadFile(filepath.Join(home, "out", "docs", "a.txt"))
+	assert.Equal(t, string(content), "a")
+	_, err := os.Stat(filepath.Join(home, "evil.txt"))
+	assert.Equal(t, os.IsNotExist(err), true)
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
+
+// Asserts the directory listing can be sorted and paginated, and missing directories are handled
+func TestGetDirectorySort(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Tom", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Tom", "qwerty1234", t, router)
+	var bearer = "Bearer " + user.Token
+
+	home, _ := storage.HomeDir(user.ID)
+	os.Mkdir(filepath.Join(home, "folder"), 0755)
+	ioutil.WriteFile(filepath.Join(home, "small.txt"), []byte("a"), 0644)
+	ioutil.WriteFile(filepath.Join(home, "big.mp4"), []byte("0123456789"), 0644)
+	ioutil.WriteFile(filepath.Join(home, ".hidden"), []byte("a"), 0644)
+
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/v1/list/directory?path=/&sort=size&order=desc&limit=2", nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+
+	var directory []models.FileDescriptor
+	err := json.Unmarshal([]byte(record.Body.String()), &directory)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+		t.Fail()
+	}
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, record.Header().Get("X-Total-Count"), "3")
+	assert.Equal(t, len(directory), 2)
+	assert.Equal(t, directory[0].Name, "folder")
+	assert.Equal(t, *directory[0].ChildCount, 0)
+	assert.Equal(t, directory[1].Name, "big.mp4")
+	assert.Equal(t, directory[1].Size, int64(10))
+	assert.Equal(t, directory[1].MimeType, "video/mp4")
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/list/directory?path=/missing", nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 404)
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
+
+// Asserts copies apply the conflict policy, and deletions are native
+func TestCopyAndDeletePath(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Tom", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Tom", "qwerty1234", t, router)
+	var bearer = "Bearer " + user.Token
+
+	home, _ := storage.HomeDir(user.ID)
+	os.MkdirAll(filepath.Join(home, "docs", "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(home, "docs", "sub", "a.txt"), []byte("a"), 0644)
+
+	// Copying a folder next to itself with the rename policy creates a duplicate
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("PUT", "/v1/copy/path", bytes.NewBufferString(`{"sourceName": "docs", "sourcePath": "/docs", "targetPath": "/", "conflict": "rename"}`))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 201)
+	content, _ := ioutil.ReadFile(filepath.Join(home, "docs (1)", "sub", "a.txt"))
+	assert.Equal(t, string(content), "a")
+
+	// Without a policy the copy is renamed, nothing is overwritten
+	ioutil.WriteFile(filepath.Join(home, "a.txt"), []byte("b"), 0644)
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("PUT", "/v1/copy/path", bytes.NewBufferString(`{"sourceName": "a.txt", "sourcePath": "/docs/sub/a.txt", "targetPath": "/"}`))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 201)
+	content, _ = ioutil.ReadFile(filepath.Join(home, "a.txt"))
+	assert.Equal(t, string(content), "b")
+	content, _ = ioutil.ReadFile(filepath.Join(home, "a (1).txt"))
+	assert.Equal(t, string(content), "a")
+
+	// An overwritten file is kept as a version
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("PUT", "/v1/copy/path", bytes.NewBufferString(`{"sourceName": "a.txt", "sourcePath": "/docs/sub/a.txt", "targetPath": "/", "conflict": "overwrite"}`))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 201)
+	content, _ = ioutil.ReadFile(filepath.Join(home, "a.txt"))
+	assert.Equal(t, string(content), "a")
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/versions?path=/a.txt", nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+	var versions []models.FileVersion
+	json.Unmarshal([]byte(record.Body.String()), &versions)
+	assert.Equal(t, len(versions), 1)
+	assert.Equal(t, versions[0].Size, int64(1))
+
+	// Unknown policies are refused
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("PUT", "/v1/copy/path", bytes.NewBufferString(`{"sourceName": "docs", "sourcePath": "/docs", "targetPath": "/", "conflict": "merge"}`))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 400)
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("PUT", "/v1/delete/path", bytes.NewBufferString(`{"path": "/docs (1)"}`))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+	_, err := os.Stat(filepath.Join(home, "docs (1)"))
+	assert.Equal(t, os.IsNotExist(err), true)
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
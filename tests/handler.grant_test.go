@@ -0,0 +1,130 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/db"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/routes"
+	"rakoon/rakoon-back/storage"
+	"rakoon/rakoon-back/tests/utils"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// Asserts a folder shared with another user is reachable in their shared folder, with the granted permission only
+func TestGrantedFolder(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var owner models.UserCreate = utils.CreateUser("Olivia", "qwerty1234", t, router)
+	owner.Token = utils.ConnectUser("Olivia", "qwerty1234", t, router)
+	var guest models.UserCreate = utils.CreateUser("Gary", "qwerty1234", t, router)
+	guest.Token = utils.ConnectUser("Gary", "qwerty1234", t, router)
+
+	home, _ := storage.HomeDir(owner.ID)
+	os.Mkdir(filepath.Join(home, "project"), 0755)
+	ioutil.WriteFile(filepath.Join(home, "project", "plan.txt"), []byte("plan"), 0644)
+
+	var share = func(permission string) int {
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest("POST", "/v1/grant", bytes.NewBuffer([]byte(`{"path": "/project", "grantee": "Gary", "permission": "`+permission+`"}`)))
+		request.Header.Add("Content-Type", "application/json")
+		request.Header.Add("Authorization", "Bearer "+owner.Token)
+		router.ServeHTTP(record, request)
+		assert.Equal(t, record.Code, 201)
+
+		var grant models.Grant
+		err := json.Unmarshal([]byte(record.Body.String()), &grant)
+		if err != nil {
+			log.Fatal("Bad output: ", err.Error())
+			t.Fail()
+		}
+		return grant.ID
+	}
+	var upload = func() int {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("path", "/Shared with me/project (Olivia)")
+		part, _ := writer.CreateFormFile("file", "notes.txt")
+		part.Write([]byte("notes"))
+		writer.Close()
+
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest("POST", "/v1/file", &body)
+		request.Header.Add("Content-Type", writer.FormDataContentType())
+		request.Header.Add("Authorization", "Bearer "+guest.Token)
+		router.ServeHTTP(record, request)
+		return record.Code
+	}
+
+	share(models.GrantRead)
+
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/v1/list/directory?path="+url.QueryEscape("/Shared with me"), nil)
+	request.Header.Add("Authorization", "Bearer "+guest.Token)
+	router.ServeHTTP(record, request)
+
+	var directory []models.FileDescriptor
+	err := json.Unmarshal([]byte(record.Body.String()), &directory)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+		t.Fail()
+	}
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, len(directory), 1)
+	assert.Equal(t, directory[0].Name, "project (Olivia)")
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/file?path="+url.QueryEscape("/Shared with me/project (Olivia)/plan.txt"), nil)
+	request.Header.Add("Authorization", "Bearer "+guest.Token)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, record.Body.String(), "plan")
+
+	// A read-only folder can not be modified
+	assert.Equal(t, upload(), 403)
+
+	var grantID int = share(models.GrantWrite)
+	assert.Equal(t, upload(), 201)
+	b, _ := ioutil.ReadFile(filepath.Join(home, "project", "notes.txt"))
+	assert.Equal(t, string(b), "notes")
+
+	// The shared folder itself belongs to its owner
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("PUT", "/v1/delete/path", bytes.NewBuffer([]byte(`{"path": "/Shared with me/project (Olivia)"}`)))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", "Bearer "+guest.Token)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 403)
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("DELETE", "/v1/grant/"+strconv.Itoa(grantID), nil)
+	request.Header.Add("Authorization", "Bearer "+owner.Token)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/file?path="+url.QueryEscape("/Shared with me/project (Olivia)/plan.txt"), nil)
+	request.Header.Add("Authorization", "Bearer "+guest.Token)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 404)
+
+	utils.CleanUser(guest.ID, guest.Token, t, router)
+	utils.CleanUser(owner.ID, owner.Token, t, router)
+	db.CloseDB()
+}
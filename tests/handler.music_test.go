@@ -0,0 +1,152 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"rakoon/rakoon-back/db"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/routes"
+	"rakoon/rakoon-back/tests/utils"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// An ID3v2.3 frame
+func id3Frame(ID string, data []byte) []byte {
+	var frame []byte = binary.BigEndian.AppendUint32([]byte(ID), uint32(len(data)))
+	return append(append(frame, 0, 0), data...)
+}
+
+// An MP3 file of constant bit rate frames (128 kbit/s, 44.1 kHz) and ID3v2.3 text tags, with a cover when it is not empty
+func taggedMP3(frames int, tags map[string]string, cover []byte) []byte {
+	var data []byte
+	for ID, value := range tags {
+		data = append(data, id3Frame(ID, append([]byte{0}, value...))...)
+	}
+	if len(cover) > 0 {
+		data = append(data, id3Frame("APIC", append([]byte("\x00image/png\x00\x03\x00"), cover...))...)
+	}
+
+	var size int = len(data)
+	var mp3 []byte = []byte{'I', 'D', '3', 3, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	mp3 = append(mp3, data...)
+	for i := 0; i < frames; i++ {
+		var frame = make([]byte, 417)
+		copy(frame, []byte{0xff, 0xfb, 0x90, 0x64})
+		mp3 = append(mp3, frame...)
+	}
+	return mp3
+}
+
+// Asserts the tags of the audio files are browsed by artist and album, and the tracks are streamed
+func TestMusic(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Heidi", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Heidi", "qwerty1234", t, router)
+
+	var upload = func(name string, content []byte) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("path", "/")
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write(content)
+		writer.Close()
+
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest("POST", "/v1/file", &body)
+		request.Header.Add("Content-Type", writer.FormDataContentType())
+		request.Header.Add("Authorization", "Bearer "+user.Token)
+		router.ServeHTTP(record, request)
+		assert.Equal(t, record.Code, 201)
+	}
+
+	var get = func(url string, value interface{}) *httptest.ResponseRecorder {
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", url, nil)
+		request.Header.Add("Authorization", "Bearer "+user.Token)
+		router.ServeHTTP(record, request)
+		if value != nil {
+			assert.Equal(t, record.Code, 200)
+			err := json.Unmarshal(record.Body.Bytes(), value)
+			if err != nil {
+				log.Fatal("Bad output: ", err.Error())
+			}
+		}
+		return record
+	}
+
+	upload("second.mp3", taggedMP3(100, map[string]string{"TIT2": "Second song", "TPE1": "The Raccoons", "TALB": "Night", "TRCK": "2/2", "TYER": "1999"}, nil))
+	upload("first.mp3", taggedMP3(50, map[string]string{"TIT2": "First song", "TPE1": "The Raccoons", "TALB": "Night", "TRCK": "1/2", "TYER": "1999"}, []byte("cover")))
+	upload("untitled.mp3", taggedMP3(10, nil, nil))
+
+	// The tags are read in the background
+	var artists []models.Artist
+	get("/v1/music/artists", &artists)
+	for i := 0; i < 50 && (len(artists) != 2 || artists[1].Tracks != 2); i++ {
+		time.Sleep(100 * time.Millisecond)
+		get("/v1/music/artists", &artists)
+	}
+	assert.Equal(t, len(artists), 2)
+	assert.Equal(t, artists[0].Name, "")
+	assert.Equal(t, artists[1].Name, "The Raccoons")
+	assert.Equal(t, artists[1].Albums, 1)
+
+	var albums []models.Album
+	get("/v1/music/albums?artist=The+Raccoons", &albums)
+	assert.Equal(t, len(albums), 1)
+	assert.Equal(t, albums[0].Name, "Night")
+	assert.Equal(t, albums[0].Year, 1999)
+	assert.Equal(t, albums[0].Tracks, 2)
+	assert.Equal(t, albums[0].CoverTrackID != nil, true)
+
+	var tracks []models.Track
+	get("/v1/music/tracks?artist=The+Raccoons&album=Night", &tracks)
+	assert.Equal(t, len(tracks), 2)
+	assert.Equal(t, tracks[0].Title, "First song")
+	assert.Equal(t, tracks[0].TrackNumber, 1)
+	assert.Equal(t, tracks[0].HasCover, true)
+	assert.Equal(t, int(tracks[0].Duration*10), 13)
+	assert.Equal(t, tracks[1].Path, "/second.mp3")
+
+	// A file without tags is titled after its name
+	get("/v1/music/tracks?artist=", &tracks)
+	assert.Equal(t, len(tracks), 1)
+	assert.Equal(t, tracks[0].Title, "untitled")
+
+	// Players seek in the tracks, and send the token in the query
+	get("/v1/music/tracks?album=Night", &tracks)
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/v1/music/track/"+strconv.Itoa(tracks[0].ID)+"?token="+user.Token, nil)
+	request.Header.Add("Range", "bytes=0-9")
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 206)
+	assert.Equal(t, record.Header().Get("Content-Type"), "audio/mpeg")
+	assert.Equal(t, record.Body.String()[:3], "ID3")
+
+	record = get("/v1/music/track/"+strconv.Itoa(*albums[0].CoverTrackID)+"/cover", nil)
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, record.Header().Get("Content-Type"), "image/png")
+	assert.Equal(t, record.Header().Get("X-Content-Type-Options"), "nosniff")
+	assert.Equal(t, record.Body.String(), "cover")
+	assert.Equal(t, get("/v1/music/track/"+strconv.Itoa(tracks[1].ID)+"/cover", nil).Code, 404)
+	assert.Equal(t, get("/v1/music/track/0", nil).Code, 404)
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"rakoon/rakoon-back/db"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/routes"
+	"rakoon/rakoon-back/tests/utils"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// Asserts a role given to a group grants its permissions to the members
+func TestGroupRole(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+
+	var admin models.UserCreate = utils.CreateUser("Ada", "qwerty1234", t, router)
+	db.DB.MustExec("INSERT INTO user_roles (user_id, role_id) SELECT $1, id FROM roles WHERE name = 'admin'", admin.ID)
+	admin.Token = utils.ConnectUser("Ada", "qwerty1234", t, router)
+	var member models.UserCreate = utils.CreateUser("Max", "qwerty1234", t, router)
+	member.Token = utils.ConnectUser("Max", "qwerty1234", t, router)
+
+	// Only the users allowed to manage roles can see them
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/v1/roles", nil)
+	request.Header.Add("Authorization", "Bearer "+member.Token)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 403)
+
+	var send = func(method string, url string, body string) *httptest.ResponseRecorder {
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest(method, url, bytes.NewBuffer([]byte(body)))
+		request.Header.Add("Content-Type", "application/json")
+		request.Header.Add("Authorization", "Bearer "+admin.Token)
+		router.ServeHTTP(record, request)
+		return record
+	}
+
+	record = send("POST", "/v1/role", `{"name": "archivist", "permissions": ["unlimited_quota"]}`)
+	assert.Equal(t, record.Code, 201)
+	var role models.Role
+	err := json.Unmarshal([]byte(record.Body.String()), &role)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+		t.Fail()
+	}
+
+	record = send("POST", "/v1/group", `{"name": "archives"}`)
+	assert.Equal(t, record.Code, 201)
+	var group models.Group
+	err = json.Unmarshal([]byte(record.Body.String()), &group)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+		t.Fail()
+	}
+
+	record = send("PUT", "/v1/group/"+strconv.Itoa(group.ID)+"/member/"+strconv.Itoa(member.ID), "")
+	assert.Equal(t, record.Code, 200)
+	record = send("PUT", "/v1/group/"+strconv.Itoa(group.ID)+"/role/"+strconv.Itoa(role.ID), "")
+	assert.Equal(t, record.Code, 200)
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/user/"+strconv.Itoa(member.ID)+"/permissions", nil)
+	request.Header.Add("Authorization", "Bearer "+member.Token)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+
+	var permissions struct {
+		Permissions []string `json:"permissions"`
+	}
+	err = json.Unmarshal([]byte(record.Body.String()), &permissions)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+		t.Fail()
+	}
+	var unlimited bool
+	for _, permission := range permissions.Permissions {
+		unlimited = unlimited || permission == models.PermissionUnlimitedQuota
+	}
+	assert.Equal(t, unlimited, true)
+
+	send("DELETE", "/v1/group/"+strconv.Itoa(group.ID), "")
+	send("DELETE", "/v1/role/"+strconv.Itoa(role.ID), "")
+	utils.CleanUser(member.ID, member.Token, t, router)
+	utils.CleanUser(admin.ID, admin.Token, t, router)
+	db.CloseDB()
+}
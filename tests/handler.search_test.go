@@ -0,0 +1,182 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/db"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/routes"
+	"rakoon/rakoon-back/storage"
+	"rakoon/rakoon-back/tests/utils"
+	"rakoon/rakoon-back/watcher"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// Asserts files are found by name, by filters and by their content once indexed
+func TestSearch(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Sam", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Sam", "qwerty1234", t, router)
+
+	home, _ := storage.HomeDir(user.ID)
+	os.MkdirAll(filepath.Join(home, "work", "2020"), 0755)
+	ioutil.WriteFile(filepath.Join(home, "work", "2020", "quarterly-report.pdf"), []byte("not really a pdf"), 0644)
+	ioutil.WriteFile(filepath.Join(home, "work", "photo.png"), make([]byte, 2048), 0644)
+	ioutil.WriteFile(filepath.Join(home, ".secret-report.txt"), []byte("hidden"), 0644)
+
+	var find = func(query string) []models.SearchResult {
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/v1/search?"+query, nil)
+		request.Header.Add("Authorization", "Bearer "+user.Token)
+		router.ServeHTTP(record, request)
+		assert.Equal(t, record.Code, 200)
+
+		var results []models.SearchResult
+		err := json.Unmarshal([]byte(record.Body.String()), &results)
+		if err != nil {
+			log.Fatal("Bad output: ", err.Error())
+			t.Fail()
+		}
+		return results
+	}
+
+	// The content of an uploaded file is indexed
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("path", "/work")
+	part, _ := writer.CreateFormFile("file", "minutes.md")
+	part.Write([]byte("The budget of the raccoon project was approved."))
+	writer.Close()
+
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/v1/file", &body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+	request.Header.Add("Authorization", "Bearer "+user.Token)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 201)
+
+	var results []models.SearchResult = find("q=qrtrep")
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Path, "/work/2020/quarterly-report.pdf")
+	assert.Equal(t, results[0].Type, storage.TypePdf)
+
+	results = find("q=*.png")
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Path, "/work/photo.png")
+
+	// Hidden files are only searched on demand
+	assert.Equal(t, len(find("q=report")), 1)
+	assert.Equal(t, len(find("q=report&hidden=true")), 2)
+
+	assert.Equal(t, len(find("type=image,pdf")), 2)
+	assert.Equal(t, len(find("type=directory&path=/work")), 1)
+	assert.Equal(t, len(find("minSize=1024")), 1)
+	assert.Equal(t, len(find("after=2000-01-01&before=2000-12-31")), 0)
+
+	// The index is updated in the background
+	results = find("content=raccoon+budget")
+	for i := 0; i < 50 && len(results) == 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+		results = find("content=raccoon+budget")
+	}
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Path, "/work/minutes.md")
+
+	// The index follows the renamed files
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("PUT", "/v1/path", bytes.NewBuffer([]byte(`{"originalPath": "/work/minutes.md", "newPath": "/minutes.md", "name": "minutes.md"}`)))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", "Bearer "+user.Token)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 201)
+
+	results = find("content=raccoon")
+	for i := 0; i < 50 && (len(results) != 1 || results[0].Path != "/minutes.md"); i++ {
+		time.Sleep(100 * time.Millisecond)
+		results = find("content=raccoon")
+	}
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Path, "/minutes.md")
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/search?match=unknown", nil)
+	request.Header.Add("Authorization", "Bearer "+user.Token)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 400)
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
+
+// Asserts the files written behind the API's back are indexed once the watcher sees them
+func TestSearchWatchedChanges(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Walt", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Walt", "qwerty1234", t, router)
+	home, _ := storage.HomeDir(user.ID)
+
+	storageWatcher, err := watcher.Start(100 * time.Millisecond)
+	if err != nil {
+		log.Fatal("Could not watch storage: ", err.Error())
+		t.Fail()
+	}
+	defer storageWatcher.Close()
+
+	var find = func() []models.SearchResult {
+		var results []models.SearchResult
+		for i := 0; i < 50; i++ {
+			record := httptest.NewRecorder()
+			request, _ := http.NewRequest("GET", "/v1/search?content=seeded", nil)
+			request.Header.Add("Authorization", "Bearer "+user.Token)
+			router.ServeHTTP(record, request)
+			assert.Equal(t, record.Code, 200)
+
+			json.Unmarshal([]byte(record.Body.String()), &results)
+			if len(results) > 0 {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		return results
+	}
+
+	os.Mkdir(filepath.Join(home, "downloads"), 0755)
+	ioutil.WriteFile(filepath.Join(home, "downloads", "readme.txt"), []byte("This file was seeded by a torrent."), 0644)
+
+	var results []models.SearchResult = find()
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Path, "/downloads/readme.txt")
+
+	os.Rename(filepath.Join(home, "downloads"), filepath.Join(home, "torrents"))
+	results = find()
+	for i := 0; i < 50 && len(results) > 0 && results[0].Path != "/torrents/readme.txt"; i++ {
+		time.Sleep(100 * time.Millisecond)
+		results = find()
+	}
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Path, "/torrents/readme.txt")
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
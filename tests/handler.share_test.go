@@ -0,0 +1,248 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/db"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/routes"
+	"rakoon/rakoon-back/storage"
+	"rakoon/rakoon-back/tests/utils"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// Asserts a shared file can be downloaded without an account, within the limits of the share
+func TestPublicShare(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Sharon", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Sharon", "qwerty1234", t, router)
+	var bearer = "Bearer " + user.Token
+
+	home, _ := storage.HomeDir(user.ID)
+	ioutil.WriteFile(filepath.Join(home, "report.txt"), []byte("quarterly"), 0644)
+
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/v1/share", bytes.NewBuffer([]byte(`{"path": "/report.txt", "password": "secret", "maxDownloads": 1}`)))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 201)
+
+	var share models.Share
+	err := json.Unmarshal([]byte(record.Body.String()), &share)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+		t.Fail()
+	}
+	assert.Equal(t, share.HasPassword, true)
+
+	// The password is required
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/public/share/"+share.Token+"/download", nil)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 401)
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("POST", "/v1/public/share/"+share.Token+"/unlock", bytes.NewBuffer([]byte(`{"password": "wrong"}`)))
+	request.Header.Add("Content-Type", "application/json")
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 403)
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("POST", "/v1/public/share/"+share.Token+"/unlock", bytes.NewBuffer([]byte(`{"password": "secret"}`)))
+	request.Header.Add("Content-Type", "application/json")
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+
+	var unlock map[string]string
+	err = json.Unmarshal([]byte(record.Body.String()), &unlock)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+		t.Fail()
+	}
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/public/share/"+share.Token+"/download?key="+unlock["key"]+"&inline=true", nil)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, record.Body.String(), "quarterly")
+	// A shared document is never displayed on the API's origin
+	assert.Equal(t, record.Header().Get("Content-Disposition"), `attachment; filename=report.txt`)
+	assert.Equal(t, record.Header().Get("X-Content-Type-Options"), "nosniff")
+	assert.Equal(t, record.Header().Get("Content-Security-Policy"), "sandbox")
+	var ticket *httptest.ResponseRecorder = record
+
+	// The only download allowed was used
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/public/share/"+share.Token+"/download?key="+unlock["key"], nil)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 410)
+
+	// A range request only continues the download it was counted with
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/public/share/"+share.Token+"/download?key="+unlock["key"], nil)
+	request.Header.Add("Range", "bytes=1-")
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 410)
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/public/share/"+share.Token+"/download?key="+unlock["key"], nil)
+	request.Header.Add("Range", "bytes=1-")
+	for _, cookie := range ticket.Result().Cookies() {
+		request.AddCookie(cookie)
+	}
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 206)
+	assert.Equal(t, record.Body.String(), "uarterly")
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("DELETE", "/v1/share/"+strconv.Itoa(share.ID), nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/public/share/"+share.Token, nil)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 404)
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
+
+// Asserts the expiry date of a share keeps the time zone it was given in
+func TestShareExpiry(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Tempus", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Tempus", "qwerty1234", t, router)
+	var bearer = "Bearer " + user.Token
+
+	home, _ := storage.HomeDir(user.ID)
+	ioutil.WriteFile(filepath.Join(home, "report.txt"), []byte("quarterly"), 0644)
+
+	// An hour from now, written ten hours behind UTC
+	var expiresOn time.Time = time.Now().Add(time.Hour).In(time.FixedZone("HST", -10*3600)).Truncate(time.Second)
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/v1/share", bytes.NewBuffer([]byte(`{"path": "/report.txt", "expiresOn": "`+expiresOn.Format(time.RFC3339)+`"}`)))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 201)
+
+	var share models.Share
+	err := json.Unmarshal([]byte(record.Body.String()), &share)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+		t.Fail()
+	}
+	assert.Equal(t, share.ExpiresOn != nil && share.ExpiresOn.Equal(expiresOn), true)
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/public/share/"+share.Token, nil)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
+
+// Asserts an upload link accepts files without exposing the folder content
+func TestDropBoxShare(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Dropper", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Dropper", "qwerty1234", t, router)
+	var bearer = "Bearer " + user.Token
+
+	home, _ := storage.HomeDir(user.ID)
+	os.Mkdir(filepath.Join(home, "inbox"), 0755)
+	ioutil.WriteFile(filepath.Join(home, "inbox", "invoice.pdf"), []byte("private"), 0644)
+
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/v1/share", bytes.NewBuffer([]byte(`{"path": "/inbox", "kind": "upload", "maxSize": 1024, "allowedTypes": ["pdf"]}`)))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 201)
+
+	var share models.Share
+	err := json.Unmarshal([]byte(record.Body.String()), &share)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+		t.Fail()
+	}
+
+	var drop = func(name string, content string) int {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write([]byte(content))
+		writer.Close()
+
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest("POST", "/v1/public/share/"+share.Token+"/upload", &body)
+		request.Header.Add("Content-Type", writer.FormDataContentType())
+		router.ServeHTTP(record, request)
+		return record.Code
+	}
+
+	// An existing file is never replaced
+	assert.Equal(t, drop("invoice.pdf", "dropped"), 201)
+	b, _ := ioutil.ReadFile(filepath.Join(home, "inbox", "invoice.pdf"))
+	assert.Equal(t, string(b), "private")
+	b, _ = ioutil.ReadFile(filepath.Join(home, "inbox", "invoice (1).pdf"))
+	assert.Equal(t, string(b), "dropped")
+
+	assert.Equal(t, drop("script.sh", "echo"), 415)
+	assert.Equal(t, drop("large.pdf", string(make([]byte, 2048))), 413)
+
+	// The folder content can not be seen nor downloaded
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/public/share/"+share.Token+"/download", nil)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 403)
+
+	// The owner is notified of the drop
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/notifications", nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+
+	var notifications []models.Notification
+	err = json.Unmarshal([]byte(record.Body.String()), &notifications)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+		t.Fail()
+	}
+	assert.Equal(t, len(notifications), 1)
+	assert.Equal(t, notifications[0].Path, "/inbox/invoice (1).pdf")
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"rakoon/rakoon-back/db"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/routes"
+	"rakoon/rakoon-back/tests/utils"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// Asserts the changes of the user's files are pushed on their event stream, which ends when they log out
+func TestEventStream(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Eve", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Eve", "qwerty1234", t, router)
+	var other models.UserCreate = utils.CreateUser("Mallory", "qwerty1234", t, router)
+	other.Token = utils.ConnectUser("Mallory", "qwerty1234", t, router)
+
+	// The stream needs a real connection, the token is sent in the query like EventSource does
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/v1/events?token=" + user.Token)
+	if err != nil {
+		t.Fatal("Could not open stream: ", err.Error())
+	}
+	defer response.Body.Close()
+	assert.Equal(t, response.StatusCode, 200)
+	assert.Equal(t, strings.HasPrefix(response.Header.Get("Content-Type"), "text/event-stream"), true)
+
+	var createFolder = func(token string, name string) {
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest("POST", "/v1/folder", bytes.NewBuffer([]byte(`{"path": "/`+name+`", "name": "`+name+`"}`)))
+		request.Header.Add("Content-Type", "application/json")
+		request.Header.Add("Authorization", "Bearer "+token)
+		router.ServeHTTP(record, request)
+		assert.Equal(t, record.Code, 201)
+	}
+
+	// The folder of the other user is not visible
+	createFolder(other.Token, "private")
+	createFolder(user.Token, "photos")
+
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("PUT", "/v1/user/"+strconv.Itoa(user.ID)+"/logout", nil)
+	request.Header.Add("Authorization", "Bearer "+user.Token)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+
+	var received []string
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "data:") {
+			received = append(received, scanner.Text())
+		}
+	}
+	assert.Equal(t, len(received), 2)
+	assert.Equal(t, strings.Contains(received[0], `"type":"created","path":"/photos"`), true)
+	assert.Equal(t, strings.Contains(received[1], `"type":"logout"`), true)
+
+	user.Token = utils.ConnectUser("Eve", "qwerty1234", t, router)
+	utils.CleanUser(user.ID, user.Token, t, router)
+	utils.CleanUser(other.ID, other.Token, t, router)
+	db.CloseDB()
+}
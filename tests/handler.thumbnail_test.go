@@ -0,0 +1,135 @@
+package test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"rakoon/rakoon-back/db"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/routes"
+	"rakoon/rakoon-back/tests/utils"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	_ "golang.org/x/image/webp"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// A JPEG whose left half is red and right half is blue, with an EXIF orientation
+func orientedJPEG(width int, height int, orientation byte) []byte {
+	picture := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				picture.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				picture.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	var encoded bytes.Buffer
+	jpeg.Encode(&encoded, picture, nil)
+
+	// APP1 segment holding a little endian TIFF header and a single IFD entry: the orientation
+	var exif []byte = append([]byte("Exif\x00\x00II*\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00"), orientation, 0, 0, 0, 0, 0, 0, 0)
+	var segment []byte = append([]byte{0xff, 0xe1, byte((len(exif) + 2) >> 8), byte(len(exif) + 2)}, exif...)
+
+	var data []byte = encoded.Bytes()
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+// Asserts the thumbnails fit in the requested size, are turned upright and follow the changes of their image
+func TestThumbnail(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Frank", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Frank", "qwerty1234", t, router)
+
+	var upload = func(name string, content []byte) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("path", "/")
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write(content)
+		writer.Close()
+
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest("POST", "/v1/file", &body)
+		request.Header.Add("Content-Type", writer.FormDataContentType())
+		request.Header.Add("Authorization", "Bearer "+user.Token)
+		router.ServeHTTP(record, request)
+		assert.Equal(t, record.Code, 201)
+	}
+
+	var thumbnail = func(query string, etag string) *httptest.ResponseRecorder {
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/v1/thumbnail?"+query, nil)
+		request.Header.Add("Authorization", "Bearer "+user.Token)
+		if len(etag) > 0 {
+			request.Header.Add("If-None-Match", etag)
+		}
+		router.ServeHTTP(record, request)
+		return record
+	}
+
+	// The photo was taken with the camera turned, it is displayed rotated by 90 degrees clockwise
+	upload("photo.jpg", orientedJPEG(400, 200, 6))
+	record := thumbnail("path=/photo.jpg&size=128", "")
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, record.Header().Get("Content-Type"), "image/jpeg")
+	picture, format, err := image.Decode(record.Body)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+	}
+	assert.Equal(t, format, "jpeg")
+	assert.Equal(t, picture.Bounds().Dx(), 64)
+	assert.Equal(t, picture.Bounds().Dy(), 128)
+	red, _, blue, _ := picture.At(32, 16).RGBA()
+	assert.Equal(t, red > blue, true)
+
+	// The cached thumbnail is revalidated, then generated again once the photo changed
+	var etag string = record.Header().Get("ETag")
+	assert.Equal(t, thumbnail("path=/photo.jpg&size=128", etag).Code, 304)
+	upload("photo.jpg", orientedJPEG(200, 200, 1))
+	record = thumbnail("path=/photo.jpg&size=128", etag)
+	assert.Equal(t, record.Code, 200)
+	picture, _, _ = image.Decode(record.Body)
+	assert.Equal(t, picture.Bounds().Dx(), 128)
+	assert.Equal(t, picture.Bounds().Dy(), 128)
+
+	// Images are not enlarged
+	record = thumbnail("path=/photo.jpg&size=1024&format=webp", "")
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, record.Header().Get("Content-Type"), "image/webp")
+	picture, format, _ = image.Decode(record.Body)
+	assert.Equal(t, format, "webp")
+	assert.Equal(t, picture.Bounds().Dx(), 200)
+
+	// The other files get a placeholder
+	upload("notes.txt", []byte("Not an image"))
+	record = thumbnail("path=/notes.txt", "")
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, record.Header().Get("X-Thumbnail-Placeholder"), "true")
+	assert.Equal(t, record.Header().Get("Content-Type"), "image/jpeg")
+	assert.Equal(t, len(record.Header().Get("ETag")) > 0, true)
+	picture, _, _ = image.Decode(record.Body)
+	assert.Equal(t, picture.Bounds().Dx(), 256)
+
+	assert.Equal(t, thumbnail("path=/photo.jpg&size=300", "").Code, 400)
+	assert.Equal(t, thumbnail("path=/photo.jpg&format=gif", "").Code, 400)
+	assert.Equal(t, thumbnail("path=/missing.jpg", "").Code, 404)
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
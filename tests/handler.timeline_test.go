@@ -0,0 +1,211 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"rakoon/rakoon-back/db"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/routes"
+	"rakoon/rakoon-back/tests/utils"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// exifTag is an entry of an EXIF IFD. The pointer tags give the index of the IFD they point to in sub.
+type exifTag struct {
+	tag   uint16
+	kind  uint16
+	count uint32
+	value []byte
+	sub   int
+}
+
+func asciiTag(tag uint16, value string) exifTag {
+	return exifTag{tag: tag, kind: 2, count: uint32(len(value) + 1), value: append([]byte(value), 0)}
+}
+
+func shortTag(tag uint16, value uint16) exifTag {
+	var data []byte = binary.LittleEndian.AppendUint16(nil, value)
+	return exifTag{tag: tag, kind: 3, count: 1, value: data}
+}
+
+func rationalTag(tag uint16, values ...uint32) exifTag {
+	var data []byte
+	for _, value := range values {
+		data = binary.LittleEndian.AppendUint32(data, value)
+	}
+	return exifTag{tag: tag, kind: 5, count: uint32(len(values) / 2), value: data}
+}
+
+func pointerTag(tag uint16, sub int) exifTag {
+	return exifTag{tag: tag, kind: 4, count: 1, sub: sub}
+}
+
+// A gray JPEG holding little endian EXIF IFDs, the first one is IFD0
+func exifJPEG(width int, height int, ifds ...[]exifTag) []byte {
+	var offsets []uint32
+	var offset uint32 = 8
+	for _, ifd := range ifds {
+		offsets = append(offsets, offset)
+		offset += uint32(2 + 12*len(ifd) + 4)
+	}
+
+	// The values longer than 4 bytes follow the IFDs
+	var tiff []byte = []byte("II*\x00\x08\x00\x00\x00")
+	var values []byte
+	for _, ifd := range ifds {
+		tiff = binary.LittleEndian.AppendUint16(tiff, uint16(len(ifd)))
+		for _, entry := range ifd {
+			tiff = binary.LittleEndian.AppendUint16(tiff, entry.tag)
+			tiff = binary.LittleEndian.AppendUint16(tiff, entry.kind)
+			tiff = binary.LittleEndian.AppendUint32(tiff, entry.count)
+			if entry.sub > 0 {
+				tiff = binary.LittleEndian.AppendUint32(tiff, offsets[entry.sub])
+			} else if len(entry.value) <= 4 {
+				tiff = append(tiff, append(entry.value, make([]byte, 4-len(entry.value))...)...)
+			} else {
+				tiff = binary.LittleEndian.AppendUint32(tiff, offset+uint32(len(values)))
+				values = append(values, entry.value...)
+			}
+		}
+		tiff = binary.LittleEndian.AppendUint32(tiff, 0)
+	}
+
+	var exif []byte = append(append([]byte("Exif\x00\x00"), tiff...), values...)
+	var segment []byte = append([]byte{0xff, 0xe1, byte((len(exif) + 2) >> 8), byte(len(exif) + 2)}, exif...)
+
+	var encoded bytes.Buffer
+	jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, width, height)), nil)
+	var data []byte = encoded.Bytes()
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+// Asserts the photos are listed by capture date, grouped and paginated, and follow the changes of the files
+func TestTimeline(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Grace", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Grace", "qwerty1234", t, router)
+
+	var upload = func(name string, content []byte) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("path", "/")
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write(content)
+		writer.Close()
+
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest("POST", "/v1/file", &body)
+		request.Header.Add("Content-Type", writer.FormDataContentType())
+		request.Header.Add("Authorization", "Bearer "+user.Token)
+		router.ServeHTTP(record, request)
+		assert.Equal(t, record.Code, 201)
+	}
+
+	var timeline = func(query string) ([]models.TimelineGroup, string) {
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/v1/timeline?"+query, nil)
+		request.Header.Add("Authorization", "Bearer "+user.Token)
+		router.ServeHTTP(record, request)
+		assert.Equal(t, record.Code, 200)
+
+		var groups []models.TimelineGroup
+		err := json.Unmarshal(record.Body.Bytes(), &groups)
+		if err != nil {
+			log.Fatal("Bad output: ", err.Error())
+		}
+		return groups, record.Header().Get("X-Total-Count")
+	}
+
+	// A photo taken with the camera turned, at the Eiffel tower, another one taken earlier and a screenshot without EXIF
+	upload("tower.jpg", exifJPEG(40, 30,
+		[]exifTag{asciiTag(0x010f, "Canon"), asciiTag(0x0110, "EOS 5D"), shortTag(0x0112, 6), pointerTag(0x8769, 1), pointerTag(0x8825, 2)},
+		[]exifTag{asciiTag(0x9003, "2021:07:14 18:30:05")},
+		[]exifTag{asciiTag(1, "N"), rationalTag(2, 48, 1, 51, 1, 30, 1), asciiTag(3, "E"), rationalTag(4, 2, 1, 17, 1, 30, 1)},
+	))
+	upload("beach.jpg", exifJPEG(30, 20,
+		[]exifTag{pointerTag(0x8769, 1)},
+		[]exifTag{asciiTag(0x9003, "2021:07:02 09:00:00")},
+	))
+	var screenshot bytes.Buffer
+	png.Encode(&screenshot, image.NewGray(image.Rect(0, 0, 16, 9)))
+	upload("screenshot.png", screenshot.Bytes())
+	upload("notes.txt", []byte("Not a photo"))
+
+	// The metadata are read in the background
+	groups, total := timeline("group=month")
+	for i := 0; i < 50 && total != "3"; i++ {
+		time.Sleep(100 * time.Millisecond)
+		groups, total = timeline("group=month")
+	}
+	assert.Equal(t, total, "3")
+	assert.Equal(t, len(groups), 2)
+	assert.Equal(t, groups[0].Key, time.Now().Format("2006-01"))
+	assert.Equal(t, groups[0].Photos[0].Path, "/screenshot.png")
+	assert.Equal(t, groups[0].Photos[0].TakenOn == nil, true)
+	assert.Equal(t, groups[1].Key, "2021-07")
+	assert.Equal(t, groups[1].Count, 2)
+
+	var tower models.Photo = groups[1].Photos[0]
+	assert.Equal(t, tower.Path, "/tower.jpg")
+	assert.Equal(t, tower.Width, 30)
+	assert.Equal(t, tower.Height, 40)
+	assert.Equal(t, *tower.CameraMake, "Canon")
+	assert.Equal(t, *tower.CameraModel, "EOS 5D")
+	assert.Equal(t, tower.TakenOn.Format("2006-01-02 15:04:05"), "2021-07-14 18:30:05")
+	assert.Equal(t, int(*tower.Latitude*1000), 48858)
+	assert.Equal(t, int(*tower.Longitude*1000), 2291)
+	assert.Equal(t, groups[1].Photos[1].Path, "/beach.jpg")
+
+	// A page may hold a part of a group only
+	groups, _ = timeline("group=day&offset=1&limit=1")
+	assert.Equal(t, len(groups), 1)
+	assert.Equal(t, groups[0].Key, "2021-07-14")
+	assert.Equal(t, groups[0].Count, 1)
+	groups, _ = timeline("group=year&offset=2")
+	assert.Equal(t, len(groups), 1)
+	assert.Equal(t, groups[0].Key, "2021")
+	assert.Equal(t, groups[0].Count, 2)
+	assert.Equal(t, len(groups[0].Photos), 1)
+
+	// The timeline follows the deleted files
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("PUT", "/v1/delete/path", bytes.NewBuffer([]byte(`{"path": "/screenshot.png"}`)))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", "Bearer "+user.Token)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+
+	for i := 0; i < 50 && total != "2"; i++ {
+		time.Sleep(100 * time.Millisecond)
+		groups, total = timeline("group=month")
+	}
+	assert.Equal(t, total, "2")
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/timeline?group=week", nil)
+	request.Header.Add("Authorization", "Bearer "+user.Token)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 400)
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
@@ -0,0 +1,491 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/db"
+	"rakoon/rakoon-back/events"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/routes"
+	"rakoon/rakoon-back/tests/utils"
+	"rakoon/rakoon-back/torrents"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// A client seeding on the loopback interface the folders of a directory
+func loopbackSeeder(dir string) *torrent.Client {
+	var config *torrent.ClientConfig = torrent.NewDefaultClientConfig()
+	config.DataDir = dir
+	config.Seed = true
+	config.NoDHT = true
+	config.ListenPort = 0
+	config.ListenHost = torrent.LoopbackListenHost
+	seeder, err := torrent.NewClient(config)
+	if err != nil {
+		log.Fatal("Could not start seeder: ", err.Error())
+	}
+	return seeder
+}
+
+// The .torrent file of a folder
+func folderTorrent(dir string, name string) []byte {
+	var info metainfo.Info = metainfo.Info{PieceLength: 32 << 10}
+	err := info.BuildFromFilePath(filepath.Join(dir, name))
+	if err != nil {
+		log.Fatal("Could not build torrent: ", err.Error())
+	}
+	var metaInfo metainfo.MetaInfo
+	metaInfo.InfoBytes, _ = bencode.Marshal(info)
+	var data bytes.Buffer
+	metaInfo.Write(&data)
+	return data.Bytes()
+}
+
+// Seeds a folder of the seeder's directory, and returns the torrent and its .torrent file
+func seedFolder(seeder *torrent.Client, dir string, name string) (*torrent.Torrent, []byte) {
+	var data []byte = folderTorrent(dir, name)
+	metaInfo, _ := metainfo.Load(bytes.NewReader(data))
+	seeded, _ := seeder.AddTorrent(metaInfo)
+	seeded.VerifyData()
+	return seeded, data
+}
+
+// Asserts a torrent is downloaded from a seeder in the chosen folder, and goes on after a restart of the engine
+func TestTorrent(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Ivan", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Ivan", "qwerty1234", t, router)
+
+	var submit = func(fields map[string]string, content []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		for name, value := range fields {
+			writer.WriteField(name, value)
+		}
+		if content != nil {
+			part, _ := writer.CreateFormFile("file", "album.torrent")
+			part.Write(content)
+		}
+		writer.Close()
+
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest("POST", "/v1/torrent", &body)
+		request.Header.Add("Content-Type", writer.FormDataContentType())
+		request.Header.Add("Authorization", "Bearer "+user.Token)
+		router.ServeHTTP(record, request)
+		return record
+	}
+	var upload = func(path string, content []byte) *httptest.ResponseRecorder {
+		return submit(map[string]string{"path": path}, content)
+	}
+
+	var request = func(method string, url string, body string, value interface{}) *httptest.ResponseRecorder {
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		request.Header.Add("Authorization", "Bearer "+user.Token)
+		router.ServeHTTP(record, request)
+		if value != nil {
+			assert.Equal(t, record.Code, 200)
+			err := json.Unmarshal(record.Body.Bytes(), value)
+			if err != nil {
+				log.Fatal("Bad output: ", err.Error())
+			}
+		}
+		return record
+	}
+
+	var get = func(ID int) models.TorrentJob {
+		var job models.TorrentJob
+		request("GET", "/v1/torrent/"+strconv.Itoa(ID), "", &job)
+		return job
+	}
+
+	// Waits for a job to leave a state
+	var wait = func(job models.TorrentJob, state string) models.TorrentJob {
+		for i := 0; i < 100 && job.State == state; i++ {
+			time.Sleep(100 * time.Millisecond)
+			job = get(job.ID)
+		}
+		return job
+	}
+
+	seedDir, _ := ioutil.TempDir("", "seeder")
+	defer os.RemoveAll(seedDir)
+	var content = make([]byte, 1<<20)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	os.MkdirAll(filepath.Join(seedDir, "album", "cd1"), 0755)
+	ioutil.WriteFile(filepath.Join(seedDir, "album", "cd1", "track.bin"), content, 0644)
+	ioutil.WriteFile(filepath.Join(seedDir, "album", "notes.txt"), []byte("Seeded on loopback."), 0644)
+	var seeder *torrent.Client = loopbackSeeder(seedDir)
+	defer seeder.Close()
+	seeded, metaInfo := seedFolder(seeder, seedDir, "album")
+
+	var home string = filepath.Join(rootPath, "users", strconv.Itoa(user.ID))
+	os.MkdirAll(filepath.Join(home, "downloads"), 0755)
+
+	// The engine must be running
+	assert.Equal(t, upload("/downloads", metaInfo).Code, 503)
+	err := torrents.Start(torrents.Config{Loopback: true, NoDHT: true})
+	if err != nil {
+		log.Fatal("Could not start torrent engine: ", err.Error())
+	}
+	defer torrents.Close()
+
+	// Malformed .torrent files and missing folders are refused
+	assert.Equal(t, upload("/downloads", []byte("not bencoded")).Code, 400)
+	assert.Equal(t, upload("/downloads", []byte("d4:infoi1ee")).Code, 400)
+	assert.Equal(t, upload("/downloads", []byte("d4:infod6:lengthi5e4:name1:x12:piece lengthi16384e6:pieces0:ee")).Code, 400)
+	assert.Equal(t, upload("/missing", metaInfo).Code, 404)
+
+	record := upload("/downloads", metaInfo)
+	assert.Equal(t, record.Code, 201)
+	var job models.TorrentJob
+	err = json.Unmarshal(record.Body.Bytes(), &job)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+	}
+	assert.Equal(t, job.Name, "album")
+	assert.Equal(t, job.Path, "/downloads")
+	assert.Equal(t, job.State, models.JobRunning)
+	assert.Equal(t, job.Total, int64(len(content)+len("Seeded on loopback.")))
+	assert.Equal(t, upload("/downloads", metaInfo).Code, 409)
+
+	// The job is saved, and resumed when the engine starts again
+	torrents.Close()
+	err = torrents.Start(torrents.Config{Loopback: true, NoDHT: true})
+	if err != nil {
+		log.Fatal("Could not restart torrent engine: ", err.Error())
+	}
+	assert.Equal(t, get(job.ID).State, models.JobRunning)
+
+	seeded.AddPeers([]torrent.PeerInfo{{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: torrents.Port()}}})
+	job = wait(job, models.JobRunning)
+	assert.Equal(t, job.State, models.JobDone)
+	assert.Equal(t, job.Completed, job.Total)
+	assert.Equal(t, job.FinishedOn != nil, true)
+
+	downloaded, err := ioutil.ReadFile(filepath.Join(home, "downloads", "album", "cd1", "track.bin"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, bytes.Equal(downloaded, content), true)
+	notes, _ := ioutil.ReadFile(filepath.Join(home, "downloads", "album", "notes.txt"))
+	assert.Equal(t, string(notes), "Seeded on loopback.")
+	var album models.TorrentJob = job
+
+	// The folder now exists, the torrent can not be downloaded there again
+	assert.Equal(t, upload("/downloads", metaInfo).Code, 409)
+
+	// The metadata of a magnet link is fetched from the peers, then the files to download are selected
+	os.MkdirAll(filepath.Join(seedDir, "singles"), 0755)
+	ioutil.WriteFile(filepath.Join(seedDir, "singles", "one.bin"), content[:100000], 0644)
+	ioutil.WriteFile(filepath.Join(seedDir, "singles", "two.bin"), content[100000:200000], 0644)
+	singles, _ := seedFolder(seeder, seedDir, "singles")
+	var magnet string = "magnet:?xt=urn:btih:" + singles.InfoHash().HexString() + "&dn=singles&x.pe=127.0.0.1:" + strconv.Itoa(seeder.LocalPort())
+	assert.Equal(t, submit(map[string]string{"path": "/downloads", "magnet": "magnet:?dn=nothing"}, nil).Code, 400)
+
+	record = submit(map[string]string{"path": "/downloads", "magnet": magnet, "select": "true"}, nil)
+	assert.Equal(t, record.Code, 201)
+	json.Unmarshal(record.Body.Bytes(), &job)
+	assert.Equal(t, job.State, models.TorrentMetadata)
+	job = wait(job, models.TorrentMetadata)
+	assert.Equal(t, job.State, models.TorrentWaiting)
+	assert.Equal(t, job.Name, "singles")
+	assert.Equal(t, job.Total, int64(200000))
+
+	var files []models.TorrentFile
+	request("GET", "/v1/torrent/"+strconv.Itoa(job.ID)+"/files", "", &files)
+	assert.Equal(t, len(files), 2)
+	assert.Equal(t, files[0].Path, "one.bin")
+	assert.Equal(t, files[1].Size, int64(100000))
+	assert.Equal(t, request("PUT", "/v1/torrent/"+strconv.Itoa(job.ID)+"/files", `{"files": ["three.bin"]}`, nil).Code, 400)
+
+	request("PUT", "/v1/torrent/"+strconv.Itoa(job.ID)+"/files", `{"files": ["two.bin"]}`, &job)
+	assert.Equal(t, job.State, models.JobRunning)
+	assert.Equal(t, job.Total, int64(100000))
+	assert.Equal(t, request("PUT", "/v1/torrent/"+strconv.Itoa(job.ID)+"/files", `{"files": ["one.bin"]}`, nil).Code, 409)
+	job = wait(job, models.JobRunning)
+	assert.Equal(t, job.State, models.JobDone)
+
+	downloaded, _ = ioutil.ReadFile(filepath.Join(home, "downloads", "singles", "two.bin"))
+	assert.Equal(t, bytes.Equal(downloaded, content[100000:200000]), true)
+	_, err = os.Stat(filepath.Join(home, "downloads", "singles", "one.bin"))
+	assert.Equal(t, os.IsNotExist(err), true)
+	_, err = os.Stat(filepath.Join(home, "downloads", "singles", "one.bin.part"))
+	assert.Equal(t, os.IsNotExist(err), true)
+
+	// The torrents are listed, and controlled while their changes are streamed
+	var subscription *events.Subscription = events.Subscribe()
+	defer subscription.Close()
+	os.MkdirAll(filepath.Join(seedDir, "unseeded"), 0755)
+	ioutil.WriteFile(filepath.Join(seedDir, "unseeded", "nobody.bin"), content[:50000], 0644)
+	record = upload("/downloads", folderTorrent(seedDir, "unseeded"))
+	assert.Equal(t, record.Code, 201)
+	json.Unmarshal(record.Body.Bytes(), &job)
+
+	var jobs []models.TorrentJob
+	request("GET", "/v1/torrents", "", &jobs)
+	assert.Equal(t, len(jobs), 3)
+	assert.Equal(t, jobs[0].ID, job.ID)
+	assert.Equal(t, jobs[0].ETA == nil, true)
+	assert.Equal(t, jobs[2].ID, album.ID)
+	assert.Equal(t, jobs[2].Completed, album.Total)
+	// The torrents of every user are only listed with the manage_torrents permission
+	assert.Equal(t, request("GET", "/v1/torrents?all=true", "", nil).Code, 403)
+
+	var url string = "/v1/torrent/" + strconv.Itoa(job.ID)
+	request("PUT", url+"/pause", "", &job)
+	assert.Equal(t, job.State, models.TorrentPaused)
+	assert.Equal(t, request("PUT", url+"/pause", "", nil).Code, 409)
+	request("PUT", url+"/resume", "", &job)
+	assert.Equal(t, job.State, models.JobRunning)
+	request("PUT", url+"/cancel", "", &job)
+	assert.Equal(t, job.State, models.JobCanceled)
+	assert.Equal(t, job.FinishedOn != nil, true)
+	assert.Equal(t, request("PUT", url+"/resume", "", nil).Code, 409)
+
+	var states []string
+	for len(subscription.C) > 0 {
+		event := <-subscription.C
+		if update, ok := event.Data.(models.TorrentJob); ok && event.Type == events.TorrentUpdated && update.ID == job.ID {
+			if len(states) <= 0 || states[len(states)-1] != update.State {
+				states = append(states, update.State)
+			}
+		}
+	}
+	assert.Equal(t, states, []string{models.JobRunning, models.TorrentPaused, models.JobRunning, models.JobCanceled})
+
+	// The jobs are removed with or without their data
+	assert.Equal(t, request("DELETE", url, "", nil).Code, 200)
+	assert.Equal(t, request("GET", url, "", nil).Code, 404)
+	assert.Equal(t, request("DELETE", "/v1/torrent/"+strconv.Itoa(album.ID)+"?data=true", "", nil).Code, 200)
+	_, err = os.Stat(filepath.Join(home, "downloads", "album"))
+	assert.Equal(t, os.IsNotExist(err), true)
+	var trash []models.TrashItem
+	request("GET", "/v1/trash", "", &trash)
+	assert.Equal(t, len(trash), 1)
+	assert.Equal(t, trash[0].Name, "album")
+	assert.Equal(t, request("DELETE", "/v1/torrent/"+strconv.Itoa(jobs[1].ID), "", nil).Code, 200)
+	_, err = os.Stat(filepath.Join(home, "downloads", "singles", "two.bin"))
+	assert.Equal(t, err, nil)
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
+
+// Asserts the .torrent files of the user are described, and the malformed ones refused
+func TestTorrentMetaInfo(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Ivan", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Ivan", "qwerty1234", t, router)
+
+	var request = func(path string) *httptest.ResponseRecorder {
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/v1/metainfo?path="+path, nil)
+		request.Header.Add("Authorization", "Bearer "+user.Token)
+		router.ServeHTTP(record, request)
+		return record
+	}
+
+	var home string = filepath.Join(rootPath, "users", strconv.Itoa(user.ID))
+	os.MkdirAll(filepath.Join(home, "album", "cd1"), 0755)
+	ioutil.WriteFile(filepath.Join(home, "album", "cd1", "track.bin"), make([]byte, 100000), 0644)
+	ioutil.WriteFile(filepath.Join(home, "album", "notes.txt"), []byte("Liner notes."), 0644)
+
+	var info metainfo.Info = metainfo.Info{PieceLength: 32 << 10}
+	err := info.BuildFromFilePath(filepath.Join(home, "album"))
+	if err != nil {
+		log.Fatal("Could not build torrent: ", err.Error())
+	}
+	var metaInfo metainfo.MetaInfo = metainfo.MetaInfo{
+		Announce:     "http://tracker.example/announce",
+		AnnounceList: [][]string{{"http://tracker.example/announce"}, {"udp://backup.example:6969"}},
+		Comment:      "Live at home",
+	}
+	metaInfo.InfoBytes, _ = bencode.Marshal(info)
+	file, _ := os.Create(filepath.Join(home, "album.torrent"))
+	metaInfo.Write(file)
+	file.Close()
+
+	record := request("/album.torrent")
+	assert.Equal(t, record.Code, 200)
+	var described models.TorrentInfo
+	err = json.Unmarshal(record.Body.Bytes(), &described)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+	}
+	assert.Equal(t, described.Name, "album")
+	assert.Equal(t, described.InfoHash, metaInfo.HashInfoBytes().HexString())
+	assert.Equal(t, described.InfoHashV2, "")
+	assert.Equal(t, described.TotalSize, int64(100012))
+	assert.Equal(t, described.PieceSize, int64(32<<10))
+	assert.Equal(t, described.Pieces, 4)
+	assert.Equal(t, described.Comment, "Live at home")
+	assert.Equal(t, described.Trackers, []string{"http://tracker.example/announce", "udp://backup.example:6969"})
+	assert.Equal(t, described.Files.IsDir, true)
+	assert.Equal(t, described.Files.Size, int64(100012))
+	assert.Equal(t, len(described.Files.Children), 2)
+	assert.Equal(t, described.Files.Children[0].Name, "cd1")
+	assert.Equal(t, described.Files.Children[0].Children[0].Name, "track.bin")
+	assert.Equal(t, described.Files.Children[0].Children[0].Size, int64(100000))
+	assert.Equal(t, described.Files.Children[1].Name, "notes.txt")
+
+	// Files which are not torrents, folders and missing files are refused
+	assert.Equal(t, request("/album/notes.txt").Code, 400)
+	assert.Equal(t, request("/album").Code, 400)
+	assert.Equal(t, request("/missing.torrent").Code, 404)
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
+
+// Asserts a .torrent file is built from a folder of the user, and that its content is seeded to the peers
+func TestTorrentCreate(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Ivan", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Ivan", "qwerty1234", t, router)
+
+	var request = func(method string, url string, body string, value interface{}) *httptest.ResponseRecorder {
+		record := httptest.NewRecorder()
+		request, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+		request.Header.Add("Authorization", "Bearer "+user.Token)
+		router.ServeHTTP(record, request)
+		if value != nil {
+			err := json.Unmarshal(record.Body.Bytes(), value)
+			if err != nil {
+				log.Fatal("Bad output: ", err.Error())
+			}
+		}
+		return record
+	}
+
+	// Creates a .torrent file and waits for its job to finish
+	var create = func(body string) models.Job {
+		var job models.Job
+		assert.Equal(t, request("POST", "/v1/metainfo", body, &job).Code, 202)
+		for i := 0; i < 100 && job.State == models.JobRunning; i++ {
+			time.Sleep(100 * time.Millisecond)
+			request("GET", "/v1/job/"+job.ID, "", &job)
+		}
+		return job
+	}
+
+	var home string = filepath.Join(rootPath, "users", strconv.Itoa(user.ID))
+	var content = make([]byte, 300000)
+	for i := range content {
+		content[i] = byte(i * 13)
+	}
+	os.MkdirAll(filepath.Join(home, "album", "cd1"), 0755)
+	ioutil.WriteFile(filepath.Join(home, "album", "cd1", "track.bin"), content, 0644)
+	ioutil.WriteFile(filepath.Join(home, "album", "notes.txt"), []byte("Shared from home."), 0644)
+
+	// The options are checked before the content is hashed
+	assert.Equal(t, request("POST", "/v1/metainfo", `{"path": "/album", "pieceSize": 12345}`, nil).Code, 400)
+	assert.Equal(t, request("POST", "/v1/metainfo", `{"path": "/album", "trackers": ["ftp://tracker.example"]}`, nil).Code, 400)
+	assert.Equal(t, request("POST", "/v1/metainfo", `{"path": "/"}`, nil).Code, 400)
+	assert.Equal(t, request("POST", "/v1/metainfo", `{"path": "/missing"}`, nil).Code, 404)
+	assert.Equal(t, request("POST", "/v1/metainfo", `{"path": "/album", "seed": true}`, nil).Code, 503)
+
+	// A v1 torrent is the same as the one of other clients
+	var job models.Job = create(`{"path": "/album/notes.txt"}`)
+	assert.Equal(t, job.State, models.JobDone)
+	var info metainfo.Info = metainfo.Info{PieceLength: 16 << 10}
+	info.BuildFromFilePath(filepath.Join(home, "album", "notes.txt"))
+	infoBytes, _ := bencode.Marshal(info)
+	var described models.TorrentInfo
+	assert.Equal(t, request("GET", "/v1/metainfo?path=/album/notes.txt.torrent", "", &described).Code, 200)
+	assert.Equal(t, described.InfoHash, metainfo.HashBytes(infoBytes).HexString())
+	assert.Equal(t, described.InfoHashV2, "")
+	os.Remove(filepath.Join(home, "album", "notes.txt.torrent"))
+
+	err := torrents.Start(torrents.Config{Loopback: true, NoDHT: true})
+	if err != nil {
+		log.Fatal("Could not start torrent engine: ", err.Error())
+	}
+	defer torrents.Close()
+
+	job = create(`{"path": "/album", "pieceSize": 32768, "hybrid": true, "seed": true, "private": true,
+		"comment": "Home recordings", "trackers": ["http://tracker.example/announce"]}`)
+	assert.Equal(t, job.State, models.JobDone)
+	assert.Equal(t, request("GET", "/v1/metainfo?path=/album.torrent", "", &described).Code, 200)
+	assert.Equal(t, described.Name, "album")
+	assert.Equal(t, described.TotalSize, int64(300017))
+	assert.Equal(t, described.PieceSize, int64(32768))
+	assert.Equal(t, described.Private, true)
+	assert.Equal(t, described.Comment, "Home recordings")
+	assert.Equal(t, described.Trackers, []string{"http://tracker.example/announce"})
+	assert.NotEqual(t, described.InfoHashV2, "")
+	assert.Equal(t, request("POST", "/v1/metainfo", `{"path": "/album"}`, nil).Code, 409)
+
+	var jobs []models.TorrentJob
+	request("GET", "/v1/torrents", "", &jobs)
+	assert.Equal(t, len(jobs), 1)
+	assert.Equal(t, jobs[0].State, models.TorrentSeeding)
+	assert.Equal(t, jobs[0].Seed, true)
+	assert.Equal(t, jobs[0].InfoHash, described.InfoHash)
+	assert.Equal(t, jobs[0].Completed, jobs[0].Total)
+
+	// A peer downloads the folder from the engine
+	leechDir, _ := ioutil.TempDir("", "leecher")
+	defer os.RemoveAll(leechDir)
+	var leecher *torrent.Client = loopbackSeeder(leechDir)
+	defer leecher.Close()
+	metaInfo, err := metainfo.LoadFromFile(filepath.Join(home, "album.torrent"))
+	if err != nil {
+		log.Fatal("Could not read torrent: ", err.Error())
+	}
+	leeched, _ := leecher.AddTorrent(metaInfo)
+	leeched.AddPeers([]torrent.PeerInfo{{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: torrents.Port()}}})
+	leeched.DownloadAll()
+	for i := 0; i < 100 && !leeched.Complete().Bool(); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Equal(t, leeched.Complete().Bool(), true)
+	downloaded, _ := ioutil.ReadFile(filepath.Join(leechDir, "album", "cd1", "track.bin"))
+	assert.Equal(t, bytes.Equal(downloaded, content), true)
+
+	// The seeding is paused, resumed and stopped like a download
+	var seeding models.TorrentJob
+	request("PUT", "/v1/torrent/"+strconv.Itoa(jobs[0].ID)+"/pause", "", &seeding)
+	assert.Equal(t, seeding.State, models.TorrentPaused)
+	request("PUT", "/v1/torrent/"+strconv.Itoa(jobs[0].ID)+"/resume", "", &seeding)
+	assert.Equal(t, seeding.State, models.TorrentSeeding)
+	request("PUT", "/v1/torrent/"+strconv.Itoa(jobs[0].ID)+"/cancel", "", &seeding)
+	assert.Equal(t, seeding.State, models.JobCanceled)
+	_, err = os.Stat(filepath.Join(home, "album", "cd1", "track.bin"))
+	assert.Equal(t, err, nil)
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/db"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/routes"
+	"rakoon/rakoon-back/storage"
+	"rakoon/rakoon-back/tests/utils"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// Asserts a deleted item goes to the trash and can be restored
+func TestTrashRestore(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Tom", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Tom", "qwerty1234", t, router)
+	var bearer = "Bearer " + user.Token
+
+	home, _ := storage.HomeDir(user.ID)
+	os.Mkdir(filepath.Join(home, "docs"), 0755)
+	ioutil.WriteFile(filepath.Join(home, "docs", "a.txt"), []byte("a"), 0644)
+
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("PUT", "/v1/delete/path", bytes.NewBufferString(`{"path": "/docs/a.txt"}`))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+	_, err := os.Stat(filepath.Join(home, "docs", "a.txt"))
+	assert.Equal(t, os.IsNotExist(err), true)
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/trash", nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+
+	var items []models.TrashItem
+	err = json.Unmarshal([]byte(record.Body.String()), &items)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+		t.Fail()
+	}
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, len(items), 1)
+	assert.Equal(t, items[0].OriginalPath, "/docs/a.txt")
+
+	// Another file took the original path, the restoration needs a conflict policy
+	ioutil.WriteFile(filepath.Join(home, "docs", "a.txt"), []byte("new"), 0644)
+	var url string = "/v1/trash/" + strconv.Itoa(items[0].ID) + "/restore"
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("PUT", url, nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 409)
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("PUT", url, bytes.NewBufferString(`{"conflict": "rename"}`))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+
+	content, _ := ioutil.ReadFile(filepath.Join(home, "docs", "a (1).txt"))
+	assert.Equal(t, string(content), "a")
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
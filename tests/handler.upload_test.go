@@ -0,0 +1,85 @@
+package test
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/db"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/routes"
+	"rakoon/rakoon-back/storage"
+	"rakoon/rakoon-back/tests/utils"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// Asserts a file can be uploaded in several chunks with the tus protocol
+func TestResumableUpload(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Tom", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Tom", "qwerty1234", t, router)
+	var bearer = "Bearer " + user.Token
+
+	home, _ := storage.HomeDir(user.ID)
+	os.Mkdir(filepath.Join(home, "docs"), 0755)
+
+	// Upload creation
+	var metadata string = "filename " + base64.StdEncoding.EncodeToString([]byte("notes.txt")) +
+		",path " + base64.StdEncoding.EncodeToString([]byte("/docs"))
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/v1/upload", nil)
+	request.Header.Add("Authorization", bearer)
+	request.Header.Add("Tus-Resumable", "1.0.0")
+	request.Header.Add("Upload-Length", "10")
+	request.Header.Add("Upload-Metadata", metadata)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 201)
+	var location string = record.Header().Get("Location")
+
+	// First chunk
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("PATCH", location, strings.NewReader("01234"))
+	request.Header.Add("Authorization", bearer)
+	request.Header.Add("Tus-Resumable", "1.0.0")
+	request.Header.Add("Content-Type", "application/offset+octet-stream")
+	request.Header.Add("Upload-Offset", "0")
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 204)
+	assert.Equal(t, record.Header().Get("Upload-Offset"), "5")
+
+	// The offset is kept between requests
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("HEAD", location, nil)
+	request.Header.Add("Authorization", bearer)
+	request.Header.Add("Tus-Resumable", "1.0.0")
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, record.Header().Get("Upload-Offset"), "5")
+
+	// Last chunk, the file is moved to its folder
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("PATCH", location, strings.NewReader("56789"))
+	request.Header.Add("Authorization", bearer)
+	request.Header.Add("Tus-Resumable", "1.0.0")
+	request.Header.Add("Content-Type", "application/offset+octet-stream")
+	request.Header.Add("Upload-Offset", "5")
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 204)
+
+	content, _ := ioutil.ReadFile(filepath.Join(home, "docs", "notes.txt"))
+	assert.Equal(t, string(content), "0123456789")
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
@@ -252,3 +252,46 @@ func TestUserPasswordChange(t *testing.T) {
 	utils.CleanUser(user.ID, user.Token, t, router)
 	db.CloseDB()
 }
+
+// Asserts a user can read their quota and usage
+func TestUserQuota(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+
+	var user models.UserCreate = utils.CreateUser("Quentin", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Quentin", "qwerty1234", t, router)
+
+	var url string = "/v1/user/" + strconv.Itoa(user.ID) + "/quota"
+	var bearer = "Bearer " + user.Token
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", url, nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+
+	assert.Equal(t, record.Code, 200)
+
+	var usage struct {
+		Quota *int64 `json:"quota"`
+		Used  int64  `json:"used"`
+	}
+	err := json.Unmarshal([]byte(record.Body.String()), &usage)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+		t.Fail()
+	}
+	// New users have no quota and an empty home
+	assert.Equal(t, usage.Quota == nil, true)
+	assert.Equal(t, usage.Used, int64(0))
+
+	// A user can not set their own quota
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("PUT", url, bytes.NewBuffer([]byte(`{"quota": 1024}`)))
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+
+	assert.NotEqual(t, record.Code, 200)
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
@@ -0,0 +1,87 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/db"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/routes"
+	"rakoon/rakoon-back/storage"
+	"rakoon/rakoon-back/tests/utils"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// Asserts an overwritten file is kept as a version that can be restored
+func TestFileVersions(t *testing.T) {
+	db.InitDB()
+	var router *gin.Engine = routes.SetupRouter()
+	rootPath, _ := ioutil.TempDir("", "rakoon")
+	os.Setenv("ROOT_PATH", rootPath)
+	defer os.RemoveAll(rootPath)
+
+	var user models.UserCreate = utils.CreateUser("Tom", "qwerty1234", t, router)
+	user.Token = utils.ConnectUser("Tom", "qwerty1234", t, router)
+	var bearer = "Bearer " + user.Token
+
+	home, _ := storage.HomeDir(user.ID)
+	ioutil.WriteFile(filepath.Join(home, "notes.txt"), []byte("first"), 0644)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("path", "/")
+	part, _ := writer.CreateFormFile("file", "notes.txt")
+	part.Write([]byte("second"))
+	writer.Close()
+
+	record := httptest.NewRecorder()
+	request, _ := http.NewRequest("POST", "/v1/file", &body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 201)
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/versions?path=/notes.txt", nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+
+	var list []models.FileVersion
+	err := json.Unmarshal([]byte(record.Body.String()), &list)
+	if err != nil {
+		log.Fatal("Bad output: ", err.Error())
+		t.Fail()
+	}
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, len(list), 1)
+	assert.Equal(t, list[0].Version, 1)
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("GET", "/v1/version/"+strconv.Itoa(list[0].ID), nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+	assert.Equal(t, record.Body.String(), "first")
+
+	record = httptest.NewRecorder()
+	request, _ = http.NewRequest("PUT", "/v1/version/"+strconv.Itoa(list[0].ID)+"/restore", nil)
+	request.Header.Add("Authorization", bearer)
+	router.ServeHTTP(record, request)
+	assert.Equal(t, record.Code, 200)
+
+	content, _ := ioutil.ReadFile(filepath.Join(home, "notes.txt"))
+	assert.Equal(t, string(content), "first")
+
+	utils.CleanUser(user.ID, user.Token, t, router)
+	db.CloseDB()
+}
@@ -0,0 +1,52 @@
+package thumbnails
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"strconv"
+	"sync"
+
+	"golang.org/x/image/draw"
+)
+
+// Colors of the placeholder: a sheet on a light background
+var (
+	backgroundColor = color.NRGBA{R: 0xec, G: 0xef, B: 0xf1, A: 0xff}
+	sheetColor      = color.NRGBA{R: 0xb0, G: 0xbe, B: 0xc5, A: 0xff}
+	lineColor       = color.NRGBA{R: 0xec, G: 0xef, B: 0xf1, A: 0xff}
+)
+
+// The placeholders are drawn once per size and format
+var placeholderMutex sync.Mutex
+var placeholders = map[string][]byte{}
+
+// Placeholder returns the image sent instead of the thumbnail of a file which is not a supported image
+func Placeholder(size int, format string) ([]byte, error) {
+	var key string = strconv.Itoa(size) + "." + format
+	placeholderMutex.Lock()
+	defer placeholderMutex.Unlock()
+
+	if data, ok := placeholders[key]; ok {
+		return data, nil
+	}
+
+	var placeholder *image.NRGBA = image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(placeholder, placeholder.Bounds(), image.NewUniform(backgroundColor), image.Point{}, draw.Src)
+
+	var sheet image.Rectangle = image.Rect(size*5/16, size/4, size*11/16, size*3/4)
+	draw.Draw(placeholder, sheet, image.NewUniform(sheetColor), image.Point{}, draw.Src)
+	for line := 1; line <= 3; line++ {
+		var y int = sheet.Min.Y + sheet.Dy()*line/5
+		var stroke image.Rectangle = image.Rect(sheet.Min.X+sheet.Dx()/6, y, sheet.Max.X-sheet.Dx()/6, y+max(1, size/64))
+		draw.Draw(placeholder, stroke, image.NewUniform(lineColor), image.Point{}, draw.Src)
+	}
+
+	var buffer bytes.Buffer
+	err := encode(&buffer, placeholder, format)
+	if err != nil {
+		return nil, err
+	}
+	placeholders[key] = buffer.Bytes()
+	return placeholders[key], nil
+}
@@ -0,0 +1,128 @@
+package thumbnails
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+	"os"
+	"rakoon/rakoon-back/photos"
+
+	// The decoders of the supported formats, all written in Go
+	_ "image/gif"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+)
+
+// Larger images are not decoded, they would take too much memory
+const maxPixels = 50 * 1000 * 1000
+
+const jpegQuality = 85
+
+// This function decodes an image and scales it down to fit in a square of the given size, turned as its EXIF orientation says
+func render(path string, size int) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, format, err := image.DecodeConfig(file)
+	if err != nil || config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, ErrUnsupported
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	source, _, err := image.Decode(file)
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+
+	var orientation int = 1
+	if format == "jpeg" || format == "tiff" {
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+		orientation = photos.Orientation(file)
+	}
+
+	return orient(scale(source, size), orientation), nil
+}
+
+// Images are never enlarged, the square being the same once turned, the orientation is applied on the small image
+func scale(source image.Image, size int) *image.NRGBA {
+	var bounds image.Rectangle = source.Bounds()
+	var ratio float64 = math.Min(1, float64(size)/float64(max(bounds.Dx(), bounds.Dy())))
+	var width int = max(1, int(math.Round(float64(bounds.Dx())*ratio)))
+	var height int = max(1, int(math.Round(float64(bounds.Dy())*ratio)))
+
+	var thumbnail *image.NRGBA = image.NewNRGBA(image.Rect(0, 0, width, height))
+	if ratio >= 1 {
+		draw.Draw(thumbnail, thumbnail.Bounds(), source, bounds.Min, draw.Src)
+	} else {
+		draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), source, bounds, draw.Src, nil)
+	}
+	return thumbnail
+}
+
+// This function turns and flips an image as its EXIF orientation says, so that it is displayed upright
+func orient(source *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation <= 1 {
+		return source
+	}
+
+	var width int = source.Bounds().Dx()
+	var height int = source.Bounds().Dy()
+	var bounds image.Rectangle = image.Rect(0, 0, width, height)
+	// The orientations from 5 to 8 swap the width and the height
+	if orientation >= 5 {
+		bounds = image.Rect(0, 0, height, width)
+	}
+
+	var oriented *image.NRGBA = image.NewNRGBA(bounds)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			var sourceX, sourceY int
+			switch orientation {
+			case 2:
+				sourceX, sourceY = width-1-x, y
+			case 3:
+				sourceX, sourceY = width-1-x, height-1-y
+			case 4:
+				sourceX, sourceY = x, height-1-y
+			case 5:
+				sourceX, sourceY = y, x
+			case 6:
+				sourceX, sourceY = y, height-1-x
+			case 7:
+				sourceX, sourceY = width-1-y, height-1-x
+			case 8:
+				sourceX, sourceY = width-1-y, x
+			}
+			copy(oriented.Pix[oriented.PixOffset(x, y):oriented.PixOffset(x, y)+4], source.Pix[source.PixOffset(sourceX, sourceY):source.PixOffset(sourceX, sourceY)+4])
+		}
+	}
+	return oriented
+}
+
+// JPEG has no transparency, the transparent parts of an image are shown on white. WebP thumbnails are lossless and keep them.
+func encode(w io.Writer, thumbnail image.Image, format string) error {
+	if format == WebP {
+		return nativewebp.Encode(w, thumbnail, nil)
+	}
+
+	var opaque *image.RGBA = image.NewRGBA(thumbnail.Bounds())
+	draw.Draw(opaque, opaque.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(opaque, opaque.Bounds(), thumbnail, thumbnail.Bounds().Min, draw.Over)
+	return jpeg.Encode(w, opaque, &jpeg.Options{Quality: jpegQuality})
+}
@@ -0,0 +1,208 @@
+package thumbnails
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/events"
+	"rakoon/rakoon-back/storage"
+	"strconv"
+	"time"
+)
+
+// Sizes are the sides of the squares the thumbnails fit in
+var Sizes = []int{128, 256, 512, 1024}
+
+// DefaultSize is the size used when none is requested
+const DefaultSize = 256
+
+// Formats of thumbnail
+const (
+	JPEG = "jpeg"
+	WebP = "webp"
+)
+
+// ErrUnsupported is returned for the files which are not images that can be decoded
+var ErrUnsupported = errors.New("the file is not a supported image")
+
+// ErrSize is returned for a size which is not one of the standard sizes
+var ErrSize = errors.New("unknown thumbnail size")
+
+// ErrFormat is returned for an unknown thumbnail format
+var ErrFormat = errors.New("unknown thumbnail format")
+
+// Decoding an image takes a lot of memory, a few of them are decoded at once
+var generating = make(chan bool, 2)
+
+// The cached thumbnails of removed files are removed, the ones of moved files follow them
+func init() {
+	events.Listen(func(event events.Event) {
+		switch event.Type {
+		case events.Deleted:
+			Invalidate(event.UserID, event.Path)
+		case events.Moved:
+			Move(event.UserID, event.OldPath, event.Path)
+		case events.Created, events.Modified:
+			// The thumbnails of a folder's files are checked against their source when they are requested
+			if fileInfo, err := os.Stat(event.Path); err == nil && !fileInfo.IsDir() {
+				Invalidate(event.UserID, event.Path)
+			}
+		}
+	})
+}
+
+// ParseSize reads a requested size, which must be one of the standard sizes
+func ParseSize(value string) (int, error) {
+	if len(value) <= 0 {
+		return DefaultSize, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, ErrSize
+	}
+	for _, standard := range Sizes {
+		if size == standard {
+			return size, nil
+		}
+	}
+	return 0, ErrSize
+}
+
+// ParseFormat reads a requested format, JPEG by default
+func ParseFormat(value string) (string, error) {
+	if len(value) <= 0 || value == JPEG {
+		return JPEG, nil
+	} else if value == WebP {
+		return WebP, nil
+	}
+	return "", ErrFormat
+}
+
+// ContentType returns the media type of a format
+func ContentType(format string) string {
+	if format == WebP {
+		return "image/webp"
+	}
+	return "image/jpeg"
+}
+
+// Get returns the path of the thumbnail of an image of a user's space, generating it if the image changed since it was cached.
+// The cached thumbnails carry the modification date of their source.
+func Get(ownerID int, path string, size int, format string) (string, error) {
+	source, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !source.Mode().IsRegular() {
+		return "", ErrUnsupported
+	}
+
+	dir, err := cacheDir(ownerID, path)
+	if err != nil {
+		return "", err
+	}
+	var cached string = filepath.Join(dir, strconv.Itoa(size)+"."+format)
+	if fileInfo, err := os.Stat(cached); err == nil && fileInfo.ModTime().Equal(source.ModTime()) {
+		return cached, nil
+	}
+
+	generating <- true
+	defer func() { <-generating }()
+
+	thumbnail, err := render(path, size)
+	if err != nil {
+		return "", err
+	}
+
+	err = makeDir(dir)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(dir, ".thumbnail-")
+	if err != nil {
+		return "", err
+	}
+	err = encode(tmp, thumbnail, format)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(tmp.Name(), time.Now(), source.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), cached)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return cached, nil
+}
+
+// Invalidate removes the cached thumbnails of a file, or of every file under a folder
+func Invalidate(ownerID int, path string) error {
+	dir, err := cacheDir(ownerID, path)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// Move moves the cached thumbnails of a file or a folder after it was moved in its owner's space
+func Move(ownerID int, source string, target string) error {
+	sourceDir, err := cacheDir(ownerID, source)
+	if err != nil {
+		return err
+	}
+	targetDir, err := cacheDir(ownerID, target)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(targetDir)
+	if err == nil {
+		err = makeDir(filepath.Dir(targetDir))
+	}
+	if err == nil {
+		err = os.Rename(sourceDir, targetDir)
+	}
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		os.RemoveAll(sourceDir)
+	}
+	return err
+}
+
+// The cache mirrors the homes: the thumbnails of a file are in a folder named after the file, so that the ones of a whole folder are found together
+func cacheDir(ownerID int, path string) (string, error) {
+	clientPath, err := storage.Relative(ownerID, path)
+	if err != nil {
+		return "", err
+	}
+	staging, err := storage.StagingDir("thumbnails")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(staging, strconv.Itoa(ownerID), filepath.FromSlash(clientPath)), nil
+}
+
+// A file replaced by a folder, or the other way around, behind the server's back may leave a stale thumbnail in the way of a folder
+func makeDir(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		return nil
+	}
+
+	staging, stagingErr := storage.StagingDir("thumbnails")
+	if stagingErr != nil {
+		return err
+	}
+	for parent := dir; storage.Contains(staging, parent) && parent != staging; parent = filepath.Dir(parent) {
+		if fileInfo, statErr := os.Lstat(parent); statErr == nil && !fileInfo.IsDir() {
+			os.Remove(parent)
+		}
+	}
+	return os.MkdirAll(dir, 0755)
+}
@@ -0,0 +1,177 @@
+package torrents
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/events"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/quota"
+	"rakoon/rakoon-back/recyclebin"
+	"rakoon/rakoon-back/storage"
+)
+
+// ErrState is returned when a job can not be paused, resumed or canceled in its state
+var ErrState = errors.New("the operation is not possible in the state of the torrent")
+
+// Stats fills the statistics of the jobs whose torrent is in the engine
+func Stats(jobs []models.TorrentJob) []models.TorrentJob {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for i := range jobs {
+		jobs[i] = withStats(jobs[i])
+	}
+	return jobs
+}
+
+// Pause takes a torrent out of the engine until it is resumed, while it is transferred, seeded or its metadata is fetched.
+// The pieces already verified are kept.
+func Pause(job models.TorrentJob) (models.TorrentJob, error) {
+	if job.State != models.JobRunning && job.State != models.TorrentMetadata && job.State != models.TorrentSeeding {
+		return job, ErrState
+	}
+
+	halt(job.ID)
+	err := models.SetTorrentJobState(job.ID, models.TorrentPaused)
+	if err != nil {
+		return job, err
+	}
+	quota.Invalidate(job.OwnerID)
+	return reload(job)
+}
+
+// Resume puts a paused torrent back in the engine
+func Resume(job models.TorrentJob) (models.TorrentJob, error) {
+	if job.State != models.TorrentPaused {
+		return job, ErrState
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if client == nil {
+		return job, ErrNotRunning
+	}
+	job.State = models.JobRunning
+	if job.MetaInfo == nil {
+		job.State = models.TorrentMetadata
+	} else if job.Seed {
+		job.State = models.TorrentSeeding
+	}
+	var reserved int64 = remaining(job)
+	err := quota.Reserve(job.OwnerID, reserved)
+	if err != nil {
+		return job, err
+	}
+	err = models.SetTorrentJobState(job.ID, job.State)
+	if err != nil {
+		quota.Release(job.OwnerID, reserved)
+		return job, err
+	}
+
+	err = start(job, reserved)
+	if err != nil {
+		quota.Release(job.OwnerID, reserved)
+		models.FinishTorrentJob(job.ID, models.JobFailed, job.Completed, err.Error())
+		return job, err
+	}
+	publish(job)
+	return job, nil
+}
+
+// Cancel stops a torrent for good, the data already downloaded is kept. A seeding torrent stops being shared.
+func Cancel(job models.TorrentJob) (models.TorrentJob, error) {
+	if job.FinishedOn != nil {
+		return job, ErrState
+	}
+
+	halt(job.ID)
+	// The progress was saved when the download stopped
+	current, err := models.GetTorrentJob(job.ID)
+	if err != nil {
+		return job, err
+	}
+	err = models.FinishTorrentJob(job.ID, models.JobCanceled, current.Completed, "")
+	if err != nil {
+		return job, err
+	}
+	quota.Invalidate(job.OwnerID)
+	return reload(job)
+}
+
+// Remove stops a torrent and forgets its job. With its data, the file or the folder it was downloaded to is moved to the trash.
+func Remove(ctx context.Context, job models.TorrentJob, withData bool) error {
+	halt(job.ID)
+
+	// The name of a magnet link is only known with its metadata
+	if withData && job.MetaInfo != nil {
+		dir, err := storage.Resolve(job.OwnerID, job.OwnerPath)
+		if err != nil {
+			return err
+		}
+		// A single file is written with a part suffix until it is complete
+		for _, name := range []string{job.Name, job.Name + ".part"} {
+			var path string = filepath.Join(dir, name)
+			if _, err := os.Lstat(path); err != nil {
+				continue
+			}
+			_, err = recyclebin.Trash(ctx, job.OwnerID, path)
+			if err != nil {
+				return err
+			}
+			events.Publish(events.Event{Type: events.Deleted, UserID: job.OwnerID, Path: path})
+		}
+	}
+
+	models.DeleteTorrentJob(job.ID)
+	quota.Invalidate(job.OwnerID)
+	return nil
+}
+
+// This function takes a torrent out of the engine, its download saves its progress before it stops
+func halt(ID int) {
+	mutex.Lock()
+	running, ok := downloads[ID]
+	delete(downloads, ID)
+	mutex.Unlock()
+	if !ok {
+		return
+	}
+
+	close(running.stop)
+	<-running.done
+	running.torrent.Drop()
+	running.release()
+}
+
+// This function reads the state of a job after a change, and sends it to its user
+func reload(job models.TorrentJob) (models.TorrentJob, error) {
+	job, err := models.GetTorrentJob(job.ID)
+	if err != nil {
+		return job, err
+	}
+	publish(job)
+	return job, nil
+}
+
+// This function fills the statistics of a job from its download, the mutex must be held
+func withStats(job models.TorrentJob) models.TorrentJob {
+	running, ok := downloads[job.ID]
+	if !ok {
+		return job
+	}
+
+	job.Completed = running.completed
+	job.Speed = running.speed
+	job.Peers = running.peers
+	if running.speed > 0 && job.Total > job.Completed {
+		var eta int64 = (job.Total - job.Completed) / running.speed
+		job.ETA = &eta
+	}
+	return job
+}
+
+// This function sends the state of a job to its user
+func publish(job models.TorrentJob) {
+	events.Publish(events.Event{Type: events.TorrentUpdated, UserID: job.UserID, Data: job})
+}
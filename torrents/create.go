@@ -0,0 +1,408 @@
+package torrents
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/bencode"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/storage"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// The piece size chosen for a content gives about this many pieces, from one block to maxPieceSize
+const targetPieces = 1500
+const maxPieceSize = 16 << 20
+
+// The progress of a creation is reported every time this many bytes are hashed
+const reportInterval = 1 << 20
+
+// ErrPieceSize is returned for a piece size which is not a power of two from 16 KiB to 16 MiB
+var ErrPieceSize = errors.New("the piece size must be a power of two from 16 KiB to 16 MiB")
+
+// ErrTracker is returned for a tracker which is not an http, https or udp URL
+var ErrTracker = errors.New("the trackers must be http, https or udp URLs")
+
+// ErrEmpty is returned when a folder has no file to share
+var ErrEmpty = errors.New("there is no file to share")
+
+// ErrChanged is returned when a file is written while it is hashed
+var ErrChanged = errors.New("a file changed while it was hashed")
+
+// CheckCreate checks the options of a .torrent file, before its content is hashed
+func CheckCreate(options models.TorrentCreate) error {
+	var pieceSize int64 = options.PieceSize
+	if pieceSize != 0 && (pieceSize < blockSize || pieceSize > maxPieceSize || pieceSize&(pieceSize-1) != 0) {
+		return ErrPieceSize
+	}
+	for _, tracker := range options.Trackers {
+		trackerURL, err := url.Parse(tracker)
+		if err != nil || len(trackerURL.Host) <= 0 {
+			return ErrTracker
+		}
+		if trackerURL.Scheme != "http" && trackerURL.Scheme != "https" && trackerURL.Scheme != "udp" {
+			return ErrTracker
+		}
+	}
+	return nil
+}
+
+// source is a file shared by a torrent, path is nil for the only file of a single file torrent
+type source struct {
+	file   string
+	path   []string
+	length int64
+}
+
+// Create builds the .torrent file of a file or a folder, BitTorrent v1 or hybrid v1 and v2.
+// The bytes hashed are reported to progress as the content is read.
+func Create(ctx context.Context, root string, options models.TorrentCreate, progress func(processed int64, total int64)) ([]byte, error) {
+	err := CheckCreate(options)
+	if err != nil {
+		return nil, err
+	}
+	var name string = filepath.Base(root)
+	if !validName(name) {
+		return nil, ErrInvalid
+	}
+	sources, total, err := listSources(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var pieceSize int64 = options.PieceSize
+	if pieceSize == 0 {
+		pieceSize = blockSize
+		for pieceSize < maxPieceSize && total/pieceSize > targetPieces {
+			pieceSize *= 2
+		}
+	}
+
+	var h *hasher = &hasher{pieceSize: pieceSize, piece: sha1.New(), total: total, progress: progress}
+	var files []interface{}
+	var tree = map[string]interface{}{}
+	var pieceLayers = map[string]interface{}{}
+	for i, file := range sources {
+		err = h.hashFile(ctx, file, options.Hybrid)
+		if err != nil {
+			return nil, err
+		}
+
+		if file.path != nil {
+			var path []interface{}
+			for _, component := range file.path {
+				path = append(path, component)
+			}
+			files = append(files, map[string]interface{}{"length": file.length, "path": path})
+		}
+
+		if !options.Hybrid {
+			continue
+		}
+		var properties = map[string]interface{}{"length": file.length}
+		if file.length > 0 {
+			root, layer := h.merkle()
+			properties["pieces root"] = string(root[:])
+			if layer != nil {
+				pieceLayers[string(root[:])] = string(layer)
+			}
+		}
+		var path []string = file.path
+		if path == nil {
+			path = []string{name}
+		}
+		addToTree(tree, path, properties)
+
+		// The files of a hybrid torrent start on a piece, padding files fill the end of the previous one in v1
+		if padding := (pieceSize - file.length%pieceSize) % pieceSize; padding > 0 && i < len(sources)-1 {
+			h.pad(padding)
+			files = append(files, map[string]interface{}{
+				"attr":   "p",
+				"length": padding,
+				"path":   []interface{}{".pad", strconv.FormatInt(padding, 10)},
+			})
+		}
+	}
+	h.flush()
+
+	var info = map[string]interface{}{
+		"name":         name,
+		"piece length": pieceSize,
+		"pieces":       string(h.pieces),
+	}
+	if sources[0].path == nil {
+		info["length"] = sources[0].length
+	} else {
+		info["files"] = files
+	}
+	if options.Private {
+		info["private"] = 1
+	}
+	if options.Hybrid {
+		info["meta version"] = 2
+		info["file tree"] = tree
+	}
+	encodedInfo, err := bencode.Encode(info)
+	if err != nil {
+		return nil, err
+	}
+
+	var torrent = map[string]interface{}{
+		"info":          bencode.Raw(encodedInfo),
+		"created by":    "rakoon",
+		"creation date": time.Now().Unix(),
+	}
+	if options.Hybrid {
+		torrent["piece layers"] = pieceLayers
+	}
+	if len(options.Comment) > 0 {
+		torrent["comment"] = options.Comment
+	}
+	// Every tracker is a tier of its own, they are all announced to
+	if len(options.Trackers) > 0 {
+		torrent["announce"] = options.Trackers[0]
+		var tiers []interface{}
+		for _, tracker := range options.Trackers {
+			tiers = append(tiers, []interface{}{tracker})
+		}
+		torrent["announce-list"] = tiers
+	}
+	return bencode.Encode(torrent)
+}
+
+// Seed shares with the peers content a user already has, from the folder it is in and its .torrent file.
+// The content was just hashed to create the .torrent file, its pieces are known to be complete.
+func Seed(userID int, location storage.Location, clientPath string, data []byte) (models.TorrentJob, error) {
+	metaInfo, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		return models.TorrentJob{}, ErrInvalid
+	}
+	info, err := metaInfo.UnmarshalInfo()
+	if err != nil {
+		return models.TorrentJob{}, ErrInvalid
+	}
+
+	var infoHash metainfo.Hash = metaInfo.HashInfoBytes()
+	mutex.Lock()
+	if client == nil {
+		mutex.Unlock()
+		return models.TorrentJob{}, ErrNotRunning
+	}
+	for i := 0; i < info.NumPieces(); i++ {
+		err = completion.Set(metainfo.PieceKey{InfoHash: infoHash, Index: i}, true)
+		if err != nil {
+			mutex.Unlock()
+			return models.TorrentJob{}, err
+		}
+	}
+	mutex.Unlock()
+
+	return add(userID, location, clientPath, models.TorrentJob{
+		InfoHash:  infoHash.HexString(),
+		Name:      info.BestName(),
+		MetaInfo:  data,
+		Seed:      true,
+		State:     models.TorrentSeeding,
+		Total:     info.TotalLength(),
+		Completed: info.TotalLength(),
+	})
+}
+
+// This function lists the regular files of a file or a folder, sorted by path as in the file tree of v2, and their total size
+func listSources(root string) ([]source, int64, error) {
+	rootInfo, err := os.Stat(root)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !rootInfo.IsDir() {
+		return []source{{file: root, length: rootInfo.Size()}}, rootInfo.Size(), nil
+	}
+
+	var sources []source
+	var total int64
+	err = filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		fileInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, source{file: file, path: strings.Split(filepath.ToSlash(relative), "/"), length: fileInfo.Size()})
+		total += fileInfo.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(sources) <= 0 {
+		return nil, 0, ErrEmpty
+	}
+	return sources, total, nil
+}
+
+// This function adds a file to the file tree of v2, its properties are under an empty key
+func addToTree(tree map[string]interface{}, path []string, properties map[string]interface{}) {
+	for _, folder := range path[:len(path)-1] {
+		child, ok := tree[folder].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			tree[folder] = child
+		}
+		tree = child
+	}
+	tree[path[len(path)-1]] = map[string]interface{}{"": properties}
+}
+
+// hasher computes the SHA-1 of the v1 pieces over all the files, and the SHA-256 of the v2 blocks of the current file
+type hasher struct {
+	pieceSize int64
+	pieces    []byte
+	piece     hash.Hash
+	filled    int64
+	blocks    [][sha256.Size]byte
+	processed int64
+	total     int64
+	reported  int64
+	progress  func(processed int64, total int64)
+}
+
+func (h *hasher) hashFile(ctx context.Context, file source, hybrid bool) error {
+	reader, err := os.Open(file.file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var buffered *bufio.Reader = bufio.NewReaderSize(reader, 1<<20)
+	var block = make([]byte, blockSize)
+	var length int64
+	h.blocks = h.blocks[:0]
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		n, err := io.ReadFull(buffered, block)
+		if n > 0 {
+			h.write(block[:n])
+			if hybrid {
+				h.blocks = append(h.blocks, sha256.Sum256(block[:n]))
+			}
+			length += int64(n)
+			h.processed += int64(n)
+			if h.processed-h.reported >= reportInterval || h.processed == h.total {
+				h.reported = h.processed
+				h.progress(h.processed, h.total)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if length != file.length {
+		return ErrChanged
+	}
+	return nil
+}
+
+// This function hashes data in the v1 pieces
+func (h *hasher) write(data []byte) {
+	for len(data) > 0 {
+		var n int64 = min(int64(len(data)), h.pieceSize-h.filled)
+		h.piece.Write(data[:n])
+		h.filled += n
+		data = data[n:]
+		if h.filled == h.pieceSize {
+			h.flush()
+		}
+	}
+}
+
+// This function hashes the zeros of a padding file in the v1 pieces
+func (h *hasher) pad(length int64) {
+	var zeros = make([]byte, blockSize)
+	for length > 0 {
+		var n int64 = min(length, blockSize)
+		h.write(zeros[:n])
+		length -= n
+	}
+}
+
+// This function ends the current v1 piece, the last one is shorter
+func (h *hasher) flush() {
+	if h.filled > 0 {
+		h.pieces = h.piece.Sum(h.pieces)
+		h.piece.Reset()
+		h.filled = 0
+	}
+}
+
+// This function returns the root of the merkle tree of the current file, and its piece layer when it is larger than a piece.
+// The tree is padded with zero hashes up to a power of two of blocks.
+func (h *hasher) merkle() ([sha256.Size]byte, []byte) {
+	var blocksPerPiece int = int(h.pieceSize / blockSize)
+	if len(h.blocks) <= blocksPerPiece {
+		return merkleRoot(h.blocks, powerOfTwo(len(h.blocks)), [sha256.Size]byte{}), nil
+	}
+
+	var layer [][sha256.Size]byte
+	var encoded []byte
+	for start := 0; start < len(h.blocks); start += blocksPerPiece {
+		var pieceRoot [sha256.Size]byte = merkleRoot(h.blocks[start:min(start+blocksPerPiece, len(h.blocks))], blocksPerPiece, [sha256.Size]byte{})
+		layer = append(layer, pieceRoot)
+		encoded = append(encoded, pieceRoot[:]...)
+	}
+	var padding [sha256.Size]byte = merkleRoot(nil, blocksPerPiece, [sha256.Size]byte{})
+	return merkleRoot(layer, powerOfTwo(len(layer)), padding), encoded
+}
+
+// This function hashes pairs of hashes up to a root, the leaves are padded up to width
+func merkleRoot(leaves [][sha256.Size]byte, width int, padding [sha256.Size]byte) [sha256.Size]byte {
+	var level = make([][sha256.Size]byte, width)
+	copy(level, leaves)
+	for i := len(leaves); i < width; i++ {
+		level[i] = padding
+	}
+
+	var pair [2 * sha256.Size]byte
+	for len(level) > 1 {
+		for i := 0; i < len(level)/2; i++ {
+			copy(pair[:sha256.Size], level[2*i][:])
+			copy(pair[sha256.Size:], level[2*i+1][:])
+			level[i] = sha256.Sum256(pair[:])
+		}
+		level = level[:len(level)/2]
+	}
+	return level[0]
+}
+
+func powerOfTwo(n int) int {
+	var power int = 1
+	for power < n {
+		power *= 2
+	}
+	return power
+}
@@ -0,0 +1,538 @@
+package torrents
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"rakoon/rakoon-back/events"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/quota"
+	"rakoon/rakoon-back/storage"
+	"sort"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	torrentstorage "github.com/anacrolix/torrent/storage"
+)
+
+// ErrNoMetaInfo is returned when the files of a magnet link are needed before its metadata is known
+var ErrNoMetaInfo = errors.New("the metadata of the torrent is not known yet")
+
+// ErrNotWaiting is returned when files are selected in a torrent which does not wait for it
+var ErrNotWaiting = errors.New("the torrent is not waiting for a selection")
+
+// ErrUnknownFile is returned when a file selected is not in the torrent
+var ErrUnknownFile = errors.New("the file is not in the torrent")
+
+// The state of the downloads is checked this often, and their progress saved when it changed
+const progressInterval = time.Second
+
+// download is a torrent job in the engine, fetching its metadata, transferring its files or seeding them
+type download struct {
+	job     models.TorrentJob
+	torrent *torrent.Torrent
+	// dir is the folder the torrent is written in
+	dir string
+	// The statistics of the transfer, guarded by the mutex. Transferred counts the bytes downloaded, or uploaded while seeding.
+	completed   int64
+	transferred int64
+	speed       int64
+	peers       int
+	// reserved is the part of the torrent still reserved in the quota of the owner, guarded by the mutex.
+	// The bytes leave the reservation as they are written, they are then counted from the disk.
+	reserved int64
+	// A failed write is reported on failed, stop is closed when the engine stops and done once the download stopped
+	failed chan error
+	stop   chan bool
+	done   chan bool
+}
+
+// Add starts downloading a torrent in a folder of a user, from the content of its .torrent file.
+// The size of the torrent is reserved in the quota of the owner of the folder.
+// If selectFiles is true, the job waits for the user to select the files to download instead.
+func Add(userID int, location storage.Location, clientPath string, data []byte, selectFiles bool) (models.TorrentJob, error) {
+	metaInfo, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		return models.TorrentJob{}, ErrInvalid
+	}
+	info, err := metaInfo.UnmarshalInfo()
+	if err != nil {
+		return models.TorrentJob{}, ErrInvalid
+	}
+	err = checkName(location.Path, info.BestName())
+	if err != nil {
+		return models.TorrentJob{}, err
+	}
+
+	var job models.TorrentJob = models.TorrentJob{
+		InfoHash:    metaInfo.HashInfoBytes().HexString(),
+		Name:        info.BestName(),
+		MetaInfo:    data,
+		SelectFiles: selectFiles,
+		State:       models.JobRunning,
+		Total:       info.TotalLength(),
+	}
+	if selectFiles {
+		job.State = models.TorrentWaiting
+	}
+	return add(userID, location, clientPath, job)
+}
+
+// AddMagnet fetches the metadata of a magnet link from the peers, then downloads it in a folder of a user like Add
+func AddMagnet(userID int, location storage.Location, clientPath string, uri string, selectFiles bool) (models.TorrentJob, error) {
+	spec, err := torrent.TorrentSpecFromMagnetUri(uri)
+	if err != nil {
+		return models.TorrentJob{}, ErrInvalid
+	}
+
+	// The name is only known with the metadata
+	var name string = spec.DisplayName
+	if len(name) <= 0 {
+		name = spec.InfoHash.HexString()
+	}
+	return add(userID, location, clientPath, models.TorrentJob{
+		InfoHash:    spec.InfoHash.HexString(),
+		Name:        name,
+		Magnet:      uri,
+		SelectFiles: selectFiles,
+		State:       models.TorrentMetadata,
+	})
+}
+
+// This function saves a new job in a folder of a user and starts it, unless it waits for a selection
+func add(userID int, location storage.Location, clientPath string, job models.TorrentJob) (models.TorrentJob, error) {
+	ownerPath, err := storage.Relative(location.OwnerID, location.Path)
+	if err != nil {
+		return job, err
+	}
+	job.UserID = userID
+	job.OwnerID = location.OwnerID
+	job.Path = path.Clean("/" + filepath.ToSlash(clientPath))
+	job.OwnerPath = ownerPath
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if client == nil {
+		return job, ErrNotRunning
+	}
+	if _, ok := client.Torrent(metainfo.NewHashFromHex(job.InfoHash)); ok {
+		return job, ErrDuplicate
+	}
+
+	// The size of a magnet link is reserved once it is known, the one of a selection once it is made
+	var reserved int64 = remaining(job)
+	err = quota.Reserve(location.OwnerID, reserved)
+	if err != nil {
+		return job, err
+	}
+
+	job, err = models.CreateTorrentJob(job)
+	if err != nil {
+		quota.Release(location.OwnerID, reserved)
+		return job, err
+	}
+	if job.State == models.TorrentWaiting {
+		publish(job)
+		return job, nil
+	}
+
+	err = start(job, reserved)
+	if err != nil {
+		quota.Release(location.OwnerID, reserved)
+		models.FinishTorrentJob(job.ID, models.JobFailed, 0, err.Error())
+		return job, err
+	}
+	publish(job)
+	return job, nil
+}
+
+// Files lists the files of a torrent, and whether they are downloaded
+func Files(job models.TorrentJob) ([]models.TorrentFile, error) {
+	if job.MetaInfo == nil {
+		return nil, ErrNoMetaInfo
+	}
+	metaInfo, err := metainfo.Load(bytes.NewReader(job.MetaInfo))
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	info, err := metaInfo.UnmarshalInfo()
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	var selected map[string]bool = selection(job)
+	var files = []models.TorrentFile{}
+	for _, file := range info.UpvertedFiles() {
+		var filePath string = file.DisplayPath(&info)
+		files = append(files, models.TorrentFile{Path: filePath, Size: file.Length, Selected: selected == nil || selected[filePath]})
+	}
+	return files, nil
+}
+
+// Select starts the transfer of the files selected in a torrent waiting for a selection.
+// Their size is reserved in the quota of the owner of the folder.
+func Select(job models.TorrentJob, paths []string) (models.TorrentJob, error) {
+	if job.State != models.TorrentWaiting {
+		return job, ErrNotWaiting
+	}
+	files, err := Files(job)
+	if err != nil {
+		return job, err
+	}
+
+	var sizes = map[string]int64{}
+	for _, file := range files {
+		sizes[file.Path] = file.Size
+	}
+	var total int64
+	var selected = map[string]bool{}
+	for _, filePath := range paths {
+		size, ok := sizes[filePath]
+		if !ok {
+			return job, ErrUnknownFile
+		}
+		if !selected[filePath] {
+			total += size
+		}
+		selected[filePath] = true
+	}
+	if len(selected) <= 0 {
+		return job, ErrUnknownFile
+	}
+	job.Files = nil
+	for filePath := range selected {
+		job.Files = append(job.Files, filePath)
+	}
+	sort.Strings(job.Files)
+	job.Total = total
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if client == nil {
+		return job, ErrNotRunning
+	}
+	err = quota.Reserve(job.OwnerID, total)
+	if err != nil {
+		return job, err
+	}
+	err = models.SelectTorrentFiles(job.ID, job.Files, total)
+	if err != nil {
+		quota.Release(job.OwnerID, total)
+		return job, err
+	}
+	job.State = models.JobRunning
+
+	err = start(job, total)
+	if err != nil {
+		quota.Release(job.OwnerID, total)
+		models.FinishTorrentJob(job.ID, models.JobFailed, 0, err.Error())
+		return job, err
+	}
+	publish(job)
+	return job, nil
+}
+
+// This function adds the torrent of a job to the engine and follows its download, the mutex must be held.
+// The download holds the bytes reserved for it from then on.
+func start(job models.TorrentJob, reserved int64) error {
+	dir, err := storage.Resolve(job.OwnerID, job.OwnerPath)
+	if err != nil {
+		return err
+	}
+
+	var spec *torrent.TorrentSpec
+	if job.MetaInfo != nil {
+		metaInfo, err := metainfo.Load(bytes.NewReader(job.MetaInfo))
+		if err != nil {
+			return ErrInvalid
+		}
+		spec, err = torrent.TorrentSpecFromMetaInfoErr(metaInfo)
+		if err != nil {
+			return ErrInvalid
+		}
+		// The peers given by a magnet link are not part of its metadata
+		if magnet, err := torrent.TorrentSpecFromMagnetUri(job.Magnet); err == nil {
+			spec.PeerAddrs = magnet.PeerAddrs
+		}
+	} else {
+		spec, err = torrent.TorrentSpecFromMagnetUri(job.Magnet)
+		if err != nil {
+			return ErrInvalid
+		}
+	}
+
+	// The torrents are written in their folder, their verified pieces are remembered by the engine
+	spec.Storage = torrentstorage.NewFileOpts(torrentstorage.NewFileClientOpts{ClientBaseDir: dir, FilePathMaker: filePath, PieceCompletion: completion})
+	added, isNew, err := client.AddTorrentSpec(spec)
+	if err != nil {
+		return err
+	} else if !isNew {
+		return ErrDuplicate
+	}
+
+	var running = &download{
+		job:         job,
+		torrent:     added,
+		dir:         dir,
+		completed:   job.Completed,
+		transferred: job.Completed,
+		reserved:    reserved,
+		failed:      make(chan error, 1),
+		stop:        make(chan bool),
+		done:        make(chan bool),
+	}
+	if job.State == models.TorrentSeeding {
+		running.transferred = 0
+	}
+	added.SetOnWriteChunkError(func(err error) {
+		select {
+		case running.failed <- err:
+		default:
+		}
+	})
+	downloads[job.ID] = running
+	go running.run()
+	return nil
+}
+
+// This function follows a download until it is complete, fails or the engine stops. A seeding torrent stays in the engine once complete.
+func (running *download) run() {
+	defer close(running.done)
+	select {
+	case <-running.torrent.GotInfo():
+	case <-running.stop:
+		return
+	}
+	if running.job.State == models.TorrentMetadata && !running.gotMetaInfo() {
+		return
+	}
+
+	var selected map[string]bool = selection(running.job)
+	if selected == nil {
+		running.torrent.DownloadAll()
+	}
+	for _, file := range running.torrent.Files() {
+		if selected[file.DisplayPath()] {
+			file.Download()
+		}
+	}
+
+	var ticker *time.Ticker = time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	var saved int64 = running.job.Completed
+	for {
+		select {
+		case <-running.stop:
+			progress, _ := running.progress()
+			models.UpdateTorrentProgress(running.job.ID, progress)
+			return
+		case err := <-running.failed:
+			running.finish(models.JobFailed, err)
+			return
+		case <-ticker.C:
+			progress, complete := running.progress()
+			if complete && running.job.State != models.TorrentSeeding {
+				running.finish(models.JobDone, nil)
+				return
+			}
+			running.update(progress)
+			if progress != saved {
+				saved = progress
+				models.UpdateTorrentProgress(running.job.ID, saved)
+			}
+		}
+	}
+}
+
+// This function saves the metadata fetched for a magnet link, and tells if the transfer can start.
+// The job waiting for a selection leaves the engine until it is made.
+func (running *download) gotMetaInfo() bool {
+	var info *metainfo.Info = running.torrent.Info()
+	err := checkName(running.dir, info.BestName())
+	if err != nil {
+		running.finish(models.JobFailed, err)
+		return false
+	}
+	var data bytes.Buffer
+	var metaInfo metainfo.MetaInfo = running.torrent.Metainfo()
+	err = metaInfo.Write(&data)
+	if err != nil {
+		running.finish(models.JobFailed, err)
+		return false
+	}
+
+	running.job.Name = info.BestName()
+	running.job.MetaInfo = data.Bytes()
+	running.job.Total = info.TotalLength()
+	if running.job.SelectFiles {
+		running.job.State = models.TorrentWaiting
+		running.remove()
+		models.SaveTorrentMetaInfo(running.job.ID, running.job.Name, running.job.MetaInfo, running.job.Total, running.job.State)
+		publish(running.job)
+		return false
+	}
+
+	err = quota.Reserve(running.job.OwnerID, running.job.Total)
+	if err != nil {
+		running.finish(models.JobFailed, err)
+		return false
+	}
+	mutex.Lock()
+	running.reserved = running.job.Total
+	mutex.Unlock()
+	running.job.State = models.JobRunning
+	models.SaveTorrentMetaInfo(running.job.ID, running.job.Name, running.job.MetaInfo, running.job.Total, running.job.State)
+	publish(running.job)
+	return true
+}
+
+// This function computes the statistics of a download from its progress since the last one, and sends them to its user.
+// The speed of a seeding torrent is the one of its upload. The bytes written leave the reservation, they are counted from the disk instead.
+func (running *download) update(progress int64) {
+	var transferred int64 = progress
+	if running.job.State == models.TorrentSeeding {
+		var stats torrent.TorrentStats = running.torrent.Stats()
+		transferred = stats.BytesWrittenData.Int64()
+	}
+	mutex.Lock()
+	running.speed = (transferred - running.transferred) * int64(time.Second) / int64(progressInterval)
+	if running.speed < 0 {
+		running.speed = 0
+	}
+	running.transferred = transferred
+	running.completed = progress
+	running.peers = running.torrent.Stats().ActivePeers
+	var job models.TorrentJob = withStats(running.job)
+	var left int64 = running.job.Total - progress
+	if left < 0 {
+		left = 0
+	}
+	var written int64
+	if left < running.reserved {
+		written = running.reserved - left
+		running.reserved = left
+	}
+	mutex.Unlock()
+
+	if written > 0 {
+		quota.Release(running.job.OwnerID, written)
+		quota.Invalidate(running.job.OwnerID)
+	}
+	publish(job)
+}
+
+// This function returns the bytes downloaded of the selected files, and whether they are all complete
+func (running *download) progress() (int64, bool) {
+	var selected map[string]bool = selection(running.job)
+	if selected == nil {
+		return running.torrent.BytesCompleted(), running.torrent.Complete().Bool()
+	}
+
+	var completed int64
+	var complete bool = true
+	for _, file := range running.torrent.Files() {
+		if selected[file.DisplayPath()] {
+			completed += file.BytesCompleted()
+			complete = complete && file.BytesCompleted() >= file.Length()
+		}
+	}
+	return completed, complete
+}
+
+// This function removes a finished download from the engine and saves its final state
+func (running *download) finish(state string, err error) {
+	completed, _ := running.progress()
+	var selected map[string]bool = selection(running.job)
+	var files []*torrent.File
+	if running.torrent.Info() != nil {
+		files = running.torrent.Files()
+	}
+	running.remove()
+
+	// The pieces shared with the selected files leave parts of the other files
+	for _, file := range files {
+		if selected != nil && !selected[file.DisplayPath()] {
+			os.Remove(filepath.Join(running.dir, filepath.FromSlash(file.Path())) + ".part")
+		}
+	}
+
+	var message string
+	if err != nil {
+		message = err.Error()
+	}
+	models.FinishTorrentJob(running.job.ID, state, completed, message)
+	var now time.Time = time.Now()
+	running.job.State, running.job.Completed, running.job.Error, running.job.FinishedOn = state, completed, message, &now
+	publish(running.job)
+
+	// The reservation is replaced by the size of the data actually written
+	running.release()
+	quota.Invalidate(running.job.OwnerID)
+	if state == models.JobDone {
+		events.Publish(events.Event{Type: events.Created, UserID: running.job.OwnerID, Path: filepath.Join(running.dir, running.job.Name)})
+	}
+}
+
+// This function gives back what is left of the reservation of a download, once it stopped writing
+func (running *download) release() {
+	mutex.Lock()
+	var reserved int64 = running.reserved
+	running.reserved = 0
+	mutex.Unlock()
+	quota.Release(running.job.OwnerID, reserved)
+}
+
+// This function drops the torrent of a download from the engine
+func (running *download) remove() {
+	running.torrent.Drop()
+	mutex.Lock()
+	delete(downloads, running.job.ID)
+	mutex.Unlock()
+}
+
+// This function returns the bytes a job still has to download, reserved in the quota while it runs
+func remaining(job models.TorrentJob) int64 {
+	if job.State != models.JobRunning || job.Total <= job.Completed {
+		return 0
+	}
+	return job.Total - job.Completed
+}
+
+// The name of a torrent is the name of the file or the folder it creates, in the folder it is downloaded in
+func checkName(dir string, name string) error {
+	if name == metainfo.NoName || name == "." || name == ".." || filepath.Base(name) != name {
+		return ErrInvalid
+	}
+	_, err := os.Lstat(filepath.Join(dir, name))
+	if err == nil {
+		return os.ErrExist
+	}
+	return nil
+}
+
+// The files of a torrent are written in a folder named after it, except the single file of a single file torrent.
+// The v2 file tree of a single file torrent only has the file, named after the torrent.
+func filePath(opts torrentstorage.FilePathMakerOpts) string {
+	var name string = opts.Info.BestName()
+	if opts.Info.HasV2() && len(opts.Info.FileTree.Dir) == 1 {
+		if only, ok := opts.Info.FileTree.Dir[name]; ok && !only.IsDir() {
+			return name
+		}
+	}
+	return filepath.Join(append([]string{name}, opts.File.BestPath()...)...)
+}
+
+// The files selected in a job, nil when all of them are downloaded
+func selection(job models.TorrentJob) map[string]bool {
+	if job.Files == nil {
+		return nil
+	}
+	var selected = map[string]bool{}
+	for _, filePath := range job.Files {
+		selected[filePath] = true
+	}
+	return selected
+}
@@ -0,0 +1,292 @@
+package torrents
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"rakoon/rakoon-back/bencode"
+	"rakoon/rakoon-back/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BitTorrent v2 hashes the files by blocks of this size, its pieces are a power of two of blocks
+const blockSize = 16 << 10
+
+// entry is a file in the info dictionary of a torrent
+type entry struct {
+	// path is nil for the only file of a single file torrent
+	path   []string
+	length int64
+	// Padding files align the files of hybrid torrents on the pieces, they are never written
+	padding bool
+}
+
+// Parse reads a .torrent file and checks that it describes a torrent, v1, v2 or hybrid.
+// The error describes what is malformed.
+func Parse(data []byte) (models.TorrentInfo, error) {
+	var result models.TorrentInfo
+	fields, err := bencode.DecodeDict(data)
+	if err != nil {
+		return result, err
+	}
+	raw, ok := fields["info"]
+	if !ok {
+		return result, invalid("the info dictionary is missing")
+	}
+	info, ok := decode(raw).(map[string]interface{})
+	if !ok {
+		return result, invalid("info is not a dictionary")
+	}
+
+	// The info hash is computed on the info dictionary as it was encoded
+	var hash [sha1.Size]byte = sha1.Sum(raw)
+	result.InfoHash = hex.EncodeToString(hash[:])
+	result.Name, ok = info["name"].(string)
+	if !ok || !validName(result.Name) {
+		return result, invalid("the name is missing or not valid")
+	}
+	result.PieceSize, ok = info["piece length"].(int64)
+	if !ok || result.PieceSize <= 0 {
+		return result, invalid("the piece length is missing or not valid")
+	}
+	private, _ := info["private"].(int64)
+	result.Private = private == 1
+
+	var files []entry
+	version, _ := info["meta version"].(int64)
+	if version == 2 {
+		if result.PieceSize < blockSize || result.PieceSize&(result.PieceSize-1) != 0 {
+			return result, invalid("the piece length is not a power of two of at least 16 KiB")
+		}
+		tree, ok := info["file tree"].(map[string]interface{})
+		if !ok {
+			return result, invalid("the file tree is missing")
+		}
+		files, err = fileTree(tree, nil)
+		if err != nil {
+			return result, err
+		}
+		if len(files) <= 0 {
+			return result, invalid("the file tree is empty")
+		}
+		// A single file at the root of the tree is a single file torrent
+		if len(files) == 1 && len(files[0].path) == 1 {
+			files[0].path = nil
+		}
+		var hashV2 [sha256.Size]byte = sha256.Sum256(raw)
+		result.InfoHashV2 = hex.EncodeToString(hashV2[:])
+		for _, file := range files {
+			result.Pieces += int((file.length + result.PieceSize - 1) / result.PieceSize)
+		}
+	} else if version != 0 {
+		return result, invalid("the meta version is not supported")
+	}
+
+	// The v1 files of a hybrid torrent are those of its file tree, with padding
+	if pieces, ok := info["pieces"]; ok {
+		hashes, ok := pieces.(string)
+		if !ok || len(hashes)%sha1.Size != 0 {
+			return result, invalid("the piece hashes are not valid")
+		}
+		v1Files, err := fileList(info)
+		if err != nil {
+			return result, err
+		}
+		var length int64
+		for _, file := range v1Files {
+			length += file.length
+		}
+		result.Pieces = len(hashes) / sha1.Size
+		if int64(result.Pieces) != (length+result.PieceSize-1)/result.PieceSize {
+			return result, invalid("the number of piece hashes does not match the size")
+		}
+		if version != 2 {
+			files = v1Files
+		}
+	} else if version != 2 {
+		return result, invalid("the piece hashes are missing")
+	}
+
+	for _, file := range files {
+		if !file.padding {
+			result.TotalSize += file.length
+		}
+	}
+	result.Files = fileEntries(result.Name, files)
+	result.Trackers = trackers(fields)
+	result.Comment, _ = decode(fields["comment"]).(string)
+	result.CreatedBy, _ = decode(fields["created by"]).(string)
+	if date, ok := decode(fields["creation date"]).(int64); ok && date > 0 {
+		var createdOn time.Time = time.Unix(date, 0).UTC()
+		result.CreatedOn = &createdOn
+	}
+	return result, nil
+}
+
+func invalid(reason string) error {
+	return errors.New("torrent: " + reason)
+}
+
+// This function decodes a field already checked by bencode.DecodeDict, nil when it is missing
+func decode(raw bencode.Raw) interface{} {
+	if raw == nil {
+		return nil
+	}
+	value, _ := bencode.Decode(raw)
+	return value
+}
+
+// The names in a torrent are written as files, they can not walk out of the folder of the torrent
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\x00")
+}
+
+// The files of a v1 torrent are its length, or a list of files with their length and path
+func fileList(info map[string]interface{}) ([]entry, error) {
+	if length, ok := info["length"].(int64); ok {
+		if length < 0 {
+			return nil, invalid("the length is not valid")
+		}
+		return []entry{{length: length}}, nil
+	}
+
+	list, ok := info["files"].([]interface{})
+	if !ok || len(list) <= 0 {
+		return nil, invalid("the length and the files are missing")
+	}
+	var files []entry
+	for _, item := range list {
+		file, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, invalid("a file is not a dictionary")
+		}
+		length, ok := file["length"].(int64)
+		if !ok || length < 0 {
+			return nil, invalid("the length of a file is missing or not valid")
+		}
+		components, ok := file["path"].([]interface{})
+		if !ok || len(components) <= 0 {
+			return nil, invalid("the path of a file is missing")
+		}
+		var path = make([]string, len(components))
+		for i, component := range components {
+			path[i], ok = component.(string)
+			if !ok || !validName(path[i]) {
+				return nil, invalid("the path of a file is not valid")
+			}
+		}
+		attributes, _ := file["attr"].(string)
+		files = append(files, entry{path: path, length: length, padding: strings.Contains(attributes, "p")})
+	}
+	return files, nil
+}
+
+// The file tree of a v2 torrent nests the folders, a file is a dictionary with an empty key holding its length
+func fileTree(tree map[string]interface{}, dir []string) ([]entry, error) {
+	var names []string
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var files []entry
+	for _, name := range names {
+		node, ok := tree[name].(map[string]interface{})
+		if !ok || !validName(name) {
+			return nil, invalid("the file tree is not valid")
+		}
+		var path []string = append(append([]string{}, dir...), name)
+
+		if file, ok := node[""]; ok {
+			properties, ok := file.(map[string]interface{})
+			if !ok {
+				return nil, invalid("the file tree is not valid")
+			}
+			length, ok := properties["length"].(int64)
+			if !ok || length < 0 {
+				return nil, invalid("the length of a file is missing or not valid")
+			}
+			files = append(files, entry{path: path, length: length})
+			continue
+		}
+
+		children, err := fileTree(node, path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, children...)
+	}
+	return files, nil
+}
+
+// The trackers of the announce list by tier, after the main tracker
+func trackers(fields map[string]bencode.Raw) []string {
+	var urls = []string{}
+	var seen = map[string]bool{}
+	var add = func(value interface{}) {
+		url, ok := value.(string)
+		if ok && len(url) > 0 && !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+
+	add(decode(fields["announce"]))
+	tiers, _ := decode(fields["announce-list"]).([]interface{})
+	for _, tier := range tiers {
+		tierURLs, _ := tier.([]interface{})
+		for _, url := range tierURLs {
+			add(url)
+		}
+	}
+	return urls
+}
+
+// node is a folder of the file tree being built
+type node struct {
+	entry    models.TorrentEntry
+	children []*node
+	folders  map[string]*node
+}
+
+// This function builds the file tree of a torrent: its only file, or a folder named after it
+func fileEntries(name string, files []entry) models.TorrentEntry {
+	if len(files) == 1 && files[0].path == nil {
+		return models.TorrentEntry{Name: name, Size: files[0].length}
+	}
+
+	var root *node = &node{entry: models.TorrentEntry{Name: name, IsDir: true}}
+	for _, file := range files {
+		if file.padding {
+			continue
+		}
+		var current *node = root
+		current.entry.Size += file.length
+		for _, folder := range file.path[:len(file.path)-1] {
+			child, ok := current.folders[folder]
+			if !ok {
+				child = &node{entry: models.TorrentEntry{Name: folder, IsDir: true}}
+				if current.folders == nil {
+					current.folders = map[string]*node{}
+				}
+				current.folders[folder] = child
+				current.children = append(current.children, child)
+			}
+			child.entry.Size += file.length
+			current = child
+		}
+		var fileName string = file.path[len(file.path)-1]
+		current.children = append(current.children, &node{entry: models.TorrentEntry{Name: fileName, Size: file.length}})
+	}
+	return root.build()
+}
+
+func (n *node) build() models.TorrentEntry {
+	for _, child := range n.children {
+		n.entry.Children = append(n.entry.Children, child.build())
+	}
+	return n.entry
+}
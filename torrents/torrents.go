@@ -0,0 +1,141 @@
+package torrents
+
+import (
+	"errors"
+	"log"
+	"os"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/quota"
+	"rakoon/rakoon-back/storage"
+	"strconv"
+	"sync"
+
+	"github.com/anacrolix/torrent"
+	torrentstorage "github.com/anacrolix/torrent/storage"
+)
+
+// DefaultPort is the port the peers connect to when none is configured
+const DefaultPort = 42069
+
+// ErrNotRunning is returned when a torrent is added while the engine is stopped
+var ErrNotRunning = errors.New("the torrent engine is not running")
+
+// ErrDuplicate is returned when a torrent is added while it is already downloaded
+var ErrDuplicate = errors.New("the torrent is already being downloaded")
+
+// ErrInvalid is returned for a malformed .torrent file
+var ErrInvalid = errors.New("the torrent file is not valid")
+
+// Config of the torrent engine
+type Config struct {
+	// ListenPort is the port the peers connect to, a random one when 0
+	ListenPort int
+	// NoDHT disables the distributed hash table, the peers are then only found by the trackers
+	NoDHT bool
+	// Loopback listens on the loopback interface only, the engine is then only reachable from the machine
+	Loopback bool
+}
+
+// The engine, a single client downloading every torrent
+var mutex sync.Mutex
+var client *torrent.Client
+var completion torrentstorage.PieceCompletion
+var downloads = map[int]*download{}
+
+// ConfigFromEnv reads the configuration of the engine from TORRENT_PORT and TORRENT_DHT
+func ConfigFromEnv() Config {
+	var config Config = Config{ListenPort: DefaultPort, NoDHT: os.Getenv("TORRENT_DHT") == "false"}
+	if port, err := strconv.Atoi(os.Getenv("TORRENT_PORT")); err == nil {
+		config.ListenPort = port
+	}
+	return config
+}
+
+// Start runs the torrent engine, and resumes the downloads interrupted by the last stop, fetching metadata, transferring or seeding.
+// The pieces already verified are remembered in ROOT_PATH/.rakoon/torrents.
+func Start(config Config) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if client != nil {
+		return nil
+	}
+
+	dataDir, err := storage.StagingDir("torrents")
+	if err != nil {
+		return err
+	}
+	completion, err = torrentstorage.NewDefaultPieceCompletionForDir(dataDir)
+	if err != nil {
+		return err
+	}
+
+	var clientConfig *torrent.ClientConfig = torrent.NewDefaultClientConfig()
+	clientConfig.DataDir = dataDir
+	clientConfig.DefaultStorage = torrentstorage.NewFileOpts(torrentstorage.NewFileClientOpts{ClientBaseDir: dataDir, PieceCompletion: completion})
+	clientConfig.ListenPort = config.ListenPort
+	clientConfig.NoDHT = config.NoDHT
+	if config.Loopback {
+		clientConfig.ListenHost = torrent.LoopbackListenHost
+	}
+	client, err = torrent.NewClient(clientConfig)
+	if err != nil {
+		completion.Close()
+		return err
+	}
+
+	jobs, err := models.GetTorrentJobsByState(models.JobRunning, models.TorrentMetadata, models.TorrentSeeding)
+	if err != nil {
+		log.Println("Could not resume torrents: " + err.Error())
+		return nil
+	}
+	// The reservations did not survive the restart, the downloads make them again
+	for _, job := range jobs {
+		var reserved int64 = remaining(job)
+		err = quota.Reserve(job.OwnerID, reserved)
+		if err == nil {
+			err = start(job, reserved)
+			if err != nil {
+				quota.Release(job.OwnerID, reserved)
+			}
+		}
+		if err != nil {
+			log.Println("Could not resume torrent " + strconv.Itoa(job.ID) + ": " + err.Error())
+			models.FinishTorrentJob(job.ID, models.JobFailed, job.Completed, err.Error())
+		}
+	}
+	return nil
+}
+
+// Close stops the engine. The downloads keep their state and go on at the next start.
+func Close() {
+	mutex.Lock()
+	var stopped []*download
+	for ID, download := range downloads {
+		stopped = append(stopped, download)
+		delete(downloads, ID)
+	}
+	var closed *torrent.Client = client
+	client = nil
+	mutex.Unlock()
+
+	if closed == nil {
+		return
+	}
+	for _, download := range stopped {
+		close(download.stop)
+		<-download.done
+		download.release()
+	}
+	closed.Close()
+	completion.Close()
+}
+
+// Port returns the port the engine listens on, 0 when it is not running
+func Port() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if client == nil {
+		return 0
+	}
+	return client.LocalPort()
+}
@@ -0,0 +1,215 @@
+package versions
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/events"
+	"rakoon/rakoon-back/fileops"
+	"rakoon/rakoon-back/models"
+	"rakoon/rakoon-back/quota"
+	"rakoon/rakoon-back/storage"
+	"strconv"
+	"time"
+)
+
+// Policy decides how many versions of a file are kept
+type Policy struct {
+	// Keep is the maximum number of versions of a file, 0 for no limit
+	Keep int
+	// MaxAge is the age after which a version is removed, 0 for no limit
+	MaxAge time.Duration
+}
+
+// PolicyFromEnv reads the retention policy from the environment, by default the last 10 versions of a file are kept
+func PolicyFromEnv() Policy {
+	var policy Policy = Policy{Keep: 10}
+
+	if keep, err := strconv.Atoi(os.Getenv("VERSIONS_KEEP")); err == nil {
+		policy.Keep = keep
+	}
+	if maxAgeDays, err := strconv.Atoi(os.Getenv("VERSIONS_MAX_AGE_DAYS")); err == nil {
+		policy.MaxAge = time.Duration(maxAgeDays) * 24 * time.Hour
+	}
+	return policy
+}
+
+// Dir returns the directory holding the versions of a user's files, under the server's staging area
+func Dir(userID int) (string, error) {
+	staging, err := storage.StagingDir("versions")
+	if err != nil {
+		return "", err
+	}
+
+	var dir string = filepath.Join(staging, strconv.Itoa(userID))
+	return dir, os.MkdirAll(dir, 0755)
+}
+
+// DataPath returns the path of a version's content
+func DataPath(version models.FileVersion) (string, error) {
+	dir, err := Dir(version.UserID)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, strconv.Itoa(version.ID)), nil
+}
+
+// Replace atomically replaces a file of a user's space by a new content, the previous content is kept as a version.
+// The new content must already be accounted in the user's quota.
+func Replace(userID int, newContent string, path string) error {
+	var event events.Event = events.Event{Type: events.Modified, UserID: userID, Path: path}
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		event.Type = events.Created
+	}
+
+	err := Keep(userID, path)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(newContent, path)
+	if err == nil {
+		events.Publish(event)
+	}
+	return err
+}
+
+// Restore brings back the content of a version, the current content of the file is kept as a new version.
+// The restored copy is reserved in the user's quota, quota.ErrExceeded is returned if it does not fit.
+func Restore(ctx context.Context, version models.FileVersion) error {
+	path, err := storage.Resolve(version.UserID, version.Path)
+	if err != nil {
+		return err
+	}
+	data, err := DataPath(version)
+	if err != nil {
+		return err
+	}
+
+	err = quota.Reserve(version.UserID, version.Size)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		quota.Release(version.UserID, version.Size)
+		return err
+	}
+
+	// The version is first copied next to the file, so that the replacement is a rename
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".rakoon-")
+	if err != nil {
+		quota.Release(version.UserID, version.Size)
+		return err
+	}
+	tmp.Close()
+	_, err = fileops.Copy(ctx, data, tmp.Name(), fileops.Overwrite, nil)
+	if err == nil {
+		err = Replace(version.UserID, tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		quota.Release(version.UserID, version.Size)
+		return err
+	}
+	quota.Commit(version.UserID, version.Size)
+	return nil
+}
+
+// Remove deletes a version
+func Remove(version models.FileVersion) error {
+	data, err := DataPath(version)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(data)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		quota.Add(version.UserID, -version.Size)
+	}
+	models.DeleteFileVersion(version.ID)
+	return nil
+}
+
+// Prune applies the retention policy to the versions of a file
+func Prune(userID int, clientPath string, policy Policy) error {
+	versions, err := models.GetFileVersions(userID, clientPath)
+	if err != nil {
+		return err
+	}
+
+	for i, version := range versions {
+		var tooMany bool = policy.Keep > 0 && i >= policy.Keep
+		var tooOld bool = policy.MaxAge > 0 && time.Since(version.CreatedOn) > policy.MaxAge
+		if tooMany || tooOld {
+			err = Remove(version)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// StartPurger removes the versions older than the maximum age of the policy, at every interval
+func StartPurger(policy Policy, interval time.Duration) {
+	if policy.MaxAge <= 0 {
+		return
+	}
+
+	go func() {
+		for {
+			expired, err := models.GetExpiredFileVersions(policy.MaxAge)
+			if err != nil {
+				log.Println("Could not purge versions:", err)
+			}
+			for _, version := range expired {
+				err = Remove(version)
+				if err != nil {
+					log.Println("Could not purge version", version.ID, ":", err)
+				}
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Keep moves the current content of a file to its history. Nothing is done if there is no regular file at the path.
+func Keep(userID int, path string) error {
+	fileInfo, err := os.Lstat(path)
+	if os.IsNotExist(err) || (err == nil && !fileInfo.Mode().IsRegular()) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	clientPath, err := storage.Relative(userID, path)
+	if err != nil {
+		return err
+	}
+
+	version, err := models.CreateFileVersion(models.FileVersion{
+		UserID: userID,
+		Path:   clientPath,
+		Size:   fileInfo.Size(),
+	})
+	if err != nil {
+		return err
+	}
+	data, err := DataPath(version)
+	if err != nil {
+		return err
+	}
+
+	// The versions are stored under ROOT_PATH like the homes, the rename does not copy the content
+	err = os.Rename(path, data)
+	if err != nil {
+		models.DeleteFileVersion(version.ID)
+		return err
+	}
+	return Prune(userID, clientPath, PolicyFromEnv())
+}
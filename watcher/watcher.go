@@ -0,0 +1,300 @@
+package watcher
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"rakoon/rakoon-back/events"
+	"rakoon/rakoon-back/storage"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// The changes the API reported itself are not published again when they are seen on the disk.
+// An operation is expected to report its changes within this delay after touching the disk.
+const reportedWindow = 10 * time.Second
+
+// DefaultDebounce is the delay used when none is configured
+const DefaultDebounce = 500 * time.Millisecond
+
+// Watcher follows the changes made in the users' homes and publishes them on the event bus once they settle
+type Watcher struct {
+	fs           *fsnotify.Watcher
+	homes        string
+	debounce     time.Duration
+	subscription *events.Subscription
+	done         chan bool
+	closeOnce    sync.Once
+
+	// The state below is only used by the loop goroutine
+	pending  map[string]*change
+	renamed  []rename
+	reported map[string]report
+}
+
+// report is a change the API made itself. A folder created, moved or deleted covers the changes of its content,
+// a modification only covers the path itself.
+type report struct {
+	time    time.Time
+	subtree bool
+}
+
+// change accumulates the operations seen on a path until it settles
+type change struct {
+	created   bool
+	removed   bool
+	movedFrom string
+	movedTo   string
+	last      time.Time
+}
+
+// rename is a path renamed away, waiting for the creation of its new name
+type rename struct {
+	path string
+	time time.Time
+}
+
+// Start watches the users' homes recursively. A path is published once no event was seen on it for the debounce delay.
+func Start(debounce time.Duration) (*Watcher, error) {
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+	homes, err := storage.HomesDir()
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(homes, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	fs, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	var watcher = &Watcher{
+		fs:           fs,
+		homes:        homes,
+		debounce:     debounce,
+		subscription: events.Subscribe(),
+		done:         make(chan bool),
+		pending:      map[string]*change{},
+		reported:     map[string]report{},
+	}
+	watcher.addRecursive(homes)
+
+	go watcher.loop()
+	return watcher, nil
+}
+
+// Close stops the watcher
+func (watcher *Watcher) Close() error {
+	var err error
+	watcher.closeOnce.Do(func() {
+		close(watcher.done)
+		watcher.subscription.Close()
+		err = watcher.fs.Close()
+	})
+	return err
+}
+
+func (watcher *Watcher) loop() {
+	ticker := time.NewTicker(watcher.debounce / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-watcher.done:
+			return
+		case event, ok := <-watcher.fs.Events:
+			if !ok {
+				return
+			}
+			watcher.record(event, time.Now())
+		case err, ok := <-watcher.fs.Errors:
+			if !ok {
+				return
+			}
+			log.Println("Storage watcher error: " + err.Error())
+		case event, ok := <-watcher.subscription.C:
+			if !ok {
+				return
+			}
+			if event.Source == events.SourceAPI && event.IsFileEvent() {
+				var reported report = report{time: event.Time, subtree: event.Type != events.Modified}
+				watcher.reported[event.Path] = reported
+				if len(event.OldPath) > 0 {
+					watcher.reported[event.OldPath] = reported
+				}
+			}
+		case now := <-ticker.C:
+			watcher.flush(now)
+		}
+	}
+}
+
+// This function accumulates an event on its path. A creation following a rename gives the new name of the renamed path.
+func (watcher *Watcher) record(event fsnotify.Event, now time.Time) {
+	if event.Name == watcher.homes || isTemporary(event.Name) || event.Op == fsnotify.Chmod {
+		return
+	}
+
+	c, ok := watcher.pending[event.Name]
+	if !ok {
+		c = &change{}
+		watcher.pending[event.Name] = c
+	}
+	c.last = now
+
+	if event.Op&fsnotify.Create != 0 {
+		c.created = true
+		c.removed = false
+		if len(watcher.renamed) > 0 {
+			c.movedFrom = watcher.renamed[0].path
+			watcher.renamed = watcher.renamed[1:]
+			if source, ok := watcher.pending[c.movedFrom]; ok && c.movedFrom != event.Name {
+				source.movedTo = event.Name
+			}
+		}
+
+		// The content of a new folder is watched too, what it already holds is covered by its own event.
+		// A moved folder is watched again once the move settled.
+		fileInfo, err := os.Lstat(event.Name)
+		if err == nil && fileInfo.IsDir() && len(c.movedFrom) <= 0 {
+			watcher.addRecursive(event.Name)
+		}
+	}
+	if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		c.removed = true
+	}
+	// A moved folder reports its rename twice, from its parent and from itself
+	var known bool = len(c.movedTo) > 0 || (len(watcher.renamed) > 0 && watcher.renamed[len(watcher.renamed)-1].path == event.Name)
+	if event.Op&fsnotify.Rename != 0 && !known {
+		watcher.renamed = append(watcher.renamed, rename{path: event.Name, time: now})
+	}
+}
+
+// This function publishes the paths which settled
+func (watcher *Watcher) flush(now time.Time) {
+	for path, c := range watcher.pending {
+		if now.Sub(c.last) < watcher.debounce {
+			continue
+		}
+		// The source of a move is published with its target
+		if _, ok := watcher.pending[c.movedTo]; ok {
+			continue
+		}
+		delete(watcher.pending, path)
+
+		// The watches of a moved folder keep its old name, they are replaced
+		if len(c.movedFrom) > 0 && c.movedFrom != path {
+			delete(watcher.pending, c.movedFrom)
+			watcher.removeWatches(c.movedFrom)
+			if fileInfo, err := os.Lstat(path); err == nil && fileInfo.IsDir() {
+				watcher.addRecursive(path)
+			}
+			if !watcher.wasReported(path, now) || !watcher.wasReported(c.movedFrom, now) {
+				watcher.publishMove(c.movedFrom, path)
+			}
+			continue
+		}
+
+		_, err := os.Lstat(path)
+		var exists bool = err == nil
+		if !exists {
+			watcher.removeWatches(path)
+		}
+		if (!exists && c.created && !c.removed) || watcher.wasReported(path, now) {
+			continue
+		}
+
+		var event events.Event = events.Event{Type: events.Modified, Path: path}
+		if !exists {
+			event.Type = events.Deleted
+		} else if c.created {
+			event.Type = events.Created
+		}
+		watcher.publish(event)
+	}
+
+	// A rename without a new name moved the path out of the homes
+	for len(watcher.renamed) > 0 && now.Sub(watcher.renamed[0].time) >= watcher.debounce {
+		watcher.removeWatches(watcher.renamed[0].path)
+		watcher.renamed = watcher.renamed[1:]
+	}
+	for path, reported := range watcher.reported {
+		if now.Sub(reported.time) >= reportedWindow {
+			delete(watcher.reported, path)
+		}
+	}
+}
+
+// A move between two users' spaces is seen as a deletion and a creation
+func (watcher *Watcher) publishMove(source string, target string) {
+	sourceUserID, sourceErr := storage.Owner(source)
+	targetUserID, targetErr := storage.Owner(target)
+	if sourceErr == nil && targetErr == nil && sourceUserID == targetUserID {
+		watcher.publish(events.Event{Type: events.Moved, Path: target, OldPath: source})
+		return
+	}
+	watcher.publish(events.Event{Type: events.Deleted, Path: source})
+	watcher.publish(events.Event{Type: events.Created, Path: target})
+}
+
+func (watcher *Watcher) publish(event events.Event) {
+	userID, err := storage.Owner(event.Path)
+	if err != nil {
+		return
+	}
+	event.UserID = userID
+	event.Source = events.SourceWatcher
+	events.Publish(event)
+}
+
+// This function checks if the API reported a change of a path recently, or the creation, move or deletion of one of its parents
+func (watcher *Watcher) wasReported(path string, now time.Time) bool {
+	var exact bool = true
+	for storage.Contains(watcher.homes, path) && path != watcher.homes {
+		reported, ok := watcher.reported[path]
+		if ok && now.Sub(reported.time) < reportedWindow && (exact || reported.subtree) {
+			return true
+		}
+		path = filepath.Dir(path)
+		exact = false
+	}
+	return false
+}
+
+func (watcher *Watcher) addRecursive(root string) {
+	filepath.Walk(root, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil || !fileInfo.IsDir() {
+			return nil
+		}
+		err = watcher.fs.Add(path)
+		if err != nil {
+			// Usually the limit of inotify watches of the system
+			log.Println("Could not watch " + path + ": " + err.Error())
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// The watches of a folder removed or moved are not needed anymore
+func (watcher *Watcher) removeWatches(root string) {
+	for _, path := range watcher.fs.WatchList() {
+		if storage.Contains(root, path) {
+			watcher.fs.Remove(path)
+		}
+	}
+}
+
+// The server writes its files next to their target under a temporary name before renaming them
+func isTemporary(path string) bool {
+	var name string = filepath.Base(path)
+	return strings.HasPrefix(name, ".") && strings.Contains(name, ".rakoon-")
+}